@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/shopspring/decimal"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// floatNoise is the largest difference between two amounts that is considered a float64 rounding error
+var floatNoise = decimal.New(1, -6)
+
+// moneyColumns are the money columns changed from double precision to numeric
+var moneyColumns = map[string][]string{
+	"payments":    {"amount", "hourly_rate", "convert_rate", "expected_amount"},
+	"rate_quotes": {"amount", "rate", "expected_amount"},
+}
+
+// coinDecimalsSQL returns the precision of the coin of the row, it matches utils.Method.Decimals
+const coinDecimalsSQL = "CASE %s WHEN 'eth' THEN 18 WHEN 'usdt' THEN 6 ELSE 8 END"
+
+// MigrateMoneyNumeric converts the money columns to numeric and removes the float64 rounding errors
+func MigrateMoneyNumeric() {
+	// Get database connection string from environment variable
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("DATABASE_URL environment variable is required")
+	}
+
+	// Connect to database
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	})
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+
+	log.Println("Starting money columns migration...")
+
+	// Begin transaction
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Fatal("Migration failed with panic:", r)
+		}
+	}()
+
+	for table, columns := range moneyColumns {
+		if !tx.Migrator().HasTable(table) {
+			log.Printf("Table %s does not exist, skipping", table)
+			continue
+		}
+		for _, column := range columns {
+			query := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE numeric USING %s::numeric", table, column, column)
+			if err := tx.Exec(query).Error; err != nil {
+				tx.Rollback()
+				log.Fatalf("Failed to convert %s.%s: %v", table, column, err)
+			}
+		}
+	}
+
+	// the expected amounts were rounded to 8 decimals or kept the float64 noise, round them to the coin precision
+	roundExpected := fmt.Sprintf("UPDATE payments SET expected_amount = ROUND(expected_amount, %s) WHERE expected_amount IS NOT NULL",
+		fmt.Sprintf(coinDecimalsSQL, "payment_method"))
+	if err := tx.Exec(roundExpected).Error; err != nil {
+		tx.Rollback()
+		log.Fatal("Failed to round the expected amounts:", err)
+	}
+	if tx.Migrator().HasTable("rate_quotes") {
+		roundQuotes := fmt.Sprintf("UPDATE rate_quotes SET expected_amount = ROUND(expected_amount, %s)",
+			fmt.Sprintf(coinDecimalsSQL, "coin"))
+		if err := tx.Exec(roundQuotes).Error; err != nil {
+			tx.Rollback()
+			log.Fatal("Failed to round the quoted amounts:", err)
+		}
+	}
+
+	// Load the invoice lines into memory first
+	type PaymentData struct {
+		ID         uint64
+		Amount     decimal.Decimal
+		HourlyRate decimal.Decimal
+		Details    storage.PaymentDetails
+	}
+	var payments []PaymentData
+	if err := tx.Raw(`
+		SELECT id, amount, hourly_rate, details
+		FROM payments
+		WHERE details IS NOT NULL
+		AND details::text != 'null'
+		AND details::text != '[]'
+	`).Scan(&payments).Error; err != nil {
+		tx.Rollback()
+		log.Fatal("Failed to query payments:", err)
+	}
+
+	log.Printf("Found %d payments with details to process", len(payments))
+
+	fixedCount := 0
+	for _, payment := range payments {
+		changed := false
+		amount := decimal.Zero
+		for i, detail := range payment.Details {
+			if detail.Quantity.IsPositive() {
+				price := payment.HourlyRate
+				if detail.Price.IsPositive() {
+					price = detail.Price
+				}
+				cost := detail.Quantity.Mul(price)
+				if !cost.Equal(detail.Cost) && cost.Sub(detail.Cost).Abs().LessThan(floatNoise) {
+					payment.Details[i].Cost = cost
+					changed = true
+				}
+			}
+			amount = amount.Add(payment.Details[i].Cost)
+		}
+		if !amount.Equal(payment.Amount) && amount.Sub(payment.Amount).Abs().LessThan(floatNoise) {
+			payment.Amount = amount
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := tx.Exec("UPDATE payments SET details = ?, amount = ? WHERE id = ?",
+			payment.Details, payment.Amount, payment.ID).Error; err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to update payment %d: %v", payment.ID, err)
+		}
+		log.Printf("Removed the rounding errors of payment ID %d", payment.ID)
+		fixedCount++
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		log.Fatal("Failed to commit transaction:", err)
+	}
+
+	log.Println("========================================")
+	log.Printf("Migration completed!")
+	log.Printf("Payments with rounding errors fixed: %d", fixedCount)
+	log.Println("========================================")
+}
+
+func main() {
+	fmt.Println("========================================")
+	fmt.Println("Money Columns Migration Tool")
+	fmt.Println("This will convert the money columns of the payments and rate_quotes tables")
+	fmt.Println("from double precision to numeric and round the amounts to the coin precision")
+	fmt.Println("========================================")
+
+	// Check if DATABASE_URL is set
+	if os.Getenv("DATABASE_URL") == "" {
+		fmt.Println("\nError: DATABASE_URL environment variable is not set")
+		fmt.Println("Usage: DATABASE_URL=postgres://... go run ./cmd/migrate-money-numeric")
+		os.Exit(1)
+	}
+
+	fmt.Println("\nPress Enter to continue or Ctrl+C to cancel...")
+	fmt.Scanln()
+
+	MigrateMoneyNumeric()
+}
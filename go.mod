@@ -9,6 +9,7 @@ require (
 	github.com/go-playground/validator/v10 v10.11.1
 	github.com/golang-jwt/jwt/v4 v4.5.1
 	github.com/jackc/pgx/v5 v5.2.0
+	github.com/shopspring/decimal v1.4.0
 	golang.org/x/crypto v0.38.0
 	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/postgres v1.4.6
@@ -17,11 +18,20 @@ require (
 
 require (
 	github.com/btcsuite/btcd v0.24.2
+	github.com/btcsuite/btcd/btcutil/psbt v1.1.8
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0
+	github.com/decred/dcrd/chaincfg/v2 v2.3.0
+	github.com/decred/dcrd/dcrec v1.0.0
+	github.com/decred/dcrd/dcrutil/v2 v2.0.1
+	github.com/decred/dcrd/hdkeychain/v2 v2.1.0
 	github.com/googollee/go-socket.io v1.7.0
 	github.com/gorilla/schema v1.2.0
 	github.com/jrick/logrotate v1.1.2
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/ltcsuite/ltcd v0.23.6-0.20250505084124-c37ac1524e04
 	github.com/pquerna/otp v1.4.0
+	golang.org/x/image v0.23.0
+	golang.org/x/sync v0.14.0
 	google.golang.org/grpc v1.72.0
 	google.golang.org/protobuf v1.36.6
 )
@@ -31,19 +41,20 @@ require (
 	github.com/agl/ed25519 v0.0.0-20170116200512-5312a6153412 // indirect
 	github.com/blendle/zapdriver v1.3.1 // indirect
 	github.com/btcsuite/btcd/btcec/v2 v2.1.3 // indirect
-	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0 // indirect
+	github.com/btcsuite/btclog v0.0.0-20170628155309-84c8d2346e9f // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/dchest/blake256 v1.0.0 // indirect
-	github.com/decred/base58 v1.0.0 // indirect
+	github.com/decred/base58 v1.0.1 // indirect
 	github.com/decred/dcrd/chaincfg v1.5.1 // indirect
-	github.com/decred/dcrd/chaincfg/chainhash v1.0.1 // indirect
-	github.com/decred/dcrd/chaincfg/v2 v2.0.2 // indirect
-	github.com/decred/dcrd/dcrec v1.0.0 // indirect
+	github.com/decred/dcrd/chaincfg/chainhash v1.0.2 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/crypto/ripemd160 v1.0.0 // indirect
 	github.com/decred/dcrd/dcrec/edwards v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/edwards/v2 v2.0.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1 v1.0.2 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v2 v2.0.0 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
-	github.com/decred/dcrd/dcrutil/v2 v2.0.0 // indirect
-	github.com/decred/dcrd/wire v1.2.0 // indirect
+	github.com/decred/dcrd/wire v1.3.0 // indirect
 	github.com/fatih/color v1.16.0 // indirect
 	github.com/gagliardetto/binary v0.8.0 // indirect
 	github.com/gagliardetto/treeout v0.1.4 // indirect
@@ -72,7 +83,7 @@ require (
 )
 
 require (
-	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc // indirect
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc
 	github.com/btcsuite/btcd/btcutil v1.1.6
 	github.com/decred/dcrd/dcrutil v1.4.1
 	github.com/ethereum/go-ethereum v1.16.1
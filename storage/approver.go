@@ -9,8 +9,18 @@ import (
 )
 
 type PaymentSetting struct {
-	Type    utils.Method `json:"type"`
-	Address string       `json:"address"`
+	Type    utils.Method  `json:"type"`
+	Network utils.Network `json:"network,omitempty"`
+	Address string        `json:"address"`
+}
+
+// NetworkOrDefault returns the network of the setting, falling back to the
+// default network of the coin for settings saved before networks existed
+func (ps PaymentSetting) NetworkOrDefault() utils.Network {
+	if ps.Network != "" {
+		return ps.Network
+	}
+	return utils.DefaultNetworkForMethod(ps.Type)
 }
 
 type PaymentSettings []PaymentSetting
@@ -64,7 +64,14 @@ func NewStorage(c Config, oslogger *oslog.Logger) (Storage, error) {
 }
 
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&User{}, &Payment{}, &ApproverSettings{}, &Project{}, &UserTimer{}, &UserPaymentMethod{})
+	err := db.AutoMigrate(&User{}, &Payment{}, &ApproverSettings{}, &Project{}, &UserTimer{}, &UserPaymentMethod{}, &DerivedAddress{}, &RateQuote{}, &BulkRateQuote{}, &RateSample{}, &RecurringPayment{}, &PaymentTransaction{}, &InvoiceNumbering{}, &InvoiceNumberSequence{}, &PaymentDispute{}, &DisputeMessage{}, &PaymentRevision{}, &PaymentEvent{})
+	if err != nil {
+		return err
+	}
+	if err := uniquePaymentTransactions(db); err != nil {
+		return err
+	}
+	return protectPaymentEvents(db)
 }
 
 func (p *psql) Create(obj interface{}) error {
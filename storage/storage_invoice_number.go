@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultInvoicePrefix  = "INV-"
+	DefaultInvoicePadding = 4
+	MaxInvoicePadding     = 12
+)
+
+// InvoiceNumbering is the numbering scheme of the invoices of a sender. The number is the prefix,
+// the year of the invoice when the sequence is reset every year, and the sequence padded with zeros
+type InvoiceNumbering struct {
+	UserId      uint64    `json:"userId" gorm:"primarykey;autoIncrement:false"`
+	Prefix      string    `json:"prefix"`
+	YearlyReset bool      `json:"yearlyReset"`
+	Padding     int       `json:"padding"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// InvoiceNumberSequence is the last number assigned to the invoices of a sender in a year,
+// the year is 0 when the sequence is not reset every year
+type InvoiceNumberSequence struct {
+	UserId     uint64    `json:"userId" gorm:"primarykey;autoIncrement:false"`
+	Year       int       `json:"year" gorm:"primarykey;autoIncrement:false"`
+	LastNumber int64     `json:"lastNumber"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// DefaultInvoiceNumbering is the scheme of the senders who did not configure one, e.g. INV-2024-0001
+func DefaultInvoiceNumbering(userId uint64) InvoiceNumbering {
+	return InvoiceNumbering{
+		UserId:      userId,
+		Prefix:      DefaultInvoicePrefix,
+		YearlyReset: true,
+		Padding:     DefaultInvoicePadding,
+	}
+}
+
+// SequenceYear returns the year of the sequence the invoices sent at the time are numbered in
+func (n InvoiceNumbering) SequenceYear(sentAt time.Time) int {
+	if !n.YearlyReset {
+		return 0
+	}
+	return sentAt.Year()
+}
+
+// Format returns the invoice number of the sequence number in the year of the sequence
+func (n InvoiceNumbering) Format(year int, number int64) string {
+	if year > 0 {
+		return fmt.Sprintf("%s%d-%0*d", n.Prefix, year, n.Padding, number)
+	}
+	return fmt.Sprintf("%s%0*d", n.Prefix, n.Padding, number)
+}
+
+func (InvoiceNumbering) TableName() string {
+	return "invoice_numberings"
+}
+
+func (InvoiceNumberSequence) TableName() string {
+	return "invoice_number_sequences"
+}
+
+// DisplayNumber returns the invoice number of the payment, or its id while it is a draft
+func (p Payment) DisplayNumber() string {
+	if len(p.InvoiceNumber) > 0 {
+		return p.InvoiceNumber
+	}
+	return fmt.Sprintf("#%d", p.Id)
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type DisputeStatus int
+
+func (p DisputeStatus) String() string {
+	switch p {
+	case DisputeStatusOpen:
+		return "open"
+	case DisputeStatusAccepted:
+		return "accepted"
+	case DisputeStatusWithdrawn:
+		return "withdrawn"
+	}
+	return "unknown"
+}
+
+func (p DisputeStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *DisputeStatus) UnmarshalText(val []byte) error {
+	switch string(val) {
+	case "open":
+		*p = DisputeStatusOpen
+	case "accepted":
+		*p = DisputeStatusAccepted
+	case "withdrawn":
+		*p = DisputeStatusWithdrawn
+	default:
+		return fmt.Errorf("dispute status invalid value")
+	}
+	return nil
+}
+
+func (p *DisputeStatus) UnmarshalJSON(v []byte) error {
+	var val string
+	if err := json.Unmarshal(v, &val); err != nil {
+		return err
+	}
+	return p.UnmarshalText([]byte(val))
+}
+
+const (
+	DisputeStatusOpen DisputeStatus = iota
+	// DisputeStatusAccepted the receiver accepted the payment as it was revised, it can be paid again
+	DisputeStatusAccepted
+	// DisputeStatusWithdrawn the sender withdrew the payment, it is rejected
+	DisputeStatusWithdrawn
+)
+
+// DisputeLines are the line numbers of the payment details a dispute is about, starting at 1
+type DisputeLines []int
+
+// Value Marshal
+func (a DisputeLines) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan Unmarshal
+func (a *DisputeLines) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, &a)
+}
+
+// PaymentDispute is raised by the receiver or an approver of a sent payment. The payment is disputed
+// until the receiver accepts it, as revised by the sender, or the sender withdraws it
+type PaymentDispute struct {
+	Id             uint64        `json:"id" gorm:"primarykey"`
+	PaymentId      uint64        `json:"paymentId" gorm:"index"`
+	OpenedBy       uint64        `json:"openedBy"`
+	OpenedByName   string        `json:"openedByName"`
+	Reason         string        `json:"reason"`
+	Lines          DisputeLines  `json:"lines" gorm:"type:jsonb"`
+	Status         DisputeStatus `json:"status"`
+	PreviousStatus PaymentStatus `json:"previousStatus"`
+	Resolution     string        `json:"resolution"`
+	ResolvedBy     uint64        `json:"resolvedBy"`
+	ResolvedAt     *time.Time    `json:"resolvedAt"`
+	CreatedAt      time.Time     `json:"createdAt"`
+	UpdatedAt      time.Time     `json:"updatedAt"`
+
+	Messages  []DisputeMessage  `json:"messages,omitempty" gorm:"-"`
+	Revisions []PaymentRevision `json:"revisions,omitempty" gorm:"-"`
+}
+
+// DisputeMessage is a message of the thread of a dispute, a message is also added when the
+// payment is revised or the dispute is resolved
+type DisputeMessage struct {
+	Id        uint64    `json:"id" gorm:"primarykey"`
+	DisputeId uint64    `json:"disputeId" gorm:"index"`
+	UserId    uint64    `json:"userId"`
+	UserName  string    `json:"userName"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PaymentRevision keeps the version of the payment the sender revised during a dispute
+type PaymentRevision struct {
+	Id          uint64          `json:"id" gorm:"primarykey"`
+	PaymentId   uint64          `json:"paymentId" gorm:"index"`
+	DisputeId   uint64          `json:"disputeId" gorm:"index"`
+	Version     int             `json:"version"`
+	Description string          `json:"description"`
+	HourlyRate  decimal.Decimal `json:"hourlyRate" gorm:"type:numeric"`
+	Details     PaymentDetails  `json:"details" gorm:"type:jsonb"`
+	Subtotal    decimal.Decimal `json:"subtotal" gorm:"type:numeric"`
+	Discount    decimal.Decimal `json:"discount" gorm:"type:numeric"`
+	TaxRate     decimal.Decimal `json:"taxRate" gorm:"type:numeric"`
+	TaxAmount   decimal.Decimal `json:"taxAmount" gorm:"type:numeric"`
+	TaxLines    TaxLines        `json:"taxLines" gorm:"type:jsonb"`
+	Amount      decimal.Decimal `json:"amount" gorm:"type:numeric"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// NewPaymentRevision returns the revision keeping the current version of the payment
+func NewPaymentRevision(payment Payment, disputeId uint64, version int) PaymentRevision {
+	return PaymentRevision{
+		PaymentId:   payment.Id,
+		DisputeId:   disputeId,
+		Version:     version,
+		Description: payment.Description,
+		HourlyRate:  payment.HourlyRate,
+		Details:     payment.Details,
+		Subtotal:    payment.Subtotal,
+		Discount:    payment.Discount,
+		TaxRate:     payment.TaxRate,
+		TaxAmount:   payment.TaxAmount,
+		TaxLines:    payment.TaxLines,
+		Amount:      payment.Amount,
+	}
+}
+
+func (PaymentDispute) TableName() string {
+	return "payment_disputes"
+}
+
+func (DisputeMessage) TableName() string {
+	return "dispute_messages"
+}
+
+func (PaymentRevision) TableName() string {
+	return "payment_revisions"
+}
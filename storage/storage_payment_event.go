@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PaymentAction is what a user or the server did to a payment
+type PaymentAction string
+
+const (
+	PaymentActionCreated              PaymentAction = "created"
+	PaymentActionUpdated              PaymentAction = "updated"
+	PaymentActionSent                 PaymentAction = "sent"
+	PaymentActionApproved             PaymentAction = "approved"
+	PaymentActionRejected             PaymentAction = "rejected"
+	PaymentActionTransactionAdded     PaymentAction = "transaction_added"
+	PaymentActionTransactionConfirmed PaymentAction = "transaction_confirmed"
+	// PaymentActionTransactionConfirmations the confirming transaction got more confirmations
+	PaymentActionTransactionConfirmations PaymentAction = "transaction_confirmations"
+	PaymentActionTransactionFlagged       PaymentAction = "transaction_flagged"
+	PaymentActionDisputed                 PaymentAction = "disputed"
+	PaymentActionRevised                  PaymentAction = "revised"
+	PaymentActionDisputeResolved          PaymentAction = "dispute_resolved"
+	PaymentActionRefunded                 PaymentAction = "refunded"
+	// PaymentActionKeptAsCredit the credit note is settled without refund, the receiver keeps the credit
+	PaymentActionKeptAsCredit PaymentAction = "kept_as_credit"
+)
+
+// snapshotIgnoredFields are the fields of the payment that are not compared between two snapshots
+var snapshotIgnoredFields = []string{"createdAt", "updatedAt", "version", "paymentUrl", "transactions"}
+
+// PaymentSnapshot is the json of every field of a payment, taken before the payment is changed
+type PaymentSnapshot map[string]json.RawMessage
+
+// NewPaymentSnapshot returns the snapshot of the payment. The snapshot is a copy, the changes made
+// to the approvers or the details of the payment after it is taken are not seen in the snapshot
+func NewPaymentSnapshot(payment Payment) PaymentSnapshot {
+	snapshot := make(PaymentSnapshot)
+	b, err := json.Marshal(payment)
+	if err != nil {
+		return snapshot
+	}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return snapshot
+	}
+	for _, field := range snapshotIgnoredFields {
+		delete(snapshot, field)
+	}
+	return snapshot
+}
+
+// Diff returns the fields that changed from the snapshot to the other one
+func (s PaymentSnapshot) Diff(other PaymentSnapshot) PaymentChanges {
+	changes := make(PaymentChanges)
+	for field, to := range other {
+		from := s[field]
+		if bytes.Equal(from, to) {
+			continue
+		}
+		changes[field] = PaymentChange{From: from, To: to}
+	}
+	for field, from := range s {
+		if _, ok := other[field]; !ok {
+			changes[field] = PaymentChange{From: from}
+		}
+	}
+	return changes
+}
+
+// PaymentChange is the json value of a field before and after the change, From is empty when the
+// field had no value
+type PaymentChange struct {
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// PaymentChanges are the changed fields of a payment by their json name
+type PaymentChanges map[string]PaymentChange
+
+// Value Marshal
+func (a PaymentChanges) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan Unmarshal
+func (a *PaymentChanges) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, &a)
+}
+
+// PaymentEvent is an entry of the history of a payment. The events are only appended, they are never
+// updated or deleted, even when the payment is, a trigger of the table refuses the changes.
+// The actor is 0 for the server and the external payers
+type PaymentEvent struct {
+	Id        uint64         `json:"id" gorm:"primarykey"`
+	PaymentId uint64         `json:"paymentId" gorm:"index"`
+	ActorId   uint64         `json:"actorId"`
+	ActorName string         `json:"actorName"`
+	Action    PaymentAction  `json:"action"`
+	Changes   PaymentChanges `json:"changes" gorm:"type:jsonb"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// NewPaymentEvent returns the event of the action of the actor on the payment with the fields changed
+// since the snapshot. A created payment has no snapshot, every field of its event is a change from no value
+// so the payment of any event can be rebuilt from the history
+func NewPaymentEvent(before PaymentSnapshot, after Payment, actorId uint64, action PaymentAction) PaymentEvent {
+	return PaymentEvent{
+		PaymentId: after.Id,
+		ActorId:   actorId,
+		ActorName: after.ParticipantName(actorId),
+		Action:    action,
+		Changes:   before.Diff(NewPaymentSnapshot(after)),
+	}
+}
+
+// ParticipantName returns the name of the user as the sender, the receiver or an approver of the payment
+func (p Payment) ParticipantName(userId uint64) string {
+	switch {
+	case userId == 0:
+		return ""
+	case userId == p.SenderId:
+		return p.SenderName
+	case userId == p.ReceiverId:
+		return p.ReceiverName
+	}
+	for _, approver := range p.Approvers {
+		if approver.ApproverId == userId {
+			return approver.ApproverName
+		}
+	}
+	return ""
+}
+
+func (PaymentEvent) TableName() string {
+	return "payment_events"
+}
+
+// protectPaymentEvents makes the history append only in the database, the events can not be updated, deleted
+// or truncated by the server or by a sql client. The hooks of the model refuse the changes before they reach it
+func protectPaymentEvents(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`CREATE OR REPLACE FUNCTION payment_events_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'payment_events is append only, % is not allowed', TG_OP;
+			END;
+			$$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS payment_events_append_only ON payment_events`,
+			`CREATE TRIGGER payment_events_append_only BEFORE UPDATE OR DELETE ON payment_events
+			FOR EACH ROW EXECUTE FUNCTION payment_events_append_only()`,
+			`DROP TRIGGER IF EXISTS payment_events_no_truncate ON payment_events`,
+			`CREATE TRIGGER payment_events_no_truncate BEFORE TRUNCATE ON payment_events
+			FOR EACH STATEMENT EXECUTE FUNCTION payment_events_append_only()`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BeforeUpdate keeps the history append only
+func (e *PaymentEvent) BeforeUpdate(tx *gorm.DB) error {
+	return fmt.Errorf("payment event %d can not be updated", e.Id)
+}
+
+// BeforeDelete keeps the history append only
+func (e *PaymentEvent) BeforeDelete(tx *gorm.DB) error {
+	return fmt.Errorf("payment event %d can not be deleted", e.Id)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -15,9 +16,13 @@ const (
 	PaymentTypeRequest    = "request"
 	PaymentTypeReminder   = "reminder"
 	PaymentTypeBulkPayBTC = "bulk_btc"
+	PaymentTypeBulkPay    = "bulk"
 	PaymentTypeApproval   = "approval"
 )
 
+// PaymentInvoiceNumberIndex keeps the invoice numbers of a sender unique
+const PaymentInvoiceNumberIndex = "payments_sender_invoice_number_idx"
+
 type PaymentStatus int
 
 func (p PaymentStatus) String() string {
@@ -36,6 +41,12 @@ func (p PaymentStatus) String() string {
 		return "approved"
 	case PaymentStatusRejected:
 		return "rejected"
+	case PaymentStatusConfirming:
+		return "confirming"
+	case PaymentStatusPartiallyPaid:
+		return "partially paid"
+	case PaymentStatusDisputed:
+		return "disputed"
 	}
 	return "unknown"
 }
@@ -58,6 +69,16 @@ func (p *PaymentStatus) UnmarshalText(val []byte) error {
 		*p = PaymentStatusAwaitingApproval
 	case "approved":
 		*p = PaymentStatusApproved
+	case "rejected":
+		*p = PaymentStatusRejected
+	case "confirming":
+		*p = PaymentStatusConfirming
+	case "partially paid":
+		*p = PaymentStatusPartiallyPaid
+	case "disputed":
+		*p = PaymentStatusDisputed
+	default:
+		return fmt.Errorf("payment status invalid value")
 	}
 	return nil
 }
@@ -78,6 +99,12 @@ const (
 	PaymentStatusAwaitingApproval
 	PaymentStatusApproved
 	PaymentStatusRejected
+	// PaymentStatusConfirming the transaction was submitted and is waiting for the required confirmations
+	PaymentStatusConfirming
+	// PaymentStatusPartiallyPaid the confirmed transactions pay a part of the amount
+	PaymentStatusPartiallyPaid
+	// PaymentStatusDisputed the payment has an open dispute, it can not be paid until the dispute is resolved
+	PaymentStatusDisputed
 )
 
 type PaymentContact int
@@ -120,13 +147,16 @@ const (
 )
 
 type PaymentDetail struct {
-	Quantity    float64 `json:"quantity"`
-	Price       float64 `json:"price"`
-	Cost        float64 `json:"cost"`
-	Description string  `json:"description"`
-	Date        string  `json:"date"`
-	ProjectId   uint64  `json:"projectId"`
-	ProjectName string  `json:"projectName"`
+	Type        LineType        `json:"type"`
+	Quantity    decimal.Decimal `json:"quantity"`
+	Price       decimal.Decimal `json:"price"`
+	Cost        decimal.Decimal `json:"cost"`
+	Description string          `json:"description"`
+	Date        string          `json:"date"`
+	ProjectId   uint64          `json:"projectId"`
+	ProjectName string          `json:"projectName"`
+	// TaxRate is the tax percentage of the line, the tax rate of the invoice applies when it is not set
+	TaxRate *decimal.Decimal `json:"taxRate,omitempty"`
 }
 
 type PaymentDetails []PaymentDetail
@@ -147,34 +177,49 @@ func (a *PaymentDetails) Scan(value interface{}) error {
 
 type Payment struct {
 	Id                    uint64          `gorm:"primarykey" json:"id"`
-	SenderId              uint64          `json:"senderId"`
+	SenderId              uint64          `json:"senderId" gorm:"uniqueIndex:payments_sender_invoice_number_idx,where:invoice_number <> ''"`
+	InvoiceNumber         string          `json:"invoiceNumber" gorm:"index;uniqueIndex:payments_sender_invoice_number_idx,where:invoice_number <> ''"` // assigned in the numbering scheme of the sender when the payment is sent
 	SenderName            string          `json:"senderName"`
 	SenderDisplayName     string          `json:"senderDisplayName"`
 	ReceiverId            uint64          `json:"receiverId"`
 	ReceiverName          string          `json:"receiverName"`
 	ReceiverDisplayName   string          `json:"receiverDisplayName"`
 	ExternalEmail         string          `json:"externalEmail"`
-	Amount                float64         `json:"amount"`
+	Amount                decimal.Decimal `json:"amount" gorm:"type:numeric"`
+	Subtotal              decimal.Decimal `json:"subtotal" gorm:"type:numeric;default:0"`
+	Discount              decimal.Decimal `json:"discount" gorm:"type:numeric;default:0"`
+	TaxRate               decimal.Decimal `json:"taxRate" gorm:"type:numeric;default:0"`
+	TaxAmount             decimal.Decimal `json:"taxAmount" gorm:"type:numeric;default:0"`
+	TaxLines              TaxLines        `json:"taxLines" gorm:"type:jsonb"`
+	Currency              utils.Currency  `json:"currency" gorm:"default:USD"`
+	PaidAmount            decimal.Decimal `json:"paidAmount" gorm:"type:numeric;default:0"`
 	Description           string          `json:"description"`
 	PaymentType           utils.Type      `json:"paymentType"`
 	PaymentCode           string          `json:"paymentCode"`
-	HourlyRate            float64         `json:"hourlyRate"`
+	HourlyRate            decimal.Decimal `json:"hourlyRate" gorm:"type:numeric"`
 	PaymentSettings       PaymentSettings `json:"paymentSettings" gorm:"type:jsonb"`
 	Approvers             Approvers       `json:"approvers" gorm:"type:jsonb"`
 	Details               PaymentDetails  `json:"details" gorm:"type:jsonb"`
-	ConvertRate           float64         `json:"convertRate"`
+	ConvertRate           decimal.Decimal `json:"convertRate" gorm:"type:numeric"`
 	ConvertTime           time.Time       `json:"convertTime"`
-	ExpectedAmount        float64         `json:"expectedAmount"`
+	ExpectedAmount        decimal.Decimal `json:"expectedAmount" gorm:"type:numeric"`
 	TxId                  string          `json:"txId"`
+	TxVerified            bool            `json:"txVerified"`
+	Confirmations         int64           `json:"confirmations"`
+	TxFlagged             bool            `json:"txFlagged"`
+	TxFlagReason          string          `json:"txFlagReason"`
 	Status                PaymentStatus   `json:"status"`
 	PaymentMethod         utils.Method    `json:"paymentMethod"`
 	PaymentAddress        string          `json:"paymentAddress"`
+	PaymentNetwork        utils.Network   `json:"paymentNetwork"`
 	ContactMethod         PaymentContact  `json:"contactMethod"`
 	RejectionReason       string          `json:"rejectionReason"`
 	CreatedAt             time.Time       `json:"createdAt"`
 	UpdatedAt             time.Time       `json:"updatedAt"`
+	Version               int64           `json:"version" gorm:"not null;default:1"`
 	SentAt                time.Time       `json:"sentAt"`
 	PaidAt                time.Time       `json:"paidAt"`
+	ConfirmingAt          time.Time       `json:"confirmingAt"`
 	ReceiptImg            string          `json:"receiptImg"`
 	ShowDraftRecipient    bool            `json:"showDraftRecipient"`
 	ShowDateOnInvoiceLine bool            `json:"showDateOnInvoiceLine"`
@@ -184,6 +229,20 @@ type Payment struct {
 	StartDate             time.Time       `json:"startDate"`
 	UserPaymentMethodId   *uint64         `json:"userPaymentMethodId"`
 	PaymentUrl            string          `json:"paymentUrl" gorm:"-"`
+
+	// CreditNoteOf is the paid payment the credit note corrects, the amount of a credit note is negative.
+	// The sender refunds the receiver to RefundAddress with RefundTxId when the credit is not kept
+	CreditNoteOf  uint64 `json:"creditNoteOf" gorm:"index"`
+	CreditReason  string `json:"creditReason"`
+	RefundAddress string `json:"refundAddress"`
+	RefundTxId    string `json:"refundTxId"`
+
+	// Transactions are loaded with the payment details, they are not a column
+	Transactions []PaymentTransaction `json:"transactions,omitempty" gorm:"-"`
+}
+
+func (p Payment) IsCreditNote() bool {
+	return p.CreditNoteOf > 0
 }
 
 type PaymentFilter struct {
@@ -198,7 +257,11 @@ type PaymentFilter struct {
 	ContactMethods []PaymentContact `schema:"contactMethods"`
 	UserIds        []uint64         `schema:"userIds"`
 	PaymentCode    string           `schema:"paymentCode"`
-	Approvers      []ApproverSettings
+	InvoiceNumber  string           `schema:"invoiceNumber"`
+	// Coin and Network select the payments to pay in bulk with the bulk request type
+	Coin      utils.Method  `schema:"coin"`
+	Network   utils.Network `schema:"network"`
+	Approvers []ApproverSettings
 }
 
 func (f *PaymentFilter) selectFields(db *gorm.DB) *gorm.DB {
@@ -230,6 +293,9 @@ func (f *PaymentFilter) BindCount(db *gorm.DB) *gorm.DB {
 	if len(f.ContactMethods) > 0 {
 		db = db.Where("contact_method IN ?", f.ContactMethods)
 	}
+	if len(f.InvoiceNumber) > 0 {
+		db = db.Where("invoice_number ILIKE ?", "%"+utils.EscapeLike(f.InvoiceNumber)+"%")
+	}
 
 	if f.RequestType == PaymentTypeReminder && len(f.Approvers) > 0 {
 		for _, setting := range f.Approvers {
@@ -256,15 +322,16 @@ func (f *PaymentFilter) BindFirst(db *gorm.DB) *gorm.DB {
 
 func (f *PaymentFilter) Sortable() map[string]bool {
 	return map[string]bool{
-		"createdAt":    true,
-		"updatedAt":    true,
-		"paidAt":       true,
-		"status":       true,
-		"amount":       true,
-		"sentAt":       true,
-		"startDate":    true,
-		"receiverName": true,
-		"senderName":   true,
-		"projectName":  true,
+		"createdAt":     true,
+		"updatedAt":     true,
+		"paidAt":        true,
+		"status":        true,
+		"amount":        true,
+		"sentAt":        true,
+		"startDate":     true,
+		"receiverName":  true,
+		"senderName":    true,
+		"projectName":   true,
+		"invoiceNumber": true,
 	}
 }
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+// PaymentRole is the part the user changing the status plays in the payment
+type PaymentRole int
+
+const (
+	PaymentRoleSender PaymentRole = iota
+	// PaymentRoleReceiver the receiver of the payment, or the external receiver with the token of the payment
+	PaymentRoleReceiver
+	PaymentRoleApprover
+	PaymentRoleAdmin
+	// PaymentRoleSystem the server, which computes the status of the payment from its transactions
+	PaymentRoleSystem
+)
+
+func (r PaymentRole) String() string {
+	switch r {
+	case PaymentRoleSender:
+		return "sender"
+	case PaymentRoleReceiver:
+		return "receiver"
+	case PaymentRoleApprover:
+		return "approver"
+	case PaymentRoleAdmin:
+		return "admin"
+	case PaymentRoleSystem:
+		return "server"
+	}
+	return "unknown"
+}
+
+type paymentTransitions map[PaymentRole]map[PaymentStatus][]PaymentStatus
+
+// invoiceTransitions are the statuses each role can move an invoice to from its status.
+// Keeping the status is not a transition, it is always allowed
+var invoiceTransitions = paymentTransitions{
+	PaymentRoleSender: {
+		// the sender edits the invoice, it goes back to sent for the approvers, or saves it as draft
+		PaymentStatusCreated:   {PaymentStatusSent},
+		PaymentStatusSent:      {PaymentStatusCreated},
+		PaymentStatusConfirmed: {PaymentStatusSent, PaymentStatusCreated},
+		PaymentStatusRejected:  {PaymentStatusSent, PaymentStatusCreated},
+		// the sender withdraws the disputed invoice
+		PaymentStatusDisputed: {PaymentStatusRejected},
+	},
+	PaymentRoleReceiver: {
+		PaymentStatusSent:      {PaymentStatusConfirmed, PaymentStatusRejected, PaymentStatusDisputed},
+		PaymentStatusConfirmed: {PaymentStatusSent, PaymentStatusRejected, PaymentStatusDisputed},
+		PaymentStatusRejected:  {PaymentStatusSent, PaymentStatusConfirmed},
+		// the receiver accepts the disputed invoice
+		PaymentStatusDisputed: {PaymentStatusSent, PaymentStatusConfirmed},
+	},
+	PaymentRoleApprover: {
+		PaymentStatusSent:      {PaymentStatusDisputed},
+		PaymentStatusConfirmed: {PaymentStatusDisputed},
+		// the approver accepts the invoice it disputed
+		PaymentStatusDisputed: {PaymentStatusSent, PaymentStatusConfirmed},
+	},
+	PaymentRoleAdmin: {
+		PaymentStatusCreated:   {PaymentStatusRejected},
+		PaymentStatusSent:      {PaymentStatusRejected},
+		PaymentStatusConfirmed: {PaymentStatusRejected},
+		PaymentStatusDisputed:  {PaymentStatusRejected},
+	},
+	PaymentRoleSystem: {
+		// a rejected invoice can still be paid by the receiver
+		PaymentStatusSent:      {PaymentStatusConfirming, PaymentStatusPartiallyPaid, PaymentStatusPaid},
+		PaymentStatusConfirmed: {PaymentStatusConfirming, PaymentStatusPartiallyPaid, PaymentStatusPaid},
+		PaymentStatusRejected:  {PaymentStatusConfirming, PaymentStatusPartiallyPaid, PaymentStatusPaid},
+		// the payment goes back to the status it was paid from when its transactions are flagged
+		PaymentStatusConfirming:    {PaymentStatusSent, PaymentStatusConfirmed, PaymentStatusRejected, PaymentStatusPartiallyPaid, PaymentStatusPaid},
+		PaymentStatusPartiallyPaid: {PaymentStatusConfirming, PaymentStatusPaid},
+	},
+}
+
+// creditNoteTransitions are the statuses each role can move a credit note to from its status,
+// the sender settles the approved credit note
+var creditNoteTransitions = paymentTransitions{
+	PaymentRoleSender: {
+		PaymentStatusCreated:   {PaymentStatusSent},
+		PaymentStatusSent:      {PaymentStatusPaid},
+		PaymentStatusConfirmed: {PaymentStatusPaid},
+	},
+	PaymentRoleReceiver: {
+		PaymentStatusSent:      {PaymentStatusConfirmed, PaymentStatusRejected},
+		PaymentStatusConfirmed: {PaymentStatusRejected},
+	},
+	PaymentRoleAdmin: {
+		PaymentStatusCreated:   {PaymentStatusRejected},
+		PaymentStatusSent:      {PaymentStatusRejected},
+		PaymentStatusConfirmed: {PaymentStatusRejected},
+	},
+}
+
+// CheckPaymentTransition returns an error when the role can not move an invoice, or a credit note, from a status to another
+func CheckPaymentTransition(from, to PaymentStatus, role PaymentRole, creditNote bool) error {
+	if from == to {
+		return nil
+	}
+	transitions := invoiceTransitions
+	if creditNote {
+		transitions = creditNoteTransitions
+	}
+	if slices.Contains(transitions[role][from], to) {
+		return nil
+	}
+	return utils.NewError(fmt.Errorf("the %s can not move a %s payment to %s", role, from, to), utils.ErrorInvalidTransition)
+}
+
+// CheckTransition returns an error when the role can not move the payment from its status to the status
+func (p Payment) CheckTransition(to PaymentStatus, role PaymentRole) error {
+	return CheckPaymentTransition(p.Status, to, role, p.IsCreditNote())
+}
+
+// senderLockedStatuses are the statuses of an invoice being paid or paid, the sender can not edit it anymore
+var senderLockedStatuses = []PaymentStatus{PaymentStatusConfirming, PaymentStatusPartiallyPaid, PaymentStatusPaid}
+
+// CheckSenderEdit returns an error when the sender can not edit the content of the payment in its status
+func (p Payment) CheckSenderEdit() error {
+	if slices.Contains(senderLockedStatuses, p.Status) {
+		return utils.NewError(fmt.Errorf("the sender can not edit a %s payment", p.Status), utils.ErrorInvalidTransition)
+	}
+	return nil
+}
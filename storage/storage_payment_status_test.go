@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+func TestCheckPaymentTransition(t *testing.T) {
+	tests := []struct {
+		role       PaymentRole
+		from       PaymentStatus
+		to         PaymentStatus
+		creditNote bool
+		allowed    bool
+	}{
+		{role: PaymentRoleSender, from: PaymentStatusCreated, to: PaymentStatusSent, allowed: true},
+		{role: PaymentRoleSender, from: PaymentStatusRejected, to: PaymentStatusSent, allowed: true},
+		{role: PaymentRoleSender, from: PaymentStatusDisputed, to: PaymentStatusRejected, allowed: true},
+		{role: PaymentRoleSender, from: PaymentStatusSent, to: PaymentStatusConfirmed},
+		{role: PaymentRoleSender, from: PaymentStatusSent, to: PaymentStatusPaid},
+		{role: PaymentRoleSender, from: PaymentStatusPaid, to: PaymentStatusSent},
+		{role: PaymentRoleSender, from: PaymentStatusConfirming, to: PaymentStatusCreated},
+		{role: PaymentRoleSender, from: PaymentStatusAwaitingApproval, to: PaymentStatusSent},
+
+		{role: PaymentRoleReceiver, from: PaymentStatusSent, to: PaymentStatusConfirmed, allowed: true},
+		{role: PaymentRoleReceiver, from: PaymentStatusSent, to: PaymentStatusDisputed, allowed: true},
+		{role: PaymentRoleReceiver, from: PaymentStatusRejected, to: PaymentStatusConfirmed, allowed: true},
+		{role: PaymentRoleReceiver, from: PaymentStatusCreated, to: PaymentStatusConfirmed},
+		{role: PaymentRoleReceiver, from: PaymentStatusSent, to: PaymentStatusPaid},
+		{role: PaymentRoleReceiver, from: PaymentStatusPaid, to: PaymentStatusRejected},
+
+		{role: PaymentRoleApprover, from: PaymentStatusSent, to: PaymentStatusDisputed, allowed: true},
+		{role: PaymentRoleApprover, from: PaymentStatusDisputed, to: PaymentStatusConfirmed, allowed: true},
+		{role: PaymentRoleApprover, from: PaymentStatusSent, to: PaymentStatusConfirmed},
+		{role: PaymentRoleApprover, from: PaymentStatusSent, to: PaymentStatusRejected},
+
+		{role: PaymentRoleAdmin, from: PaymentStatusSent, to: PaymentStatusRejected, allowed: true},
+		{role: PaymentRoleAdmin, from: PaymentStatusDisputed, to: PaymentStatusRejected, allowed: true},
+		{role: PaymentRoleAdmin, from: PaymentStatusPaid, to: PaymentStatusRejected},
+		{role: PaymentRoleAdmin, from: PaymentStatusSent, to: PaymentStatusPaid},
+		{role: PaymentRoleAdmin, from: PaymentStatusApproved, to: PaymentStatusRejected},
+
+		{role: PaymentRoleSystem, from: PaymentStatusSent, to: PaymentStatusPaid, allowed: true},
+		{role: PaymentRoleSystem, from: PaymentStatusRejected, to: PaymentStatusConfirming, allowed: true},
+		{role: PaymentRoleSystem, from: PaymentStatusPartiallyPaid, to: PaymentStatusPaid, allowed: true},
+		{role: PaymentRoleSystem, from: PaymentStatusConfirming, to: PaymentStatusConfirmed, allowed: true},
+		{role: PaymentRoleSystem, from: PaymentStatusCreated, to: PaymentStatusPaid},
+		{role: PaymentRoleSystem, from: PaymentStatusPaid, to: PaymentStatusSent},
+		{role: PaymentRoleSystem, from: PaymentStatusDisputed, to: PaymentStatusPaid},
+
+		{role: PaymentRoleSender, from: PaymentStatusSent, to: PaymentStatusPaid, creditNote: true, allowed: true},
+		{role: PaymentRoleSender, from: PaymentStatusSent, to: PaymentStatusCreated, creditNote: true},
+		{role: PaymentRoleReceiver, from: PaymentStatusSent, to: PaymentStatusConfirmed, creditNote: true, allowed: true},
+		{role: PaymentRoleReceiver, from: PaymentStatusSent, to: PaymentStatusDisputed, creditNote: true},
+		{role: PaymentRoleSystem, from: PaymentStatusSent, to: PaymentStatusPaid, creditNote: true},
+
+		{role: PaymentRoleReceiver, from: PaymentStatusPaid, to: PaymentStatusPaid, allowed: true},
+	}
+	for _, test := range tests {
+		err := CheckPaymentTransition(test.from, test.to, test.role, test.creditNote)
+		if test.allowed {
+			if err != nil {
+				t.Errorf("%s %s to %s (credit note %v): %v", test.role, test.from, test.to, test.creditNote, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s %s to %s (credit note %v): expected an error", test.role, test.from, test.to, test.creditNote)
+			continue
+		}
+		if e, ok := err.(*utils.Error); !ok || e.Code != utils.ErrorInvalidTransition {
+			t.Errorf("%s %s to %s: error %v, expected an invalid transition", test.role, test.from, test.to, err)
+		}
+	}
+}
+
+func TestCheckSenderEdit(t *testing.T) {
+	tests := []struct {
+		status   PaymentStatus
+		editable bool
+	}{
+		{status: PaymentStatusCreated, editable: true},
+		{status: PaymentStatusSent, editable: true},
+		{status: PaymentStatusConfirmed, editable: true},
+		{status: PaymentStatusRejected, editable: true},
+		{status: PaymentStatusConfirming},
+		{status: PaymentStatusPartiallyPaid},
+		{status: PaymentStatusPaid},
+	}
+	for _, test := range tests {
+		err := Payment{Status: test.status}.CheckSenderEdit()
+		if test.editable && err != nil {
+			t.Errorf("%s: %v", test.status, err)
+		}
+		if !test.editable && err == nil {
+			t.Errorf("%s: expected the sender edit to be refused", test.status)
+		}
+	}
+}
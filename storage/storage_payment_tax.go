@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+// LineType is the kind of an invoice line, the lines without type are labor
+type LineType string
+
+const (
+	LineTypeLabor   LineType = "labor"
+	LineTypeExpense LineType = "expense"
+	LineTypeFee     LineType = "fee"
+)
+
+func (t LineType) IsValid() bool {
+	switch t {
+	case "", LineTypeLabor, LineTypeExpense, LineTypeFee:
+		return true
+	}
+	return false
+}
+
+// IsLabor returns true when the line is paid at the hourly rate of the invoice when it has no price
+func (t LineType) IsLabor() bool {
+	return t == "" || t == LineTypeLabor
+}
+
+// TaxLine is the tax of the invoice lines at the same rate. Base is the cost of the lines
+// less their share of the invoice discount, a negative rate withholds the tax from the amount
+type TaxLine struct {
+	Rate decimal.Decimal `json:"rate"`
+	Base decimal.Decimal `json:"base"`
+	Tax  decimal.Decimal `json:"tax"`
+}
+
+type TaxLines []TaxLine
+
+// Value Marshal
+func (a TaxLines) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan Unmarshal
+func (a *TaxLines) Scan(value interface{}) error {
+	if value == nil {
+		// the invoices saved before the taxes have no tax lines
+		*a = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, &a)
+}
+
+// NetAmount returns the amount of the invoice before the tax and the discount.
+// The invoices saved before the taxes have no subtotal, their amount has no tax
+func (p Payment) NetAmount() decimal.Decimal {
+	if p.Subtotal.IsZero() {
+		return p.Amount
+	}
+	return p.Subtotal
+}
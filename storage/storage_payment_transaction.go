@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+type TransactionStatus int
+
+func (p TransactionStatus) String() string {
+	switch p {
+	case TransactionStatusConfirming:
+		return "confirming"
+	case TransactionStatusConfirmed:
+		return "confirmed"
+	case TransactionStatusFlagged:
+		return "flagged"
+	}
+	return "unknown"
+}
+
+func (p TransactionStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+const (
+	// TransactionStatusConfirming the transaction is waiting for the required confirmations
+	TransactionStatusConfirming TransactionStatus = iota
+	TransactionStatusConfirmed
+	// TransactionStatusFlagged the transaction could not be verified, it does not count in the paid amount
+	TransactionStatusFlagged
+)
+
+// PaymentTransaction is a transaction paying a part or the rest of a payment.
+// A payment can be paid with several transactions in different coins, each at its own rate
+type PaymentTransaction struct {
+	Id        uint64 `gorm:"primarykey" json:"id"`
+	PaymentId uint64 `json:"paymentId" gorm:"index"`
+	QuoteId   uint64 `json:"quoteId"`
+	// BulkQuoteId is the bulk quote of the transaction paying several payments, they may share an address
+	BulkQuoteId    uint64        `json:"bulkQuoteId"`
+	PaymentMethod  utils.Method  `json:"paymentMethod"`
+	PaymentNetwork utils.Network `json:"paymentNetwork"`
+	PaymentAddress string        `json:"paymentAddress"`
+	TxId           string        `json:"txId"`
+	// Amount is the part of the payment amount paid by the transaction, in the currency of the payment
+	Amount      decimal.Decimal `json:"amount" gorm:"type:numeric"`
+	ConvertRate decimal.Decimal `json:"convertRate" gorm:"type:numeric"`
+	ConvertTime time.Time       `json:"convertTime"`
+	// ExpectedAmount is the amount of the coin the transaction must send
+	ExpectedAmount decimal.Decimal   `json:"expectedAmount" gorm:"type:numeric"`
+	Status         TransactionStatus `json:"status" gorm:"index"`
+	TxVerified     bool              `json:"txVerified"`
+	Confirmations  int64             `json:"confirmations"`
+	FlagReason     string            `json:"flagReason"`
+	ConfirmingAt   time.Time         `json:"confirmingAt"`
+	PaidAt         time.Time         `json:"paidAt"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+func (PaymentTransaction) TableName() string {
+	return "payment_transactions"
+}
+
+// PaymentTransactionTxIndex is the unique index paying an output of a transaction once
+const PaymentTransactionTxIndex = "payment_transactions_tx_idx"
+
+// uniquePaymentTransactions allows a transaction to an address to pay one payment, unless the flagged ones.
+// The payments of a bulk transaction sharing an address are paid by the same outputs, they are told apart by their id
+func uniquePaymentTransactions(db *gorm.DB) error {
+	return db.Exec(fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s ON payment_transactions
+		(payment_method, payment_network, tx_id, payment_address, bulk_quote_id, (CASE WHEN bulk_quote_id = 0 THEN 0 ELSE payment_id END))
+		WHERE tx_id <> '' AND status <> %d`, PaymentTransactionTxIndex, TransactionStatusFlagged)).Error
+}
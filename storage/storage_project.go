@@ -23,6 +23,7 @@ type Project struct {
 	Status      ProjectStatus `json:"status"`
 	CreatedAt   time.Time     `json:"createdAt"`
 	UpdatedAt   time.Time     `json:"updatedAt"`
+	Version     int64         `json:"version" gorm:"not null;default:1"`
 }
 
 type Members []Member
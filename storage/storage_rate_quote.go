@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+// RateQuote is a rate locked by the server for a payment. The rate is in the currency
+// of the payment and the payer pays the ExpectedAmount of the quote until it expires
+type RateQuote struct {
+	Id             uint64          `json:"id" gorm:"primarykey"`
+	PaymentId      uint64          `json:"paymentId" gorm:"index"`
+	Exchange       string          `json:"exchange"`
+	Coin           utils.Method    `json:"coin"`
+	Amount         decimal.Decimal `json:"amount" gorm:"type:numeric"`
+	Currency       utils.Currency  `json:"currency" gorm:"default:USD"`
+	Rate           decimal.Decimal `json:"rate" gorm:"type:numeric"`
+	ExpectedAmount decimal.Decimal `json:"expectedAmount" gorm:"type:numeric"`
+	ExpiresAt      time.Time       `json:"expiresAt"`
+	UsedAt         *time.Time      `json:"usedAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+// IsExpired returns true when the quote can not be used anymore
+func (q *RateQuote) IsExpired() bool {
+	return time.Now().After(q.ExpiresAt)
+}
+
+func (RateQuote) TableName() string {
+	return "rate_quotes"
+}
+
+// BulkRateQuote is a USD rate of the coin locked by the server for the user paying payments in bulk.
+// The rate is converted to the currency of each payment and the quote pays one bulk transaction
+type BulkRateQuote struct {
+	Id        uint64          `json:"id" gorm:"primarykey"`
+	UserId    uint64          `json:"userId" gorm:"index"`
+	Coin      utils.Method    `json:"coin"`
+	Rate      decimal.Decimal `json:"rate" gorm:"type:numeric"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+	UsedAt    *time.Time      `json:"usedAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// IsExpired returns true when the quote can not be used anymore
+func (q *BulkRateQuote) IsExpired() bool {
+	return time.Now().After(q.ExpiresAt)
+}
+
+func (BulkRateQuote) TableName() string {
+	return "bulk_rate_quotes"
+}
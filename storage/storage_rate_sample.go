@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+// RateSampleReference is the exchange name of the samples of the median rate over the exchanges
+const RateSampleReference = "median"
+
+// RateSample is the rate of a coin on an exchange sampled by the price polling loop
+type RateSample struct {
+	Id        uint64       `json:"id" gorm:"primarykey"`
+	Coin      utils.Method `json:"coin" gorm:"index:idx_rate_sample_lookup,priority:1"`
+	Exchange  string       `json:"exchange" gorm:"index:idx_rate_sample_lookup,priority:2"`
+	Rate      float64      `json:"rate"`
+	SampledAt time.Time    `json:"sampledAt" gorm:"index:idx_rate_sample_lookup,priority:3"`
+	// Downsampled is set on the hourly averages replacing the samples older than the raw retention
+	Downsampled bool `json:"downsampled" gorm:"not null;default:false"`
+}
+
+func (RateSample) TableName() string {
+	return "rate_samples"
+}
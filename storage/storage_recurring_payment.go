@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type RecurrenceFrequency string
+
+const (
+	RecurrenceWeekly  RecurrenceFrequency = "weekly"
+	RecurrenceMonthly RecurrenceFrequency = "monthly"
+	// RecurrenceCustom repeats every Interval days
+	RecurrenceCustom RecurrenceFrequency = "custom"
+)
+
+func (f RecurrenceFrequency) IsValid() bool {
+	switch f {
+	case RecurrenceWeekly, RecurrenceMonthly, RecurrenceCustom:
+		return true
+	}
+	return false
+}
+
+type RecurringStatus int
+
+func (p RecurringStatus) String() string {
+	switch p {
+	case RecurringStatusActive:
+		return "active"
+	case RecurringStatusPaused:
+		return "paused"
+	case RecurringStatusEnded:
+		return "ended"
+	}
+	return "unknown"
+}
+
+func (p RecurringStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *RecurringStatus) UnmarshalText(val []byte) error {
+	switch string(val) {
+	case "active":
+		*p = RecurringStatusActive
+	case "paused":
+		*p = RecurringStatusPaused
+	case "ended":
+		*p = RecurringStatusEnded
+	default:
+		return fmt.Errorf("recurring status invalid value")
+	}
+	return nil
+}
+
+func (p *RecurringStatus) UnmarshalJSON(v []byte) error {
+	var val string
+	if err := json.Unmarshal(v, &val); err != nil {
+		return err
+	}
+	return p.UnmarshalText([]byte(val))
+}
+
+const (
+	RecurringStatusActive RecurringStatus = iota
+	RecurringStatusPaused
+	// RecurringStatusEnded the end date of the schedule is over
+	RecurringStatusEnded
+)
+
+// RecurringPayment creates a copy of the template payment (receiver, details, payment settings, project)
+// at every occurrence of the recurrence rule
+type RecurringPayment struct {
+	Id         uint64              `gorm:"primarykey" json:"id"`
+	UserId     uint64              `json:"userId" gorm:"index"`
+	TemplateId uint64              `json:"templateId"`
+	Name       string              `json:"name"`
+	Frequency  RecurrenceFrequency `json:"frequency"`
+	// Interval is the number of weeks, months or days (custom) between two occurrences
+	Interval int `json:"interval"`
+	// AutoSend sends the created payments to the receiver, they are saved as draft otherwise
+	AutoSend bool            `json:"autoSend"`
+	Status   RecurringStatus `json:"status" gorm:"index"`
+	StartAt  time.Time       `json:"startAt"`
+	EndDate  *time.Time      `json:"endDate"`
+	// Sequence is the index of the occurrence at NextRunAt, the occurrences missed while the schedule was paused are skipped
+	Sequence      int        `json:"sequence"`
+	NextRunAt     time.Time  `json:"nextRunAt" gorm:"index"`
+	RunCount      int        `json:"runCount"`
+	LastRunAt     *time.Time `json:"lastRunAt"`
+	LastPaymentId uint64     `json:"lastPaymentId"`
+	LastError     string     `json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// Shift moves the time by n periods of the recurrence rule.
+// A monthly occurrence is kept on the last day of the month when the month is shorter
+func (r *RecurringPayment) Shift(t time.Time, n int) time.Time {
+	switch r.Frequency {
+	case RecurrenceWeekly:
+		return t.AddDate(0, 0, 7*r.Interval*n)
+	case RecurrenceMonthly:
+		months := r.Interval * n
+		firstOfMonth := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		target := firstOfMonth.AddDate(0, months, 0)
+		lastDay := target.AddDate(0, 1, -1).Day()
+		day := t.Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		return target.AddDate(0, 0, day-1)
+	default:
+		return t.AddDate(0, 0, r.Interval*n)
+	}
+}
+
+// Occurrence returns the time of the nth occurrence, the first one is at StartAt
+func (r *RecurringPayment) Occurrence(n int) time.Time {
+	return r.Shift(r.StartAt, n)
+}
+
+// FirstSequenceFrom returns the index of the first occurrence not before the time
+func (r *RecurringPayment) FirstSequenceFrom(t time.Time, from int) int {
+	n := from
+	for r.Occurrence(n).Before(t) {
+		n++
+	}
+	return n
+}
+
+// IsOver returns true when the occurrence is after the end date
+func (r *RecurringPayment) IsOver(at time.Time) bool {
+	return r.EndDate != nil && at.After(*r.EndDate)
+}
+
+func (RecurringPayment) TableName() string {
+	return "recurring_payments"
+}
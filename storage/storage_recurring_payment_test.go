@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurringOccurrence(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name       string
+		recurring  RecurringPayment
+		sequence   int
+		occurrence time.Time
+	}{
+		{name: "first occurrence at start", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: date(2024, time.January, 15)}, sequence: 0, occurrence: date(2024, time.January, 15)},
+		{name: "weekly", recurring: RecurringPayment{Frequency: RecurrenceWeekly, Interval: 2, StartAt: date(2024, time.January, 1)}, sequence: 3, occurrence: date(2024, time.February, 12)},
+		{name: "custom days", recurring: RecurringPayment{Frequency: RecurrenceCustom, Interval: 10, StartAt: date(2024, time.January, 25)}, sequence: 1, occurrence: date(2024, time.February, 4)},
+		{name: "monthly jan 31 to leap feb", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: date(2024, time.January, 31)}, sequence: 1, occurrence: date(2024, time.February, 29)},
+		{name: "monthly jan 31 to feb", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: date(2023, time.January, 31)}, sequence: 1, occurrence: date(2023, time.February, 28)},
+		{name: "monthly jan 31 back to mar 31", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: date(2023, time.January, 31)}, sequence: 2, occurrence: date(2023, time.March, 31)},
+		{name: "monthly jan 31 to apr 30", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: date(2023, time.January, 31)}, sequence: 3, occurrence: date(2023, time.April, 30)},
+		{name: "quarterly over the year", recurring: RecurringPayment{Frequency: RecurrenceMonthly, Interval: 3, StartAt: date(2023, time.November, 30)}, sequence: 1, occurrence: date(2024, time.February, 29)},
+	}
+	for _, test := range tests {
+		if occurrence := test.recurring.Occurrence(test.sequence); !occurrence.Equal(test.occurrence) {
+			t.Errorf("%s: occurrence %d is %s, expected %s", test.name, test.sequence, occurrence, test.occurrence)
+		}
+	}
+}
+
+func TestRecurringFirstSequenceFrom(t *testing.T) {
+	monthly := RecurringPayment{Frequency: RecurrenceMonthly, Interval: 1, StartAt: time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name     string
+		at       time.Time
+		from     int
+		sequence int
+	}{
+		{name: "before the start", at: time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC), from: 0, sequence: 0},
+		{name: "at the start", at: monthly.StartAt, from: 0, sequence: 0},
+		{name: "after the start", at: monthly.StartAt.Add(time.Second), from: 0, sequence: 1},
+		{name: "at the short month end", at: time.Date(2023, time.February, 28, 0, 0, 0, 0, time.UTC), from: 0, sequence: 1},
+		{name: "after the short month end", at: time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC), from: 0, sequence: 2},
+		{name: "missed occurrences are skipped", at: time.Date(2023, time.June, 15, 0, 0, 0, 0, time.UTC), from: 1, sequence: 5},
+		{name: "not before the from sequence", at: monthly.StartAt, from: 3, sequence: 3},
+	}
+	for _, test := range tests {
+		if sequence := monthly.FirstSequenceFrom(test.at, test.from); sequence != test.sequence {
+			t.Errorf("%s: sequence %d, expected %d", test.name, sequence, test.sequence)
+		}
+	}
+}
@@ -8,14 +8,27 @@ import (
 
 // UserPaymentMethod represents a user's payment method
 type UserPaymentMethod struct {
-	Id        uint64    `json:"id" gorm:"primarykey"`
-	UserId    uint64    `json:"userId" gorm:"index"`
-	Label     string    `json:"label"`
-	Coin      string    `json:"coin"`
-	Network   string    `json:"network"` // Stores network code (e.g., "btc", "erc20")
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	Id          uint64    `json:"id" gorm:"primarykey"`
+	UserId      uint64    `json:"userId" gorm:"index"`
+	Label       string    `json:"label"`
+	Coin        string    `json:"coin"`
+	Network     string    `json:"network"` // Stores network code (e.g., "btc", "erc20")
+	Address     string    `json:"address"`
+	ExtendedKey string    `json:"extendedKey"` // Watch-only extended public key, a new address is derived for each payment
+	NextIndex   uint32    `json:"nextIndex"`   // Derivation index of the next address derived from ExtendedKey
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// DerivedAddress is an address derived from the extended key of a payment method for a payment
+type DerivedAddress struct {
+	Id                  uint64    `json:"id" gorm:"primarykey"`
+	UserPaymentMethodId uint64    `json:"userPaymentMethodId" gorm:"uniqueIndex:idx_derived_address_index"`
+	DerivationIndex     uint32    `json:"derivationIndex" gorm:"uniqueIndex:idx_derived_address_index"`
+	Address             string    `json:"address" gorm:"index"`
+	PaymentId           uint64    `json:"paymentId" gorm:"index"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
 }
 
 // GetNetworkInfo returns the network information with both code and display name
@@ -24,6 +37,15 @@ func (upm *UserPaymentMethod) GetNetworkInfo() utils.NetworkInfo {
 	return network.Info()
 }
 
+// IsExtendedKey returns true when the addresses of the payment method are derived from an extended key
+func (upm *UserPaymentMethod) IsExtendedKey() bool {
+	return len(upm.ExtendedKey) > 0
+}
+
 func (UserPaymentMethod) TableName() string {
 	return "user_payment_methods"
 }
+
+func (DerivedAddress) TableName() string {
+	return "derived_addresses"
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"gorm.io/gorm"
+)
+
+// NextVersion moves the rows updated by column to their next version, so the users who loaded them
+// before can not save them back
+var NextVersion = gorm.Expr("version + 1")
+
+// Versioned is a model updated with optimistic concurrency, its version is incremented on every update
+type Versioned interface {
+	CurrentVersion() int64
+	SetVersion(version int64)
+}
+
+func (p *Payment) CurrentVersion() int64 {
+	return p.Version
+}
+
+func (p *Payment) SetVersion(version int64) {
+	p.Version = version
+}
+
+// BeforeCreate starts the payment at the first version
+func (p *Payment) BeforeCreate(tx *gorm.DB) error {
+	if p.Version == 0 {
+		p.Version = 1
+	}
+	return nil
+}
+
+func (p *Project) CurrentVersion() int64 {
+	return p.Version
+}
+
+func (p *Project) SetVersion(version int64) {
+	p.Version = version
+}
+
+// BeforeCreate starts the project at the first version
+func (p *Project) BeforeCreate(tx *gorm.DB) error {
+	if p.Version == 0 {
+		p.Version = 1
+	}
+	return nil
+}
+
+// CheckVersion returns the conflict error when the client sent a version that is not the current version
+// of the model. The version is 0 when the client did not send one
+func CheckVersion(model Versioned, version int64) error {
+	if version > 0 && version != model.CurrentVersion() {
+		return utils.VersionConflictError
+	}
+	return nil
+}
+
+// UpdateVersioned saves every field of the model when its row is still at the version the model was loaded
+// with, and moves it to the next version. The conflict error is returned when another update saved the row first
+func UpdateVersioned(db *gorm.DB, model Versioned) error {
+	version := model.CurrentVersion()
+	model.SetVersion(version + 1)
+	result := db.Model(model).Where("version = ?", version).Select("*").Updates(model)
+	if result.Error != nil {
+		model.SetVersion(version)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		model.SetVersion(version)
+		return utils.VersionConflictError
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Currency is the fiat currency an invoice is issued in
+type Currency string
+
+const (
+	CurrencyUSD Currency = "USD"
+	CurrencyEUR Currency = "EUR"
+	CurrencyGBP Currency = "GBP"
+	CurrencyCHF Currency = "CHF"
+)
+
+// DefaultCurrency is the currency of the invoices created before the currency was stored
+const DefaultCurrency = CurrencyUSD
+
+var supportedCurrencies = []Currency{CurrencyUSD, CurrencyEUR, CurrencyGBP, CurrencyCHF}
+
+// SupportedCurrencies returns the fiat currencies an invoice can be issued in
+func SupportedCurrencies() []Currency {
+	return supportedCurrencies
+}
+
+// IsSupported returns true when invoices can be issued in the currency
+func (c Currency) IsSupported() bool {
+	for _, currency := range supportedCurrencies {
+		if c == currency {
+			return true
+		}
+	}
+	return false
+}
+
+// OrDefault returns the default currency when the currency is not set
+func (c Currency) OrDefault() Currency {
+	if c == "" {
+		return DefaultCurrency
+	}
+	return c
+}
+
+func (c Currency) String() string {
+	return string(c.OrDefault())
+}
+
+// ParseCurrency returns the supported currency of the code
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(strings.TrimSpace(code))).OrDefault()
+	if !currency.IsSupported() {
+		return "", fmt.Errorf("currency %s is not supported", code)
+	}
+	return currency, nil
+}
+
+func (c *Currency) UnmarshalText(val []byte) error {
+	currency, err := ParseCurrency(string(val))
+	if err != nil {
+		return err
+	}
+	*c = currency
+	return nil
+}
+
+func (c *Currency) UnmarshalJSON(v []byte) error {
+	var val string
+	if err := json.Unmarshal(v, &val); err != nil {
+		return err
+	}
+	return c.UnmarshalText([]byte(val))
+}
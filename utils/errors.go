@@ -22,6 +22,10 @@ const (
 	ErrorBodyRequited      = 4004
 	ErrorBadRequest        = 4010
 	ErrorUnauthorized      = 4011
+	ErrorTxVerifyFailed    = 4012
+	ErrorRateQuoteInvalid  = 4013
+	ErrorInvalidTransition = 4014
+	ErrorVersionConflict   = 4015
 	ErrorNotFound          = 4040
 	ErrorForbidden         = 4030
 	ErrorSendMailFailed    = 5001
@@ -31,12 +35,14 @@ func (e *Error) HttpStatus() int {
 	switch e.Code {
 	case ErrorInternalCode:
 		return http.StatusInternalServerError
-	case ErrorBadRequest, ErrorObjectExist, ErrorLoginFail, ErrorInvalidCredential, ErrorBodyRequited:
+	case ErrorBadRequest, ErrorObjectExist, ErrorLoginFail, ErrorInvalidCredential, ErrorBodyRequited, ErrorTxVerifyFailed, ErrorRateQuoteInvalid:
 		return http.StatusBadRequest
 	case ErrorNotFound:
 		return http.StatusNotFound
 	case ErrorForbidden:
 		return http.StatusForbidden
+	case ErrorInvalidTransition, ErrorVersionConflict:
+		return http.StatusConflict
 	case ErrorSendMailFailed:
 		return http.StatusBadGateway
 	case ErrorUnauthorized:
@@ -61,6 +67,11 @@ var NotFoundError = &Error{
 	Code: ErrorNotFound,
 }
 
+var VersionConflictError = &Error{
+	Mess: "it was changed by someone else, please reload it and try again",
+	Code: ErrorVersionConflict,
+}
+
 var InternalError = Error{
 	Mess: "Something went wrong. please contact admin",
 	Code: ErrorInternalCode,
@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	btcChaincfg "github.com/btcsuite/btcd/chaincfg"
+	dcrChaincfg "github.com/decred/dcrd/chaincfg/v2"
+	"github.com/decred/dcrd/dcrec"
+	dcrutilv2 "github.com/decred/dcrd/dcrutil/v2"
+	dcrHdkeychain "github.com/decred/dcrd/hdkeychain/v2"
+	ltcChaincfg "github.com/ltcsuite/ltcd/chaincfg"
+	"github.com/ltcsuite/ltcd/ltcutil"
+)
+
+// AddressType is the kind of address derived from an extended public key
+type AddressType int
+
+const (
+	AddressTypeP2PKH AddressType = iota
+	AddressTypeP2SHP2WPKH
+	AddressTypeP2WPKH
+)
+
+// extendedKeyVersions maps the version bytes of the watch-only extended public keys
+// accepted for each network to the address type they derive
+var extendedKeyVersions = map[Network]map[[4]byte]AddressType{
+	NetworkBTC: {
+		{0x04, 0x88, 0xb2, 0x1e}: AddressTypeP2PKH,      // xpub
+		{0x04, 0x9d, 0x7c, 0xb2}: AddressTypeP2SHP2WPKH, // ypub
+		{0x04, 0xb2, 0x47, 0x46}: AddressTypeP2WPKH,     // zpub
+	},
+	NetworkLTC: {
+		{0x01, 0x9d, 0xa4, 0x62}: AddressTypeP2PKH,      // Ltub
+		{0x01, 0xb2, 0x6e, 0xf6}: AddressTypeP2SHP2WPKH, // Mtub
+		{0x04, 0xb2, 0x47, 0x46}: AddressTypeP2WPKH,     // zpub
+	},
+}
+
+// IsExtendedKeySupported returns true when addresses of the network can be derived from an extended public key
+func IsExtendedKeySupported(network Network) bool {
+	return network == NetworkBTC || network == NetworkLTC || network == NetworkDCR
+}
+
+// VerifyExtendedKey checks that the key is a watch-only extended public key of the network
+func VerifyExtendedKey(extendedKey string, network Network) error {
+	_, err := DeriveAddress(extendedKey, network, 0)
+	return err
+}
+
+const (
+	// BranchExternal is the chain of the receive addresses of an account
+	BranchExternal uint32 = 0
+	// BranchInternal is the chain of the change addresses of an account
+	BranchInternal uint32 = 1
+)
+
+// DeriveAddress returns the address at the index of the external chain (m/0/index) of an account extended public key
+func DeriveAddress(extendedKey string, network Network, index uint32) (string, error) {
+	return DeriveBranchAddress(extendedKey, network, BranchExternal, index)
+}
+
+// DeriveBranchAddress returns the address at the index of a chain (m/branch/index) of an account extended public key
+func DeriveBranchAddress(extendedKey string, network Network, branch, index uint32) (string, error) {
+	extendedKey = strings.TrimSpace(extendedKey)
+	switch network {
+	case NetworkBTC, NetworkLTC:
+		return deriveBitcoinLikeAddress(extendedKey, network, branch, index)
+	case NetworkDCR:
+		return deriveDecredAddress(extendedKey, branch, index)
+	}
+	return "", fmt.Errorf("extended public keys are not supported on %s network", network.Info().Name)
+}
+
+func deriveBitcoinLikeAddress(extendedKey string, network Network, branch, index uint32) (string, error) {
+	decoded := base58.Decode(extendedKey)
+	if len(decoded) < 4 {
+		return "", fmt.Errorf("invalid extended public key")
+	}
+	var version [4]byte
+	copy(version[:], decoded[:4])
+	addressType, ok := extendedKeyVersions[network][version]
+	if !ok {
+		return "", fmt.Errorf("the extended public key is not supported on %s network", network.Info().Name)
+	}
+	key, err := hdkeychain.NewKeyFromString(extendedKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid extended public key: %v", err)
+	}
+	if key.IsPrivate() {
+		return "", fmt.Errorf("extended private keys are not accepted, please use the extended public key")
+	}
+	child, err := key.Derive(branch)
+	if err == nil {
+		child, err = child.Derive(index)
+	}
+	if err != nil {
+		return "", fmt.Errorf("derive address %d failed: %v", index, err)
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	// the redeem script of a nested segwit address: OP_0 <20 bytes public key hash>
+	redeemScript := bytes.Join([][]byte{{0x00, 0x14}, pubKeyHash}, nil)
+
+	if network == NetworkLTC {
+		params := &ltcChaincfg.MainNetParams
+		var address ltcutil.Address
+		switch addressType {
+		case AddressTypeP2PKH:
+			address, err = ltcutil.NewAddressPubKeyHash(pubKeyHash, params)
+		case AddressTypeP2SHP2WPKH:
+			address, err = ltcutil.NewAddressScriptHash(redeemScript, params)
+		default:
+			address, err = ltcutil.NewAddressWitnessPubKeyHash(pubKeyHash, params)
+		}
+		if err != nil {
+			return "", err
+		}
+		return address.EncodeAddress(), nil
+	}
+
+	params := &btcChaincfg.MainNetParams
+	var address btcutil.Address
+	switch addressType {
+	case AddressTypeP2PKH:
+		address, err = btcutil.NewAddressPubKeyHash(pubKeyHash, params)
+	case AddressTypeP2SHP2WPKH:
+		address, err = btcutil.NewAddressScriptHash(redeemScript, params)
+	default:
+		address, err = btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, params)
+	}
+	if err != nil {
+		return "", err
+	}
+	return address.EncodeAddress(), nil
+}
+
+func deriveDecredAddress(extendedKey string, branch, index uint32) (string, error) {
+	params := dcrChaincfg.MainNetParams()
+	key, err := dcrHdkeychain.NewKeyFromString(extendedKey, params)
+	if err != nil {
+		return "", fmt.Errorf("invalid extended public key: %v", err)
+	}
+	if key.IsPrivate() {
+		return "", fmt.Errorf("extended private keys are not accepted, please use the extended public key")
+	}
+	child, err := key.Child(branch)
+	if err == nil {
+		child, err = child.Child(index)
+	}
+	if err != nil {
+		return "", fmt.Errorf("derive address %d failed: %v", index, err)
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return "", err
+	}
+	address, err := dcrutilv2.NewAddressPubKeyHash(dcrutilv2.Hash160(pubKey.SerializeCompressed()), params, dcrec.STEcdsaSecp256k1)
+	if err != nil {
+		return "", err
+	}
+	return address.Address(), nil
+}
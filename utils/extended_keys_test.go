@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	btcChaincfg "github.com/btcsuite/btcd/chaincfg"
+	dcrChaincfg "github.com/decred/dcrd/chaincfg/v2"
+	"github.com/decred/dcrd/dcrec"
+	dcrutilv2 "github.com/decred/dcrd/dcrutil/v2"
+	dcrHdkeychain "github.com/decred/dcrd/hdkeychain/v2"
+	ltcChaincfg "github.com/ltcsuite/ltcd/chaincfg"
+	"github.com/ltcsuite/ltcd/ltcutil"
+)
+
+// the account keys of the "abandon abandon ... about" mnemonic published with BIP44, BIP49 and BIP84
+const (
+	bip44AccountXpub = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	bip49AccountYpub = "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+	bip84AccountZpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+)
+
+func TestDeriveAddressPublishedVectors(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		branch  uint32
+		index   uint32
+		address string
+	}{
+		{name: "BIP44 xpub receive 0", key: bip44AccountXpub, branch: BranchExternal, index: 0, address: "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{name: "BIP44 xpub receive 1", key: bip44AccountXpub, branch: BranchExternal, index: 1, address: "1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"},
+		{name: "BIP49 ypub receive 0", key: bip49AccountYpub, branch: BranchExternal, index: 0, address: "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		{name: "BIP84 zpub receive 0", key: bip84AccountZpub, branch: BranchExternal, index: 0, address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{name: "BIP84 zpub receive 1", key: bip84AccountZpub, branch: BranchExternal, index: 1, address: "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{name: "BIP84 zpub change 0", key: bip84AccountZpub, branch: BranchInternal, index: 0, address: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+	}
+	for _, test := range tests {
+		address, err := DeriveBranchAddress(test.key, NetworkBTC, test.branch, test.index)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if address != test.address {
+			t.Errorf("%s: derived %s, expected %s", test.name, address, test.address)
+		}
+	}
+}
+
+func TestDeriveAddressLitecoin(t *testing.T) {
+	account, err := hdkeychain.NewKeyFromString(bip44AccountXpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same account key with the Ltub version derives the litecoin address of the same public key hash
+	ltub, err := account.CloneWithVersion([]byte{0x01, 0x9d, 0xa4, 0x62})
+	if err != nil {
+		t.Fatal(err)
+	}
+	btcAddress, err := btcutil.DecodeAddress("1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", &btcChaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := DeriveAddress(ltub.String(), NetworkLTC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ltcAddress, err := ltcutil.DecodeAddress(address, &ltcChaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("derived %s: %v", address, err)
+	}
+	if _, ok := ltcAddress.(*ltcutil.AddressPubKeyHash); !ok || !bytes.Equal(ltcAddress.ScriptAddress(), btcAddress.ScriptAddress()) {
+		t.Errorf("derived %s, expected the P2PKH address of the public key hash %x", address, btcAddress.ScriptAddress())
+	}
+	if _, err := DeriveAddress(bip44AccountXpub, NetworkLTC, 0); err == nil {
+		t.Errorf("a bitcoin xpub must not be accepted on the litecoin network")
+	}
+}
+
+func TestDeriveAddressDecred(t *testing.T) {
+	params := dcrChaincfg.MainNetParams()
+	// the seed of the BIP32 test vector 1
+	seed := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+	master, err := dcrHdkeychain.NewMaster(seed, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := master.Child(dcrHdkeychain.HardenedKeyStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dpub, err := account.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, branch := range []uint32{BranchExternal, BranchInternal} {
+		for index := uint32(0); index < 3; index++ {
+			// the address derived from the private key is the reference for the public derivation
+			child, err := account.Child(branch)
+			if err == nil {
+				child, err = child.Child(index)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubKey, err := child.ECPubKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := dcrutilv2.NewAddressPubKeyHash(dcrutilv2.Hash160(pubKey.SerializeCompressed()), params, dcrec.STEcdsaSecp256k1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address, err := DeriveBranchAddress(dpub.String(), NetworkDCR, branch, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address != expected.Address() {
+				t.Errorf("m/0'/%d/%d: derived %s, expected %s", branch, index, address, expected.Address())
+			}
+		}
+	}
+	if _, err := DeriveAddress(account.String(), NetworkDCR, 0); err == nil {
+		t.Errorf("an extended private key must be refused")
+	}
+}
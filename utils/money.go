@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// Decimals returns the number of decimals of the smallest unit of the coin
+func (m Method) Decimals() int32 {
+	switch m {
+	case PaymentTypeETH:
+		return 18
+	case PaymentTypeUSDT:
+		return 6
+	default:
+		return 8
+	}
+}
+
+// CoinAmount rounds the amount to the precision of the coin
+func CoinAmount(amount decimal.Decimal, method Method) decimal.Decimal {
+	return amount.Round(method.Decimals())
+}
+
+// ConvertToCoin returns the amount of the coin the fiat amount is worth at the rate,
+// rounded to the precision of the coin
+func ConvertToCoin(amount, rate decimal.Decimal, method Method) decimal.Decimal {
+	if rate.IsZero() {
+		return decimal.Zero
+	}
+	return amount.DivRound(rate, method.Decimals())
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/url"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/shopspring/decimal"
+)
+
+// EvmChainId returns the chain id of an evm network used in the EIP-681 payment uris
+func EvmChainId(network Network) (int64, bool) {
+	switch network {
+	case NetworkERC20:
+		return 1, true
+	case NetworkBEP20:
+		return 56, true
+	}
+	return 0, false
+}
+
+// BIP21URI returns a BIP-21 like payment uri, e.g. bitcoin:<address>?amount=<amount>&label=<label>.
+// The same format is used by the litecoin and decred wallets
+func BIP21URI(scheme, address string, amount decimal.Decimal, label string) string {
+	params := make([]string, 0, 2)
+	if amount.IsPositive() {
+		params = append(params, "amount="+amount.String())
+	}
+	if !IsEmpty(label) {
+		params = append(params, "label="+uriEscape(label))
+	}
+	return joinURI(scheme+":"+address, params)
+}
+
+// EIP681URI returns an EIP-681 payment uri sending the amount of base units to the recipient.
+// The uri calls the transfer function of the token contract when the contract is set.
+// EIP-681 has no label, the wallets show the recipient and the amount only
+func EIP681URI(chainId int64, contract, recipient string, baseUnits decimal.Decimal) string {
+	if IsEmpty(contract) {
+		return joinURI(fmt.Sprintf("ethereum:%s@%d", recipient, chainId), []string{"value=" + baseUnits.String()})
+	}
+	return joinURI(fmt.Sprintf("ethereum:%s@%d/transfer", contract, chainId), []string{
+		"address=" + recipient,
+		"uint256=" + baseUnits.String(),
+	})
+}
+
+// SolanaPayURI returns a Solana Pay transfer request uri of the amount of the spl token mint
+func SolanaPayURI(recipient, mint string, amount decimal.Decimal, label string) string {
+	params := make([]string, 0, 3)
+	if amount.IsPositive() {
+		params = append(params, "amount="+amount.String())
+	}
+	if !IsEmpty(mint) {
+		params = append(params, "spl-token="+mint)
+	}
+	if !IsEmpty(label) {
+		params = append(params, "label="+uriEscape(label))
+	}
+	return joinURI("solana:"+recipient, params)
+}
+
+// QRCodePNG renders the content as a square QR code PNG of the size in pixels
+func QRCodePNG(content string, size int) ([]byte, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, code); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// QRCodeBase64 renders the content as a QR code PNG data uri
+func QRCodeBase64(content string, size int) (string, error) {
+	image, err := QRCodePNG(content, size)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(image), nil
+}
+
+func joinURI(base string, params []string) string {
+	if len(params) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// uriEscape escapes the spaces as %20, the wallets do not read them as +
+func uriEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
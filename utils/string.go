@@ -43,3 +43,10 @@ func ValidateSortField(validMapFields map[string]bool, sortStr string) error {
 	}
 	return nil
 }
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the wildcards of a LIKE pattern so the value is matched as it is
+func EscapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
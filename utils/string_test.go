@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{value: "INV-2024-0001", escaped: "INV-2024-0001"},
+		{value: "100%", escaped: `100\%`},
+		{value: "INV_1", escaped: `INV\_1`},
+		{value: `a\b`, escaped: `a\\b`},
+		{value: `%_\`, escaped: `\%\_\\`},
+	}
+	for _, test := range tests {
+		if escaped := EscapeLike(test.value); escaped != test.escaped {
+			t.Errorf("EscapeLike(%q) is %q, expected %q", test.value, escaped, test.escaped)
+		}
+	}
+}
@@ -122,4 +122,20 @@ func MethodFromCoin(coin string) Method {
 	default:
 		return PaymentTypeNotSet
 	}
-}
\ No newline at end of file
+}
+// DefaultNetworkForMethod returns the network a coin is paid on when the
+// payment setting does not specify one
+func DefaultNetworkForMethod(method Method) Network {
+	switch method {
+	case PaymentTypeBTC:
+		return NetworkBTC
+	case PaymentTypeLTC:
+		return NetworkLTC
+	case PaymentTypeDCR:
+		return NetworkDCR
+	case PaymentTypeETH, PaymentTypeUSDT:
+		return NetworkERC20
+	default:
+		return Network("")
+	}
+}
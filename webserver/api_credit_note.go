@@ -0,0 +1,107 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/go-chi/chi/v5"
+)
+
+type apiCreditNote struct {
+	*WebServer
+}
+
+// createCreditNote handles POST /api/payment/credit-note
+func (a *apiCreditNote) createCreditNote(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.CreditNoteRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	creditNote, err := a.service.CreateCreditNote(claims.Id, body)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	a.reloadCreditNote(*creditNote)
+	utils.Response(w, http.StatusCreated, nil, creditNote)
+}
+
+// updateCreditNote handles PUT /api/payment/credit-note/{id}
+func (a *apiCreditNote) updateCreditNote(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.CreditNoteRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	id := utils.Uint64(chi.URLParam(r, "id"))
+	body.Version = ifMatchVersion(r, body.Version)
+	creditNote, err := a.service.UpdateCreditNote(id, claims.Id, body)
+	if err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, id) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
+		return
+	}
+	a.reloadCreditNote(*creditNote)
+	utils.ResponseOK(w, creditNote)
+}
+
+// refundCreditNote handles POST /api/payment/credit-note/{id}/refund
+func (a *apiCreditNote) refundCreditNote(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.CreditNoteRefund
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	id := utils.Uint64(chi.URLParam(r, "id"))
+	body.Version = ifMatchVersion(r, body.Version)
+	creditNote, err := a.service.RefundCreditNote(id, claims.Id, body)
+	if err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, id) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
+		return
+	}
+	a.reloadCreditNote(*creditNote)
+	utils.ResponseOK(w, creditNote)
+}
+
+// getCreditNotes handles GET /api/payment/{id}/credit-notes
+func (a *apiCreditNote) getCreditNotes(w http.ResponseWriter, r *http.Request) {
+	var payment storage.Payment
+	var f = storage.PaymentFilter{
+		Ids: []uint64{utils.Uint64(chi.URLParam(r, "id"))},
+	}
+	if err := a.db.First(&f, &payment); err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	paymentRouter := apiPayment{WebServer: a.WebServer}
+	if err := paymentRouter.verifyAccessPayment(r.FormValue("token"), payment, r); err != nil {
+		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+		return
+	}
+	claims, _ := a.credentialsInfo(r)
+	creditNotes, err := a.service.GetCreditNotes(payment, claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, creditNotes)
+}
+
+// reloadCreditNote reloads the lists of the receiver once the credit note is sent
+func (a *apiCreditNote) reloadCreditNote(creditNote storage.Payment) {
+	if creditNote.Status == storage.PaymentStatusCreated || creditNote.ReceiverId == 0 {
+		return
+	}
+	paymentRouter := apiPayment{WebServer: a.WebServer}
+	paymentRouter.reloadList([]string{fmt.Sprint(creditNote.ReceiverId)}, "")
+}
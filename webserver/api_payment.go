@@ -35,6 +35,7 @@ func (a *apiPayment) updatePayment(w http.ResponseWriter, r *http.Request) {
 		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
 		return
 	}
+	body.Version = ifMatchVersion(r, body.Version)
 
 	if claims == nil {
 		// receiver is external
@@ -51,7 +52,9 @@ func (a *apiPayment) updatePayment(w http.ResponseWriter, r *http.Request) {
 		payment, err := a.service.UpdatePayment(paymentId, 0, body)
 		if err != nil {
 			log.Error(err)
-			utils.Response(w, http.StatusInternalServerError, err, nil)
+			if !a.versionConflict(w, err, &storage.Payment{}, paymentId) {
+				utils.Response(w, http.StatusInternalServerError, err, nil)
+			}
 			return
 		}
 
@@ -64,7 +67,9 @@ func (a *apiPayment) updatePayment(w http.ResponseWriter, r *http.Request) {
 		payment, err := a.service.UpdatePayment(paymentId, claims.Id, body)
 		if err != nil {
 			log.Error(err)
-			utils.Response(w, http.StatusInternalServerError, err, nil)
+			if !a.versionConflict(w, err, &storage.Payment{}, paymentId) {
+				utils.Response(w, http.StatusInternalServerError, err, nil)
+			}
 			return
 		}
 		if body.Status == storage.PaymentStatusSent || body.Status == storage.PaymentStatusCreated {
@@ -134,11 +139,6 @@ func (a *apiPayment) createPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// sender only save payment as draft or sent to receiver
-	if body.Status != storage.PaymentStatusCreated && body.Status != storage.PaymentStatusSent {
-		utils.Response(w, http.StatusBadRequest, fmt.Errorf("you only save it as draft or sent it to receiver"), nil)
-		return
-	}
 	// set payment type and code
 	body.PaymentType = utils.PaymentSystem
 	body.PaymentCode = ""
@@ -178,12 +178,6 @@ func (a *apiPayment) createPaymentUrl(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// sender only save payment as draft or sent to receiver
-	if body.Status != storage.PaymentStatusCreated && body.Status != storage.PaymentStatusSent {
-		utils.Response(w, http.StatusBadRequest, fmt.Errorf("you only save it as draft or sent it to receiver"), nil)
-		return
-	}
-
 	// set payment type and code
 	body.PaymentType = utils.PaymentUrl
 	body.PaymentCode = a.service.GenerateRandomCode()
@@ -259,10 +253,38 @@ func (a *apiPayment) getPayment(w http.ResponseWriter, r *http.Request) {
 		}
 		payment.PaymentSettings = enhancedSettings
 	}
+	transactions, err := a.service.GetPaymentTransactions(payment.Id)
+	if err != nil {
+		log.Errorf("get transactions of payment %d failed: %v", payment.Id, err)
+	}
+	payment.Transactions = transactions
 
+	w.Header().Set("ETag", versionTag(payment.Version))
 	utils.ResponseOK(w, payment)
 }
 
+// getPaymentEvents handles GET /api/payment/{id}/events, the history of the payment for the users who can see it
+func (a *apiPayment) getPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	var payment storage.Payment
+	var f = storage.PaymentFilter{
+		Ids: []uint64{utils.Uint64(chi.URLParam(r, "id"))},
+	}
+	if err := a.db.First(&f, &payment); err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err := a.verifyAccessPayment(r.FormValue("token"), payment, r); err != nil {
+		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+		return
+	}
+	events, err := a.service.GetPaymentEvents(payment.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, events)
+}
+
 // Helper function to get network for payment type
 func getNetworkForPaymentType(paymentType utils.Method) string {
 	switch paymentType {
@@ -349,6 +371,11 @@ func (a *apiPayment) getPaymentUrl(w http.ResponseWriter, r *http.Request) {
 		}
 		payment.PaymentSettings = enhancedSettings
 	}
+	transactions, err := a.service.GetPaymentTransactions(payment.Id)
+	if err != nil {
+		log.Errorf("get transactions of payment %d failed: %v", payment.Id, err)
+	}
+	payment.Transactions = transactions
 
 	utils.ResponseOK(w, payment)
 }
@@ -465,8 +492,27 @@ func (a *apiPayment) verifyAccessPayment(token string, payment storage.Payment,
 	return fmt.Errorf("you do not have access")
 }
 
-func (a *apiPayment) getBtcBulkRate(w http.ResponseWriter, r *http.Request) {
-	rate, err := a.service.GetBTCBulkRate()
+// bulkPayMethod defaults the coin of the bulk pay requests to BTC, the only coin bulk pay supported before
+func bulkPayMethod(method utils.Method) utils.Method {
+	if method == utils.PaymentTypeNotSet {
+		return utils.PaymentTypeBTC
+	}
+	return method
+}
+
+func (a *apiPayment) getBulkRate(w http.ResponseWriter, r *http.Request) {
+	var query portal.BulkPayQuery
+	if err := a.parseQueryAndValidate(r, &query); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	claims, isOk := a.credentialsInfo(r)
+	if !isOk {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
+		return
+	}
+	// the rate is locked for the user, the bulk payment is refused at another rate
+	quote, err := a.service.CreateBulkRateQuote(claims.Id, bulkPayMethod(query.Coin))
 	if err != nil {
 		log.Error(err)
 		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
@@ -474,8 +520,10 @@ func (a *apiPayment) getBtcBulkRate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := portal.GetRateResponse{
-		Rate:        rate,
-		ConvertTime: time.Now().Unix(),
+		Rate:        quote.Rate.InexactFloat64(),
+		ConvertTime: quote.CreatedAt.Unix(),
+		QuoteId:     quote.Id,
+		ExpiresAt:   quote.ExpiresAt,
 	}
 
 	utils.ResponseOK(w, res)
@@ -515,17 +563,41 @@ func (a *apiPayment) requestRate(w http.ResponseWriter, r *http.Request) {
 		f.Exchange = service.Binance
 	}
 	handlerExchange := strings.ToLower(f.Exchange)
-	rate, err := a.service.GetExchangeRate(handlerExchange, f.PaymentMethod)
+	quote, err := a.service.CreateRateQuote(p, f.Amount, handlerExchange, f.PaymentMethod)
 	if err != nil {
 		log.Error(err)
-		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	utils.ResponseOK(w, Map{
-		"rate":           rate,
-		"convertTime":    time.Now(),
-		"expectedAmount": utils.BtcRoundFloat(p.Amount / rate),
-	})
+	utils.ResponseOK(w, a.rateQuoteResponse(p, quote, f))
+}
+
+// rateQuoteResponse returns the quote with the uri paying its expected amount and the QR code of the uri.
+// The uri is left out when the payment has no address for the coin
+func (a *apiPayment) rateQuoteResponse(payment storage.Payment, quote *storage.RateQuote, f portal.PaymentRequestRate) Map {
+	res := Map{
+		"quoteId":        quote.Id,
+		"rate":           quote.Rate,
+		"convertTime":    quote.CreatedAt,
+		"expectedAmount": quote.ExpectedAmount,
+		"expiresAt":      quote.ExpiresAt,
+		"currency":       quote.Currency,
+	}
+	network := a.service.ResolvePaymentNetwork(payment, quote.Coin, f.PaymentNetwork)
+	address := service.PaymentSettingAddress(payment, quote.Coin, network, f.PaymentAddress)
+	if utils.IsEmpty(address) {
+		return res
+	}
+	uri, qrCode, err := a.service.PaymentQRCode(payment, quote.Coin, network, address, quote.ExpectedAmount)
+	if err != nil {
+		log.Warnf("build payment uri of payment %d failed: %v", payment.Id, err)
+		return res
+	}
+	res["paymentNetwork"] = network
+	res["paymentAddress"] = address
+	res["paymentUri"] = uri
+	res["qrCode"] = qrCode
+	return res
 }
 
 // requestRateForPayUrl is used for the user to request the crypto rate to USDT. For any user with the url.
@@ -557,17 +629,13 @@ func (a *apiPayment) requestRateForPayUrl(w http.ResponseWriter, r *http.Request
 		f.Exchange = service.Binance
 	}
 	handlerExchange := strings.ToLower(f.Exchange)
-	rate, err := a.service.GetExchangeRate(handlerExchange, f.PaymentMethod)
+	quote, err := a.service.CreateRateQuote(p, f.Amount, handlerExchange, f.PaymentMethod)
 	if err != nil {
 		log.Error(err)
-		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		utils.Response(w, http.StatusInternalServerError, err, nil)
 		return
 	}
-	utils.ResponseOK(w, Map{
-		"rate":           rate,
-		"convertTime":    time.Now(),
-		"expectedAmount": utils.BtcRoundFloat(p.Amount / rate),
-	})
+	utils.ResponseOK(w, a.rateQuoteResponse(p, quote, f))
 }
 
 func (a *apiPayment) processPayment(w http.ResponseWriter, r *http.Request) {
@@ -612,9 +680,26 @@ func (a *apiPayment) processPayment(w http.ResponseWriter, r *http.Request) {
 			utils.NewError(fmt.Errorf("payment was processed"), utils.ErrorBadRequest), nil)
 		return
 	}
-	f.Process(&payment)
-	if err = a.db.GetDB().Model(&payment).Omit("UpdatedAt").Updates(payment).Error; err != nil {
-		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+	// the rate is locked by the quote the server created, the rate sent by the payer is only checked against it
+	quote, err := a.service.GetRateQuote(f.QuoteId, payment, f.PaymentMethod, f.ConvertRate, f.ExpectedAmount)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	f.PaymentNetwork = a.service.ResolvePaymentNetwork(payment, f.PaymentMethod, f.PaymentNetwork)
+	verification, err := a.service.VerifyPaymentTx(payment, f.PaymentMethod, f.PaymentNetwork, f.TxId, f.PaymentAddress, quote.ExpectedAmount)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	var actorId uint64
+	if claims, _ := a.credentialsInfo(r); claims != nil {
+		actorId = claims.Id
+	}
+	if err = a.service.AddPaymentTransaction(actorId, &payment, f.Transaction(quote), verification); err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, payment.Id) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
 		return
 	}
 	a.reloadList([]string{fmt.Sprint(payment.ReceiverId)}, "")
@@ -650,9 +735,22 @@ func (a *apiPayment) processPaymentUrl(w http.ResponseWriter, r *http.Request) {
 		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("you cannot pay your own payment"), utils.ErrorBadRequest), nil)
 		return
 	}
-	f.ProcessPayUrl(&payment)
-	if err = a.db.GetDB().Model(&payment).Omit("UpdatedAt").Updates(payment).Error; err != nil {
-		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+	// the rate is locked by the quote the server created, the rate sent by the payer is only checked against it
+	quote, err := a.service.GetRateQuote(f.QuoteId, payment, f.PaymentMethod, f.ConvertRate, f.ExpectedAmount)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	f.PaymentNetwork = a.service.ResolvePaymentNetwork(payment, f.PaymentMethod, f.PaymentNetwork)
+	verification, err := a.service.VerifyPaymentTx(payment, f.PaymentMethod, f.PaymentNetwork, f.TxId, f.PaymentAddress, quote.ExpectedAmount)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, err, nil)
+		return
+	}
+	if err = a.service.AddPaymentTransaction(payerUser.Id, &payment, f.Transaction(quote), verification); err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, payment.Id) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
 		return
 	}
 	a.reloadList([]string{fmt.Sprint(payment.ReceiverId)}, "")
@@ -716,10 +814,19 @@ func (a *apiPayment) listPayments(w http.ResponseWriter, r *http.Request) {
 	query.Sort.Order = strings.ReplaceAll(query.Sort.Order, "senderName", "sender_name")
 	query.Sort.Order = strings.ReplaceAll(query.Sort.Order, "startDate", "start_date")
 	query.Sort.Order = strings.ReplaceAll(query.Sort.Order, "projectName", "project_name")
+	query.Sort.Order = strings.ReplaceAll(query.Sort.Order, "invoiceNumber", "invoice_number")
 
-	if query.RequestType == storage.PaymentTypeBulkPayBTC {
-		payments, count, err := a.service.GetBulkPaymentBTC(claims.Id, query.Page, query.Size, query.Sort.Order)
+	if query.RequestType == storage.PaymentTypeBulkPay || query.RequestType == storage.PaymentTypeBulkPayBTC {
+		method := bulkPayMethod(query.Coin)
+		if query.RequestType == storage.PaymentTypeBulkPayBTC {
+			method = utils.PaymentTypeBTC
+		}
+		payments, count, err := a.service.GetBulkPayments(claims.Id, method, query.Network, query.Page, query.Size, query.Sort.Order)
 		if err != nil {
+			if customErr, ok := err.(*utils.Error); ok {
+				utils.Response(w, http.StatusBadRequest, customErr, nil)
+				return
+			}
 			utils.Response(w, http.StatusInternalServerError, utils.NewError(err, utils.ErrorInternalCode), nil)
 			return
 		}
@@ -741,25 +848,36 @@ func (a *apiPayment) listPayments(w http.ResponseWriter, r *http.Request) {
 	totalUnpaid := int64(0)
 	for _, payment := range payments {
 		if payment.Status == 0 {
-			totalUnpaid += int64(payment.Amount * 100)
+			totalUnpaid += payment.Amount.Shift(2).IntPart()
 		}
 	}
 	// finalTotalUnpaid := float64(totalUnpaid) / 100
 	utils.ResponseOK(w, Map{
-		"payments":    payments,
-		"count":       count,
-		"totalUnpaid": totalAmountUnpaid,
+		"payments":              payments,
+		"count":                 count,
+		"totalUnpaid":           totalAmountUnpaid.Total,
+		"totalUnpaidCurrency":   totalAmountUnpaid.Currency,
+		"totalUnpaidByCurrency": totalAmountUnpaid.TotalByCurrency,
 	})
 }
 
-func (a *apiPayment) countBulkPayBTC(w http.ResponseWriter, r *http.Request) {
+func (a *apiPayment) countBulkPay(w http.ResponseWriter, r *http.Request) {
+	var query portal.BulkPayQuery
+	if err := a.parseQueryAndValidate(r, &query); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
 	claims, isOk := a.credentialsInfo(r)
 	if !isOk {
 		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
 		return
 	}
-	count, err := a.service.CountBulkPaymentBTC(claims.Id)
+	count, err := a.service.CountBulkPayments(claims.Id, bulkPayMethod(query.Coin), query.Network)
 	if err != nil {
+		if customErr, ok := err.(*utils.Error); ok {
+			utils.Response(w, http.StatusBadRequest, customErr, nil)
+			return
+		}
 		utils.Response(w, http.StatusInternalServerError, utils.NewError(err, utils.ErrorInternalCode), nil)
 		return
 	}
@@ -814,10 +932,16 @@ func (a *apiPayment) paymentReport(w http.ResponseWriter, r *http.Request) {
 			tmpPaymentReport.Month = fmt.Sprint(currentYear, "-", currentMonth)
 		}
 		var paymentUnit = portal.PaymentReportUnit{}
+		paymentUnit.InvoiceNumber = payment.InvoiceNumber
 		paymentUnit.DisplayName = payment.SenderDisplayName
 		paymentUnit.Amount = payment.Amount
 		paymentUnit.ExpectedAmount = payment.ExpectedAmount
 		paymentUnit.PaymentMethod = payment.PaymentMethod
+		paymentUnit.Subtotal = payment.NetAmount()
+		paymentUnit.Discount = payment.Discount
+		paymentUnit.Tax = payment.TaxAmount
+		paymentUnit.TaxLines = payment.TaxLines
+		paymentUnit.CreditNoteOf = payment.CreditNoteOf
 		tmpPaymentReport.PaymentUnits = append(tmpPaymentReport.PaymentUnits, paymentUnit)
 		//if is last element
 		if index == len(payments)-1 {
@@ -851,7 +975,8 @@ func (a *apiPayment) invoiceReport(w http.ResponseWriter, r *http.Request) {
 		}
 		var displayName = utils.GetUserDisplayName(payment.SenderName, payment.SenderDisplayName)
 		for _, detail := range payment.Details {
-			if detail.Price != 0 {
+			// the hours are the labor lines paid at the hourly rate
+			if !detail.Price.IsZero() || !detail.Type.IsLabor() {
 				continue
 			}
 			var key = displayName
@@ -861,6 +986,7 @@ func (a *apiPayment) invoiceReport(w http.ResponseWriter, r *http.Request) {
 				key = fmt.Sprint(key, ";", detail.ProjectName)
 			}
 			var tmpUnit = portal.InvoiceReportUnit{}
+			tmpUnit.InvoiceNumber = payment.InvoiceNumber
 			tmpUnit.Date = detail.Date
 			tmpUnit.Description = detail.Description
 			tmpUnit.Hours = detail.Quantity
@@ -915,6 +1041,56 @@ func (a *apiPayment) getPaymentUsers(w http.ResponseWriter, r *http.Request) {
 	utils.ResponseOK(w, userSelection)
 }
 
+// getCurrencies returns the fiat currencies an invoice can be issued in
+func (a *apiPayment) getCurrencies(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseOK(w, Map{
+		"currencies":        utils.SupportedCurrencies(),
+		"reportingCurrency": a.service.ReportingCurrency(),
+	})
+}
+
+// getRateHistory returns the sampled rate of a coin at a timestamp or the samples over a range
+func (a *apiPayment) getRateHistory(w http.ResponseWriter, r *http.Request) {
+	var f portal.RateHistoryRequest
+	err := a.parseQueryAndValidate(r, &f)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	if f.Coin == utils.PaymentTypeNotSet {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("coin is required"), utils.ErrorBadRequest), nil)
+		return
+	}
+	if !f.At.IsZero() {
+		rate, err := a.service.GetHistoricalRate(f.Coin, f.Exchange, f.At, f.Interpolate)
+		if err != nil {
+			// a coin without sample is a not found error, the database errors are internal ones
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+			return
+		}
+		utils.ResponseOK(w, rate)
+		return
+	}
+	if f.From.IsZero() || f.To.IsZero() || f.To.Before(f.From) {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("a timestamp or a valid range is required"), utils.ErrorBadRequest), nil)
+		return
+	}
+	var interval time.Duration
+	if !utils.IsEmpty(f.Interval) {
+		interval, err = time.ParseDuration(f.Interval)
+		if err != nil || interval < time.Second {
+			utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("the interval must be a duration of at least 1s"), utils.ErrorBadRequest), nil)
+			return
+		}
+	}
+	samples, err := a.service.GetRateSamples(f.Coin, f.Exchange, f.From, f.To, interval)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, samples)
+}
+
 func (a *apiPayment) getExchangeList(w http.ResponseWriter, r *http.Request) {
 	exchanges := a.service.ExchangeList
 	if utils.IsEmpty(exchanges) {
@@ -956,6 +1132,7 @@ func (a *apiPayment) addressReport(w http.ResponseWriter, r *http.Request) {
 		}
 		var displayName = utils.GetUserDisplayName(payment.SenderName, payment.SenderDisplayName)
 		var tmpUnit = portal.AddressReportUnit{}
+		tmpUnit.InvoiceNumber = payment.InvoiceNumber
 		tmpUnit.DateTime = payment.PaidAt.Format("2006/01/02")
 		tmpUnit.Amount = payment.Amount
 		tmpUnit.ExpectedAmount = payment.ExpectedAmount
@@ -990,9 +1167,12 @@ func (a *apiPayment) approveRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payment, err := a.service.ApprovePaymentRequest(f.PaymentId, claims.Id)
+	f.Version = ifMatchVersion(r, f.Version)
+	payment, err := a.service.ApprovePaymentRequest(claims.Id, f)
 	if err != nil {
-		utils.Response(w, http.StatusBadRequest, err, nil)
+		if !a.versionConflict(w, err, &storage.Payment{}, f.PaymentId) {
+			utils.Response(w, http.StatusBadRequest, err, nil)
+		}
 		return
 	}
 
@@ -1015,41 +1195,53 @@ func (a *apiPayment) rejectPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := a.verifyAccessPayment(f.Token, payment, r); err != nil {
-		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+	claims, isOk := a.credentialsInfo(r)
+	if !isOk {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
 		return
 	}
-
-	if payment.ContactMethod == storage.PaymentTypeInternal {
-		claims, isOk := a.credentialsInfo(r)
-		if !isOk {
-			utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
+	// the admins can reject the payments they can not see
+	if claims == nil || claims.UserRole != utils.UserRoleAdmin {
+		if err := a.verifyAccessPayment(f.Token, payment, r); err != nil {
+			utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
 			return
 		}
-		if !(claims != nil && claims.Id == payment.ReceiverId) {
+		if payment.ContactMethod == storage.PaymentTypeInternal && !(claims != nil && claims.Id == payment.ReceiverId) {
 			utils.Response(w, http.StatusForbidden,
 				utils.NewError(fmt.Errorf("you do not have access right"), utils.ErrorForbidden), nil)
 			return
 		}
 	}
 
-	if payment.Status == storage.PaymentStatusPaid {
-		utils.Response(w, http.StatusBadRequest,
-			utils.NewError(fmt.Errorf("payment was processed"), utils.ErrorBadRequest), nil)
-		return
+	var actorId uint64
+	if claims != nil {
+		actorId = claims.Id
 	}
-
-	payment.Status = storage.PaymentStatusRejected
-	payment.RejectionReason = f.RejectionReason
-	if err = a.db.Save(&payment); err != nil {
-		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+	f.Version = ifMatchVersion(r, f.Version)
+	if err = a.service.RejectPayment(&payment, actorId, paymentRole(payment, claims), f); err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, payment.Id) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
 		return
 	}
 
 	utils.ResponseOK(w, payment)
 }
 
-func (a *apiPayment) bulkPaidBTC(w http.ResponseWriter, r *http.Request) {
+// paymentRole returns the role of the user in the payment, the external user with the token of the payment is its receiver
+func paymentRole(payment storage.Payment, claims *authClaims) storage.PaymentRole {
+	switch {
+	case claims == nil || claims.Id == payment.ReceiverId:
+		return storage.PaymentRoleReceiver
+	case claims.Id == payment.SenderId:
+		return storage.PaymentRoleSender
+	case claims.UserRole == utils.UserRoleAdmin:
+		return storage.PaymentRoleAdmin
+	}
+	return storage.PaymentRoleApprover
+}
+
+func (a *apiPayment) bulkPaid(w http.ResponseWriter, r *http.Request) {
 	var body portal.BulkPaidRequests
 	err := a.parseJSONAndValidate(r, &body)
 	if err != nil {
@@ -1066,10 +1258,127 @@ func (a *apiPayment) bulkPaidBTC(w http.ResponseWriter, r *http.Request) {
 		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
 		return
 	}
-	if err := a.service.BulkPaidBTC(claims.Id, body.TxId, body.PaymentList); err != nil {
+	if err := a.service.BulkPaid(claims.Id, bulkPayMethod(body.PaymentMethod), body.PaymentNetwork, body.TxId, body.QuoteId, body.PaymentList); err != nil {
+		if customErr, ok := err.(*utils.Error); ok {
+			utils.Response(w, http.StatusBadRequest, customErr, nil)
+			return
+		}
 		utils.Response(w, http.StatusForbidden, utils.InternalError.With(err), nil)
 		return
 	}
 
 	utils.ResponseOK(w, nil)
 }
+
+// bulkPsbt handles POST /api/payment/bulk-psbt, the txid of the signed transaction is sent to /bulk-paid once it is broadcast
+func (a *apiPayment) bulkPsbt(w http.ResponseWriter, r *http.Request) {
+	var body portal.BulkPsbtRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	if len(body.PaymentList) == 0 {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("list payment id can't be empty or nil"), utils.ErrorBadRequest), nil)
+		return
+	}
+	claims, isOk := a.credentialsInfo(r)
+	if !isOk {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(fmt.Errorf("Get credentials info failed"), utils.ErrorBadRequest), nil)
+		return
+	}
+	res, err := a.service.BuildBulkPsbt(claims.Id, body)
+	if err != nil {
+		if customErr, ok := err.(*utils.Error); ok {
+			utils.Response(w, http.StatusBadRequest, customErr, nil)
+			return
+		}
+		utils.Response(w, http.StatusForbidden, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, res)
+}
+
+// getPaymentPdf handles GET /api/payment/{id}/pdf
+func (a *apiPayment) getPaymentPdf(w http.ResponseWriter, r *http.Request) {
+	var payment storage.Payment
+	var f = storage.PaymentFilter{
+		Ids: []uint64{utils.Uint64(chi.URLParam(r, "id"))},
+	}
+	if err := a.db.First(&f, &payment); err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if err := a.verifyAccessPayment(r.FormValue("token"), payment, r); err != nil {
+		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+		return
+	}
+	a.writePaymentPdf(w, payment)
+}
+
+// getPaymentPdfWithToken handles GET /api/payment-url/{id}/pdf?token= for the external receivers of the emailed link
+func (a *apiPayment) getPaymentPdfWithToken(w http.ResponseWriter, r *http.Request) {
+	var payment storage.Payment
+	var f = storage.PaymentFilter{
+		Ids: []uint64{utils.Uint64(chi.URLParam(r, "id"))},
+	}
+	if err := a.db.First(&f, &payment); err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if payment.ContactMethod != storage.PaymentTypeEmail || payment.Status == storage.PaymentStatusCreated {
+		utils.Response(w, http.StatusForbidden, utils.ForbiddenError, nil)
+		return
+	}
+	if err := a.verifyTokenPayment(r.FormValue("token"), payment.Id); err != nil {
+		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+		return
+	}
+	a.writePaymentPdf(w, payment)
+}
+
+// getPaymentUrlPdf handles GET /api/payment-url/pay/{id}/{code}/pdf
+func (a *apiPayment) getPaymentUrlPdf(w http.ResponseWriter, r *http.Request) {
+	payment, err := a.service.GetPaymentPayUrl(int64(utils.Uint64(chi.URLParam(r, "id"))), chi.URLParam(r, "code"))
+	if err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	if payment.Status == storage.PaymentStatusCreated {
+		utils.Response(w, http.StatusBadRequest, utils.ForbiddenError, nil)
+		return
+	}
+	a.writePaymentPdf(w, payment)
+}
+
+func (a *apiPayment) writePaymentPdf(w http.ResponseWriter, payment storage.Payment) {
+	a.sortPaymentDetails(payment)
+	transactions, err := a.service.GetPaymentTransactions(payment.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	pdf, err := a.service.RenderInvoicePDF(payment, transactions)
+	if err != nil {
+		log.Errorf("render the pdf of payment %d failed: %v", payment.Id, err)
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%s.pdf"`, pdfFileNumber(payment)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// pdfFileNumber returns the invoice number of the payment with the characters a file name can hold
+func pdfFileNumber(payment storage.Payment) string {
+	number := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return -1
+	}, payment.InvoiceNumber)
+	if len(number) == 0 {
+		return fmt.Sprint(payment.Id)
+	}
+	return number
+}
@@ -0,0 +1,118 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/go-chi/chi/v5"
+)
+
+type apiDispute struct {
+	*WebServer
+}
+
+// openDispute handles POST /api/payment/{id}/dispute
+func (a *apiDispute) openDispute(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.DisputeRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	paymentId := utils.Uint64(chi.URLParam(r, "id"))
+	body.Version = ifMatchVersion(r, body.Version)
+	dispute, err := a.service.OpenDispute(paymentId, claims.Id, claims.UserName, body)
+	if err != nil {
+		if !a.versionConflict(w, err, &storage.Payment{}, paymentId) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
+		return
+	}
+	utils.Response(w, http.StatusCreated, nil, dispute)
+}
+
+// getDisputes handles GET /api/payment/{id}/disputes
+func (a *apiDispute) getDisputes(w http.ResponseWriter, r *http.Request) {
+	var payment storage.Payment
+	var f = storage.PaymentFilter{
+		Ids: []uint64{utils.Uint64(chi.URLParam(r, "id"))},
+	}
+	if err := a.db.First(&f, &payment); err != nil {
+		utils.Response(w, http.StatusNotFound, utils.NotFoundError, nil)
+		return
+	}
+	paymentRouter := apiPayment{WebServer: a.WebServer}
+	if err := paymentRouter.verifyAccessPayment(r.FormValue("token"), payment, r); err != nil {
+		utils.Response(w, http.StatusForbidden, utils.NewError(err, utils.ErrorForbidden), nil)
+		return
+	}
+	disputes, err := a.service.GetDisputes(payment.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, disputes)
+}
+
+// addDisputeMessage handles POST /api/payment/dispute/{id}/message
+func (a *apiDispute) addDisputeMessage(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.DisputeMessageRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	message, err := a.service.AddDisputeMessage(utils.Uint64(chi.URLParam(r, "id")), claims.Id, claims.UserName, body)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.Response(w, http.StatusCreated, nil, message)
+}
+
+// reviseDisputedPayment handles POST /api/payment/dispute/{id}/revise
+func (a *apiDispute) reviseDisputedPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.DisputeRevision
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	disputeId := utils.Uint64(chi.URLParam(r, "id"))
+	body.Version = ifMatchVersion(r, body.Version)
+	payment, err := a.service.ReviseDisputedPayment(disputeId, claims.Id, claims.UserName, body)
+	if err != nil {
+		a.disputeError(w, err, disputeId)
+		return
+	}
+	utils.ResponseOK(w, payment)
+}
+
+// resolveDispute handles POST /api/payment/dispute/{id}/resolve
+func (a *apiDispute) resolveDispute(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.DisputeResolution
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	disputeId := utils.Uint64(chi.URLParam(r, "id"))
+	body.Version = ifMatchVersion(r, body.Version)
+	dispute, err := a.service.ResolveDispute(disputeId, claims.Id, claims.UserName, body)
+	if err != nil {
+		a.disputeError(w, err, disputeId)
+		return
+	}
+	utils.ResponseOK(w, dispute)
+}
+
+// disputeError responds the error of the dispute, with the current payment of the dispute on a version conflict
+func (a *apiDispute) disputeError(w http.ResponseWriter, err error, disputeId uint64) {
+	var dispute storage.PaymentDispute
+	if a.db.GetById(disputeId, &dispute) == nil && a.versionConflict(w, err, &storage.Payment{}, dispute.PaymentId) {
+		return
+	}
+	utils.Response(w, http.StatusInternalServerError, err, nil)
+}
@@ -117,6 +117,30 @@ func (a *apiPaymentMethod) deletePaymentMethod(w http.ResponseWriter, r *http.Re
 	})
 }
 
+// getDerivedAddresses handles GET /api/user/payment-methods/{id}/addresses
+func (a *apiPaymentMethod) getDerivedAddresses(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		utils.Response(w, http.StatusBadRequest, fmt.Errorf("invalid payment method id"), nil)
+		return
+	}
+
+	addresses, err := a.service.GetDerivedAddresses(id, claims.Id)
+	if err != nil {
+		if err.Error() == "payment method not found" {
+			utils.Response(w, http.StatusNotFound, err, nil)
+		} else {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
+		return
+	}
+
+	utils.ResponseOK(w, addresses)
+}
+
 // validateAddress handles POST /api/user/payment-methods/validate-address
 func (a *apiPaymentMethod) validateAddress(w http.ResponseWriter, r *http.Request) {
 	var req portal.ValidateAddressRequest
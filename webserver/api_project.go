@@ -108,9 +108,12 @@ func (a *apiProject) editProject(w http.ResponseWriter, r *http.Request) {
 		memberArr = append(memberArr, member)
 	}
 	body.Members = memberArr
+	body.Version = ifMatchVersion(r, body.Version)
 	project, err := a.service.UpdateProject(claims.Id, body)
 	if err != nil {
-		utils.Response(w, http.StatusInternalServerError, err, nil)
+		if !a.versionConflict(w, err, &storage.Project{}, body.ProjectId) {
+			utils.Response(w, http.StatusInternalServerError, err, nil)
+		}
 		return
 	}
 
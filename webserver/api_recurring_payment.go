@@ -0,0 +1,120 @@
+package webserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/go-chi/chi/v5"
+)
+
+type apiRecurringPayment struct {
+	*WebServer
+}
+
+// createRecurringPayment handles POST /api/payment/recurring
+func (a *apiRecurringPayment) createRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.RecurringPaymentRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	recurring, err := a.service.CreateRecurringPayment(claims.Id, body)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.Response(w, http.StatusCreated, nil, recurring)
+}
+
+// getRecurringPayments handles GET /api/payment/recurring
+func (a *apiRecurringPayment) getRecurringPayments(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	recurrings, err := a.service.GetRecurringPayments(claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.NewError(err, utils.ErrorInternalCode), nil)
+		return
+	}
+	utils.ResponseOK(w, recurrings)
+}
+
+// getRecurringPayment handles GET /api/payment/recurring/{id}
+func (a *apiRecurringPayment) getRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	recurring, err := a.service.GetRecurringPayment(utils.Uint64(chi.URLParam(r, "id")), claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, recurring)
+}
+
+// updateRecurringPayment handles PUT /api/payment/recurring/{id}
+func (a *apiRecurringPayment) updateRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.RecurringPaymentRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	recurring, err := a.service.UpdateRecurringPayment(utils.Uint64(chi.URLParam(r, "id")), claims.Id, body)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, recurring)
+}
+
+// pauseRecurringPayment handles POST /api/payment/recurring/{id}/pause
+func (a *apiRecurringPayment) pauseRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	recurring, err := a.service.PauseRecurringPayment(utils.Uint64(chi.URLParam(r, "id")), claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, recurring)
+}
+
+// resumeRecurringPayment handles POST /api/payment/recurring/{id}/resume
+func (a *apiRecurringPayment) resumeRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	recurring, err := a.service.ResumeRecurringPayment(utils.Uint64(chi.URLParam(r, "id")), claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, recurring)
+}
+
+// deleteRecurringPayment handles DELETE /api/payment/recurring/{id}
+func (a *apiRecurringPayment) deleteRecurringPayment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	if err := a.service.DeleteRecurringPayment(utils.Uint64(chi.URLParam(r, "id")), claims.Id); err != nil {
+		utils.Response(w, http.StatusInternalServerError, err, nil)
+		return
+	}
+	utils.ResponseOK(w, Map{
+		"message": "Recurring payment deleted successfully",
+	})
+}
+
+// notifyRecurringPayment reloads the list of the receiver and emails the external receiver of a payment
+// created by a recurring schedule, as it is done when the sender creates the payment
+func (s *WebServer) notifyRecurringPayment(payment storage.Payment) {
+	paymentRouter := apiPayment{WebServer: s}
+	paymentRouter.reloadList([]string{fmt.Sprint(payment.ReceiverId), fmt.Sprint(payment.SenderId)}, "")
+	if payment.ContactMethod != storage.PaymentTypeEmail {
+		return
+	}
+	sender := &authClaims{
+		Id:       payment.SenderId,
+		UserName: payment.SenderName,
+	}
+	if _, err := paymentRouter.sendNotification(storage.PaymentStatusCreated, payment, sender); err != nil {
+		log.Errorf("notify recurring payment %d failed: %v", payment.Id, err)
+	}
+}
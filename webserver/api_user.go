@@ -504,14 +504,23 @@ func (a *apiUser) getAdminReportSummary(w http.ResponseWriter, r *http.Request)
 	}
 	reportSummary := portal.AdminSummaryReport{
 		TotalInvoices: len(payments),
+		Currency:      a.service.ReportingCurrency(),
 	}
 	totalAmount := float64(0)
+	totalTax := float64(0)
 	sentInfo := portal.PaymentStatusSummary{}
 	pendingInfo := portal.PaymentStatusSummary{}
 	paidInfo := portal.PaymentStatusSummary{}
+	creditInfo := portal.PaymentStatusSummary{}
 	usersSummaryMap := make(map[uint64]*portal.UserUsageSummary)
 	userIds := make([]uint64, 0)
 	for _, payment := range payments {
+		// the invoices can be issued in different currencies, the report is in the reporting currency
+		amount, tax, err := a.service.ToReportingAmount(payment)
+		if err != nil {
+			utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+			return
+		}
 		if strings.Contains(payment.SenderName, rf.UserName) {
 			if !CheckExistOnIntArray(userIds, payment.SenderId) {
 				userIds = append(userIds, payment.SenderId)
@@ -522,17 +531,32 @@ func (a *apiUser) getAdminReportSummary(w http.ResponseWriter, r *http.Request)
 				userIds = append(userIds, payment.ReceiverId)
 			}
 		}
-		totalAmount += payment.Amount
+		if payment.IsCreditNote() {
+			if payment.Status == storage.PaymentStatusPaid {
+				// the refunded credit notes have a negative amount, they net against the paid invoices in the totals
+				creditInfo.InvoiceNum++
+				creditInfo.Amount += amount
+				creditInfo.Tax += tax
+			} else {
+				// the credit note is not refunded yet, it does not change the totals
+				amount, tax = 0, 0
+			}
+		}
+		totalAmount += amount
+		totalTax += tax
 		switch payment.Status {
 		case storage.PaymentStatusConfirmed:
 			pendingInfo.InvoiceNum++
-			pendingInfo.Amount += payment.Amount
+			pendingInfo.Amount += amount
+			pendingInfo.Tax += tax
 		case storage.PaymentStatusPaid:
 			paidInfo.InvoiceNum++
-			paidInfo.Amount += payment.Amount
+			paidInfo.Amount += amount
+			paidInfo.Tax += tax
 		default:
 			sentInfo.InvoiceNum++
-			sentInfo.Amount += payment.Amount
+			sentInfo.Amount += amount
+			sentInfo.Tax += tax
 		}
 		senderId := payment.SenderId
 		receiverId := payment.ReceiverId
@@ -542,22 +566,22 @@ func (a *apiUser) getAdminReportSummary(w http.ResponseWriter, r *http.Request)
 		receiverInMap = usersSummaryMap[receiverId]
 		if senderInMap != nil {
 			senderInMap.SendNum++
-			senderInMap.SentUsd += payment.Amount
+			senderInMap.SentUsd += amount
 		} else {
 			senderInMap = &portal.UserUsageSummary{
 				Username: payment.SenderName,
 				SendNum:  1,
-				SentUsd:  payment.Amount,
+				SentUsd:  amount,
 			}
 		}
 		if receiverInMap != nil {
 			receiverInMap.ReceiveNum++
-			receiverInMap.ReceiveUsd += payment.Amount
+			receiverInMap.ReceiveUsd += amount
 		} else {
 			receiverInMap = &portal.UserUsageSummary{
 				Username:   payment.ReceiverName,
 				ReceiveNum: 1,
-				ReceiveUsd: payment.Amount,
+				ReceiveUsd: amount,
 				PaidNum:    0,
 				PaidUsd:    0,
 			}
@@ -565,21 +589,21 @@ func (a *apiUser) getAdminReportSummary(w http.ResponseWriter, r *http.Request)
 		if payment.Status == storage.PaymentStatusPaid {
 			if rf.UserName == "" {
 				senderInMap.GotPaidNum++
-				senderInMap.GotPaidUsd += payment.Amount
+				senderInMap.GotPaidUsd += amount
 				receiverInMap.PaidNum++
-				receiverInMap.PaidUsd += payment.Amount
+				receiverInMap.PaidUsd += amount
 			} else {
 				isReceiverSearched := strings.Contains(payment.ReceiverName, rf.UserName)
 				if isReceiverSearched {
 					receiverInMap.PaidNum++
-					receiverInMap.PaidUsd += payment.Amount
+					receiverInMap.PaidUsd += amount
 					senderInMap.GotPaidNum++
-					senderInMap.GotPaidUsd += payment.Amount
+					senderInMap.GotPaidUsd += amount
 				} else {
 					receiverInMap.PaidNum++
-					receiverInMap.PaidUsd += payment.Amount
+					receiverInMap.PaidUsd += amount
 					senderInMap.GotPaidNum++
-					senderInMap.GotPaidUsd += payment.Amount
+					senderInMap.GotPaidUsd += amount
 				}
 			}
 		}
@@ -601,9 +625,11 @@ func (a *apiUser) getAdminReportSummary(w http.ResponseWriter, r *http.Request)
 	}
 
 	reportSummary.TotalAmount = totalAmount
+	reportSummary.TotalTax = totalTax
 	reportSummary.PaidInvoices = paidInfo
 	reportSummary.PayableInvoices = pendingInfo
 	reportSummary.SentInvoices = sentInfo
+	reportSummary.CreditNotes = creditInfo
 
 	if startIndex > len(userIds)-1 {
 		reportSummary.UserUsageSummary = userUsageArr
@@ -716,11 +742,14 @@ func (a *apiUser) getAdminReportSummaryBanGoc(w http.ResponseWriter, r *http.Req
 	}
 	reportSummary := portal.AdminSummaryReport{
 		TotalInvoices: len(payments),
+		Currency:      a.service.ReportingCurrency(),
 	}
 	totalAmount := float64(0)
+	totalTax := float64(0)
 	sentInfo := portal.PaymentStatusSummary{}
 	pendingInfo := portal.PaymentStatusSummary{}
 	paidInfo := portal.PaymentStatusSummary{}
+	creditInfo := portal.PaymentStatusSummary{}
 	usersSummaryMap := make(map[uint64]*portal.UserUsageSummary)
 	userIds := make([]uint64, 0)
 	for _, payment := range payments {
@@ -730,17 +759,37 @@ func (a *apiUser) getAdminReportSummaryBanGoc(w http.ResponseWriter, r *http.Req
 		if !CheckExistOnIntArray(userIds, payment.ReceiverId) {
 			userIds = append(userIds, payment.ReceiverId)
 		}
-		totalAmount += payment.Amount
+		amount, tax, err := a.service.ToReportingAmount(payment)
+		if err != nil {
+			utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+			return
+		}
+		if payment.IsCreditNote() {
+			if payment.Status == storage.PaymentStatusPaid {
+				// the refunded credit notes have a negative amount, they net against the paid invoices in the totals
+				creditInfo.InvoiceNum++
+				creditInfo.Amount += amount
+				creditInfo.Tax += tax
+			} else {
+				// the credit note is not refunded yet, it does not change the totals
+				amount, tax = 0, 0
+			}
+		}
+		totalAmount += amount
+		totalTax += tax
 		switch payment.Status {
 		case storage.PaymentStatusConfirmed:
 			pendingInfo.InvoiceNum++
-			pendingInfo.Amount += payment.Amount
+			pendingInfo.Amount += amount
+			pendingInfo.Tax += tax
 		case storage.PaymentStatusPaid:
 			paidInfo.InvoiceNum++
-			paidInfo.Amount += payment.Amount
+			paidInfo.Amount += amount
+			paidInfo.Tax += tax
 		default:
 			sentInfo.InvoiceNum++
-			sentInfo.Amount += payment.Amount
+			sentInfo.Amount += amount
+			sentInfo.Tax += tax
 		}
 		senderId := payment.SenderId
 		receiverId := payment.ReceiverId
@@ -750,30 +799,30 @@ func (a *apiUser) getAdminReportSummaryBanGoc(w http.ResponseWriter, r *http.Req
 		receiverInMap = usersSummaryMap[receiverId]
 		if senderInMap != nil {
 			senderInMap.SendNum++
-			senderInMap.SentUsd = payment.Amount
+			senderInMap.SentUsd = amount
 		} else {
 			senderInMap = &portal.UserUsageSummary{
 				Username: payment.SenderName,
 				SendNum:  1,
-				SentUsd:  payment.Amount,
+				SentUsd:  amount,
 			}
 		}
 
 		if receiverInMap != nil {
 			receiverInMap.ReceiveNum++
-			receiverInMap.ReceiveUsd = payment.Amount
+			receiverInMap.ReceiveUsd = amount
 		} else {
 			receiverInMap = &portal.UserUsageSummary{
 				Username:   payment.ReceiverName,
 				ReceiveNum: 1,
-				ReceiveUsd: payment.Amount,
+				ReceiveUsd: amount,
 				PaidNum:    0,
 				PaidUsd:    0,
 			}
 		}
 		if payment.Status == storage.PaymentStatusPaid {
 			receiverInMap.PaidNum++
-			receiverInMap.PaidUsd = payment.Amount
+			receiverInMap.PaidUsd = amount
 		}
 		usersSummaryMap[senderId] = senderInMap
 		usersSummaryMap[receiverId] = receiverInMap
@@ -793,9 +842,11 @@ func (a *apiUser) getAdminReportSummaryBanGoc(w http.ResponseWriter, r *http.Req
 	}
 
 	reportSummary.TotalAmount = totalAmount
+	reportSummary.TotalTax = totalTax
 	reportSummary.PaidInvoices = paidInfo
 	reportSummary.PayableInvoices = pendingInfo
 	reportSummary.SentInvoices = sentInfo
+	reportSummary.CreditNotes = creditInfo
 	if startIndex > len(userIds)-1 {
 		reportSummary.UserUsageSummary = userUsageArr
 		utils.ResponseOK(w, Map{
@@ -908,33 +959,58 @@ func (a *apiUser) getAdminReportSummaryUserDetail(w http.ResponseWriter, r *http
 
 	reportSummary := portal.AdminSummaryReportDetailUser{
 		TotalInvoices: len(payments),
+		Currency:      a.service.ReportingCurrency(),
 	}
 
 	totalAmount := float64(0)
+	totalTax := float64(0)
 	sentInfo := portal.PaymentStatusSummary{}
 	pendingInfo := portal.PaymentStatusSummary{}
 	paidInfo := portal.PaymentStatusSummary{}
+	creditInfo := portal.PaymentStatusSummary{}
 	userDetailUsageArr := make([]portal.UserDetailUsageSummary, 0)
 
 	for _, payment := range payments {
-		totalAmount += payment.Amount
+		amount, tax, err := a.service.ToReportingAmount(payment)
+		if err != nil {
+			utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+			return
+		}
+		rowAmount, rowTax := amount, tax
+		if payment.IsCreditNote() {
+			if payment.Status == storage.PaymentStatusPaid {
+				// the refunded credit notes have a negative amount, they net against the paid invoices in the totals
+				creditInfo.InvoiceNum++
+				creditInfo.Amount += amount
+				creditInfo.Tax += tax
+			} else {
+				// the credit note is not refunded yet, it does not change the totals
+				amount, tax = 0, 0
+			}
+		}
+		totalAmount += amount
+		totalTax += tax
 		switch payment.Status {
 		case storage.PaymentStatusConfirmed:
 			pendingInfo.InvoiceNum++
-			pendingInfo.Amount += payment.Amount
+			pendingInfo.Amount += amount
+			pendingInfo.Tax += tax
 		case storage.PaymentStatusPaid:
 			paidInfo.InvoiceNum++
-			paidInfo.Amount += payment.Amount
+			paidInfo.Amount += amount
+			paidInfo.Tax += tax
 		default:
 			sentInfo.InvoiceNum++
-			sentInfo.Amount += payment.Amount
+			sentInfo.Amount += amount
+			sentInfo.Tax += tax
 		}
 
 		detail := portal.UserDetailUsageSummary{
 			Sender:       payment.SenderName,
 			Receiver:     payment.ReceiverName,
 			Status:       int(payment.Status),
-			Amount:       payment.Amount,
+			Amount:       rowAmount,
+			Tax:          rowTax,
 			AcceptedCoin: payment.PaymentMethod.String(),
 			StartDate:    payment.StartDate,
 			LastEdited:   payment.UpdatedAt,
@@ -1000,9 +1076,11 @@ func (a *apiUser) getAdminReportSummaryUserDetail(w http.ResponseWriter, r *http
 	}
 
 	reportSummary.TotalAmount = totalAmount
+	reportSummary.TotalTax = totalTax
 	reportSummary.PaidInvoices = paidInfo
 	reportSummary.PayableInvoices = pendingInfo
 	reportSummary.SentInvoices = sentInfo
+	reportSummary.CreditNotes = creditInfo
 	reportSummary.UserDetailUsageSummary = userDetailUsageArr
 
 	utils.ResponseOK(w, Map{
@@ -1456,3 +1534,30 @@ func (a *apiUser) getPaymentSetting(w http.ResponseWriter, r *http.Request) {
 
 	utils.ResponseOK(w, res)
 }
+
+// getInvoiceNumbering handles GET /api/user/setting/invoice-number
+func (a *apiUser) getInvoiceNumbering(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	numbering, err := a.service.GetInvoiceNumbering(claims.Id)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, numbering)
+}
+
+// updateInvoiceNumbering handles PUT /api/user/setting/invoice-number
+func (a *apiUser) updateInvoiceNumbering(w http.ResponseWriter, r *http.Request) {
+	claims, _ := a.credentialsInfo(r)
+	var body portal.InvoiceNumberingRequest
+	if err := a.parseJSONAndValidate(r, &body); err != nil {
+		utils.Response(w, http.StatusBadRequest, utils.NewError(err, utils.ErrorBadRequest), nil)
+		return
+	}
+	numbering, err := a.service.UpdateInvoiceNumbering(claims.Id, body)
+	if err != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(err), nil)
+		return
+	}
+	utils.ResponseOK(w, numbering)
+}
@@ -2,4 +2,5 @@ package portal
 
 type ApprovalRequest struct {
 	PaymentId uint64 `json:"paymentId"`
+	Version   int64  `json:"version"`
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/Paytrackpro/paytrack-be/storage"
 	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
 )
 
 type PaymentRequest struct {
@@ -15,9 +16,10 @@ type PaymentRequest struct {
 	// ExternalEmail is the field to send the payment to the person who does not have an account yet
 	ExternalEmail         string                  `validate:"required_if=ContactMethod 1,omitempty,email" json:"externalEmail"`
 	ContactMethod         storage.PaymentContact  `json:"contactMethod"`
-	HourlyRate            float64                 `json:"hourlyRate"`
+	HourlyRate            decimal.Decimal         `json:"hourlyRate"`
 	PaymentSettings       storage.PaymentSettings `json:"paymentSettings" gorm:"type:jsonb"`
-	Amount                float64                 `json:"amount"`
+	Amount                decimal.Decimal         `json:"amount"`
+	Currency              utils.Currency          `json:"currency"`
 	Description           string                  `json:"description"`
 	Details               []storage.PaymentDetail `json:"details"`
 	PaymentMethod         utils.Method            `json:"paymentMethod"`
@@ -34,58 +36,84 @@ type PaymentRequest struct {
 	PaymentType           utils.Type              `json:"-"`
 	PaymentCode           string                  `json:"-"`
 	UserPaymentMethodId   *uint64                 `json:"userPaymentMethodId"`
+
+	// TaxRate is the tax percentage of the lines without their own rate, Discount is taken off the subtotal.
+	// Subtotal and TaxAmount are checked against the lines when they are sent
+	TaxRate   decimal.Decimal `json:"taxRate"`
+	Discount  decimal.Decimal `json:"discount"`
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	TaxAmount decimal.Decimal `json:"taxAmount"`
+
+	// Version is the version of the payment the client edited, the If-Match header is used when it is sent
+	Version int64 `json:"version"`
 }
 
 type PaymentConfirm struct {
-	Id             uint64       `validate:"required" json:"id"`
-	TxId           string       `json:"txId"`
-	Token          string       `json:"token"`
-	ConvertRate    float64      `json:"convertRate"`
-	ConvertTime    time.Time    `json:"convertTime"`
-	ExpectedAmount float64      `json:"expectedAmount"`
-	PaymentMethod  utils.Method `validate:"required" json:"paymentMethod"`
-	PaymentAddress string       `validate:"required" json:"paymentAddress"`
+	Id             uint64          `validate:"required" json:"id"`
+	TxId           string          `json:"txId"`
+	Token          string          `json:"token"`
+	QuoteId        uint64          `validate:"required" json:"quoteId"`
+	ConvertRate    decimal.Decimal `json:"convertRate"`
+	ConvertTime    time.Time       `json:"convertTime"`
+	ExpectedAmount decimal.Decimal `json:"expectedAmount"`
+	PaymentMethod  utils.Method    `validate:"required" json:"paymentMethod"`
+	PaymentNetwork utils.Network   `json:"paymentNetwork"`
+	PaymentAddress string          `validate:"required" json:"paymentAddress"`
 }
 
 type PaymentUrlConfirm struct {
-	Id             uint64       `validate:"required" json:"id"`
-	TxId           string       `json:"txId"`
-	Token          string       `json:"token"`
-	PayerId        uint64       `json:"payerId"`
-	ConvertRate    float64      `json:"convertRate"`
-	ConvertTime    time.Time    `json:"convertTime"`
-	ExpectedAmount float64      `json:"expectedAmount"`
-	PaymentMethod  utils.Method `validate:"required" json:"paymentMethod"`
-	PaymentAddress string       `validate:"required" json:"paymentAddress"`
-}
-
-func (p *PaymentConfirm) Process(payment *storage.Payment) {
-	payment.TxId = p.TxId
-	payment.PaidAt = time.Now()
-	payment.Status = storage.PaymentStatusPaid
-	payment.ConvertRate = p.ConvertRate
-	payment.ConvertTime = p.ConvertTime
-	payment.ExpectedAmount = p.ExpectedAmount
-	payment.PaymentMethod = p.PaymentMethod
-	payment.PaymentAddress = p.PaymentAddress
-}
-func (p *PaymentUrlConfirm) ProcessPayUrl(payment *storage.Payment) {
-	payment.TxId = p.TxId
-	payment.PaidAt = time.Now()
-	payment.Status = storage.PaymentStatusPaid
-	payment.ConvertRate = p.ConvertRate
-	payment.ConvertTime = p.ConvertTime
-	payment.ExpectedAmount = p.ExpectedAmount
-	payment.PaymentMethod = p.PaymentMethod
-	payment.PaymentAddress = p.PaymentAddress
+	Id             uint64          `validate:"required" json:"id"`
+	TxId           string          `json:"txId"`
+	Token          string          `json:"token"`
+	PayerId        uint64          `json:"payerId"`
+	QuoteId        uint64          `validate:"required" json:"quoteId"`
+	ConvertRate    decimal.Decimal `json:"convertRate"`
+	ConvertTime    time.Time       `json:"convertTime"`
+	ExpectedAmount decimal.Decimal `json:"expectedAmount"`
+	PaymentMethod  utils.Method    `validate:"required" json:"paymentMethod"`
+	PaymentNetwork utils.Network   `json:"paymentNetwork"`
+	PaymentAddress string          `validate:"required" json:"paymentAddress"`
+}
+
+// Transaction returns the transaction paying the quoted part of the payment
+func (p *PaymentConfirm) Transaction(quote *storage.RateQuote) *storage.PaymentTransaction {
+	return &storage.PaymentTransaction{
+		QuoteId:        quote.Id,
+		PaymentMethod:  p.PaymentMethod,
+		PaymentNetwork: p.PaymentNetwork,
+		PaymentAddress: p.PaymentAddress,
+		TxId:           p.TxId,
+		Amount:         quote.Amount,
+		ConvertRate:    quote.Rate,
+		ConvertTime:    quote.CreatedAt,
+		ExpectedAmount: quote.ExpectedAmount,
+	}
+}
+
+// Transaction returns the transaction paying the quoted part of the payment
+func (p *PaymentUrlConfirm) Transaction(quote *storage.RateQuote) *storage.PaymentTransaction {
+	return &storage.PaymentTransaction{
+		QuoteId:        quote.Id,
+		PaymentMethod:  p.PaymentMethod,
+		PaymentNetwork: p.PaymentNetwork,
+		PaymentAddress: p.PaymentAddress,
+		TxId:           p.TxId,
+		Amount:         quote.Amount,
+		ConvertRate:    quote.Rate,
+		ConvertTime:    quote.CreatedAt,
+		ExpectedAmount: quote.ExpectedAmount,
+	}
 }
 
 type PaymentRequestRate struct {
-	Id             uint64       `json:"id" validate:"required"`
-	Token          string       `json:"token"`
-	PaymentMethod  utils.Method `json:"paymentMethod"`
-	PaymentAddress string       `json:"paymentAddress"`
-	Exchange       string       `json:"exchange"`
+	Id             uint64        `json:"id" validate:"required"`
+	Token          string        `json:"token"`
+	PaymentMethod  utils.Method  `json:"paymentMethod"`
+	PaymentNetwork utils.Network `json:"paymentNetwork"`
+	PaymentAddress string        `json:"paymentAddress"`
+	Exchange       string        `json:"exchange"`
+	// Amount is the part of the payment to pay, the remaining balance is quoted when it is empty
+	Amount decimal.Decimal `json:"amount"`
 }
 
 type ListPaymentSettingRequest struct {
@@ -102,20 +130,71 @@ type PaymentReject struct {
 	Id              uint64 `json:"id" validate:"required"`
 	Token           string `json:"token"`
 	RejectionReason string `json:"rejectionReason"`
+	Version         int64  `json:"version"`
 }
 
-type BulkPaymentBTC struct {
-	ID             int          `json:"id"`
-	Rate           float64      `json:"rate"`
-	ConvertTime    int64        `json:"convertTime"`
-	PaymentAddress string       `json:"paymentAddress"`
-	PaymentMethod  utils.Method `json:"paymentMethod"`
-	PaymentToken   string       `json:"token"`
+type BulkPayment struct {
+	ID             int             `json:"id"`
+	Rate           decimal.Decimal `json:"rate"`
+	ConvertTime    int64           `json:"convertTime"`
+	PaymentAddress string          `json:"paymentAddress"`
+	PaymentMethod  utils.Method    `json:"paymentMethod"`
+	PaymentToken   string          `json:"token"`
 }
 
+// BulkPaidRequests marks the payments paid by one transaction of the coin on the network.
+// The network defaults to the default network of the coin
 type BulkPaidRequests struct {
-	TxId        string           `json:"txId"`
-	PaymentList []BulkPaymentBTC `json:"paymentList"`
+	PaymentMethod  utils.Method  `json:"paymentMethod"`
+	PaymentNetwork utils.Network `json:"paymentNetwork"`
+	TxId           string        `json:"txId"`
+	// QuoteId is the bulk rate quote returned by /bulk-rate, the payments are paid at its rate
+	QuoteId     uint64        `json:"quoteId"`
+	PaymentList []BulkPayment `json:"paymentList"`
+}
+
+// BulkPayQuery selects the coin and the network to pay in bulk, the network defaults to the default network of the coin
+type BulkPayQuery struct {
+	Coin    utils.Method  `schema:"coin"`
+	Network utils.Network `schema:"network"`
+}
+
+// BulkPsbtRequest builds the unsigned transaction paying the BTC payments of the list at their locked rate.
+// The inputs are the utxos of the list or the unspent outputs of the wallet extended public key
+type BulkPsbtRequest struct {
+	// QuoteId is the bulk rate quote returned by /bulk-rate, the outputs pay the payments at its rate
+	QuoteId     uint64        `json:"quoteId"`
+	PaymentList []BulkPayment `json:"paymentList"`
+	Utxos       []PsbtUtxo    `json:"utxos"`
+	ExtendedKey string        `json:"extendedKey"`
+	// ChangeAddress defaults to the first unused change address of the extended public key
+	ChangeAddress string `json:"changeAddress"`
+	// FeeRate is the fee rate of the transaction in sat/vB, it is capped so a wrong value can not spend the inputs in fees
+	FeeRate int64 `validate:"gt=0,lte=1000" json:"feeRate"`
+}
+
+type PsbtUtxo struct {
+	TxId    string          `json:"txId"`
+	Vout    uint32          `json:"vout"`
+	Amount  decimal.Decimal `json:"amount"`
+	Address string          `json:"address"`
+}
+
+type BulkPsbtResponse struct {
+	// Psbt is the base64 encoded unsigned BIP-174 transaction
+	Psbt          string           `json:"psbt"`
+	Inputs        []PsbtUtxo       `json:"inputs"`
+	Outputs       []BulkPsbtOutput `json:"outputs"`
+	ChangeAddress string           `json:"changeAddress"`
+	Change        decimal.Decimal  `json:"change"`
+	Fee           decimal.Decimal  `json:"fee"`
+}
+
+// BulkPsbtOutput pays the payments sharing the address
+type BulkPsbtOutput struct {
+	Address    string          `json:"address"`
+	Amount     decimal.Decimal `json:"amount"`
+	PaymentIds []uint64        `json:"paymentIds"`
 }
 
 type BulkPaidRequest struct {
@@ -130,13 +209,31 @@ type GetRateRequest struct {
 type GetRateResponse struct {
 	Rate        float64 `json:"rate"`
 	ConvertTime int64   `json:"convertTime"`
+	// QuoteId locks the rate for the bulk payment until ExpiresAt
+	QuoteId   uint64    `json:"quoteId,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
 }
 type PaymentSummary struct {
-	RequestReceived uint64  `json:"requestReceived"`
-	RequestSent     uint64  `json:"requestSent"`
-	RequestPaid     uint64  `json:"requestPaid"`
-	TotalPaid       float64 `json:"totalPaid"`
-	TotalReceived   float64 `json:"totalReceived"`
+	RequestReceived uint64          `json:"requestReceived"`
+	RequestSent     uint64          `json:"requestSent"`
+	RequestPaid     uint64          `json:"requestPaid"`
+	TotalPaid       decimal.Decimal `json:"totalPaid"`
+	TotalReceived   decimal.Decimal `json:"totalReceived"`
+	// TotalPaidTax and TotalReceivedTax are the tax included in the totals
+	TotalPaidTax     decimal.Decimal `json:"totalPaidTax"`
+	TotalReceivedTax decimal.Decimal `json:"totalReceivedTax"`
+	// Currency is the reporting currency the totals are converted to
+	Currency                utils.Currency                     `json:"currency"`
+	TotalPaidByCurrency     map[utils.Currency]decimal.Decimal `json:"totalPaidByCurrency"`
+	TotalReceivedByCurrency map[utils.Currency]decimal.Decimal `json:"totalReceivedByCurrency"`
+}
+
+// UnpaidTotal is the unpaid amount of the listed payments
+type UnpaidTotal struct {
+	// Total is converted to the reporting currency
+	Total           decimal.Decimal                    `json:"total"`
+	Currency        utils.Currency                     `json:"currency"`
+	TotalByCurrency map[utils.Currency]decimal.Decimal `json:"totalByCurrency"`
 }
 
 type SummaryFilter struct {
@@ -150,10 +247,18 @@ type PaymentReport struct {
 }
 
 type PaymentReportUnit struct {
-	DisplayName    string       `json:"displayName"`
-	Amount         float64      `json:"amount"`
-	ExpectedAmount float64      `json:"expectedAmount"`
-	PaymentMethod  utils.Method `json:"paymentMethod"`
+	InvoiceNumber  string          `json:"invoiceNumber"`
+	DisplayName    string          `json:"displayName"`
+	Amount         decimal.Decimal `json:"amount"`
+	ExpectedAmount decimal.Decimal `json:"expectedAmount"`
+	PaymentMethod  utils.Method    `json:"paymentMethod"`
+	// Subtotal, Discount and Tax break the amount down, TaxLines is the tax of each rate
+	Subtotal decimal.Decimal  `json:"subtotal"`
+	Discount decimal.Decimal  `json:"discount"`
+	Tax      decimal.Decimal  `json:"tax"`
+	TaxLines storage.TaxLines `json:"taxLines"`
+	// CreditNoteOf is the payment the refunded credit note nets against
+	CreditNoteOf uint64 `json:"creditNoteOf,omitempty"`
 }
 
 type InvoiceReport struct {
@@ -163,9 +268,10 @@ type InvoiceReport struct {
 }
 
 type InvoiceReportUnit struct {
-	Date        string  `json:"date"`
-	Hours       float64 `json:"hours"`
-	Description string  `json:"description"`
+	InvoiceNumber string          `json:"invoiceNumber"`
+	Date          string          `json:"date"`
+	Hours         decimal.Decimal `json:"hours"`
+	Description   string          `json:"description"`
 }
 type AddressReport struct {
 	PaymentMethod string              `json:"paymentMethod"`
@@ -174,9 +280,10 @@ type AddressReport struct {
 }
 
 type AddressReportUnit struct {
-	DateTime       string  `json:"dateTime"`
-	Amount         float64 `json:"amount"`
-	ExpectedAmount float64 `json:"expectedAmount"`
+	InvoiceNumber  string          `json:"invoiceNumber"`
+	DateTime       string          `json:"dateTime"`
+	Amount         decimal.Decimal `json:"amount"`
+	ExpectedAmount decimal.Decimal `json:"expectedAmount"`
 }
 
 type ReportFilter struct {
@@ -185,3 +292,98 @@ type ReportFilter struct {
 	MemberIds  string
 	ProjectIds string
 }
+
+// RateHistoryRequest queries the rate of a coin at a timestamp (At) or over a range (From, To).
+// The median rate over the exchanges is used when the exchange is empty. The samples of a range are
+// averaged by Interval (a duration such as 15m or 1h) when it is set
+type RateHistoryRequest struct {
+	Coin        utils.Method `schema:"coin"`
+	Exchange    string       `schema:"exchange"`
+	At          time.Time    `schema:"at"`
+	From        time.Time    `schema:"from"`
+	To          time.Time    `schema:"to"`
+	Interval    string       `schema:"interval"`
+	Interpolate bool         `schema:"interpolate"`
+}
+
+// RateSamples are the samples of a range. Truncated is set when the range has more samples than the limit,
+// only the first ones are returned and a larger interval returns the whole range
+type RateSamples struct {
+	Samples   []storage.RateSample `json:"samples"`
+	Interval  string               `json:"interval,omitempty"`
+	Truncated bool                 `json:"truncated"`
+}
+
+type HistoricalRate struct {
+	Coin     utils.Method `json:"coin"`
+	Exchange string       `json:"exchange"`
+	Rate     float64      `json:"rate"`
+	At       time.Time    `json:"at"`
+	// SampledAt is the time of the nearest sample, it is empty when the rate is interpolated
+	SampledAt    *time.Time `json:"sampledAt,omitempty"`
+	Interpolated bool       `json:"interpolated"`
+}
+
+// RecurringPaymentRequest creates or updates a recurring schedule of the template payment.
+// Interval defaults to 1 for the weekly and monthly frequencies and is the number of days for the custom one
+type RecurringPaymentRequest struct {
+	TemplateId uint64                      `validate:"required" json:"templateId"`
+	Name       string                      `json:"name"`
+	Frequency  storage.RecurrenceFrequency `validate:"required" json:"frequency"`
+	Interval   int                         `validate:"gte=0" json:"interval"`
+	StartAt    time.Time                   `validate:"required" json:"startAt"`
+	EndDate    *time.Time                  `json:"endDate"`
+	AutoSend   bool                        `json:"autoSend"`
+}
+
+// CreditNoteRequest credits a part or all of the amount of a paid payment. Amount is the credited amount
+// in the currency of the payment, the credit note is saved with the negative amount
+type CreditNoteRequest struct {
+	PaymentId     uint64                `validate:"required" json:"paymentId"`
+	Amount        decimal.Decimal       `json:"amount"`
+	Reason        string                `validate:"required" json:"reason"`
+	Description   string                `json:"description"`
+	RefundAddress string                `json:"refundAddress"`
+	RefundTxId    string                `json:"refundTxId"`
+	Status        storage.PaymentStatus `json:"status"`
+	Version       int64                 `json:"version"`
+}
+
+// CreditNoteRefund settles an approved credit note, the credit is kept by the receiver when there is no refund tx
+type CreditNoteRefund struct {
+	RefundAddress string `json:"refundAddress"`
+	RefundTxId    string `json:"refundTxId"`
+	Version       int64  `json:"version"`
+}
+
+// DisputeRequest opens a dispute on the payment, Lines are the disputed line numbers of the details starting at 1
+type DisputeRequest struct {
+	Reason  string `validate:"required" json:"reason"`
+	Lines   []int  `json:"lines"`
+	Version int64  `json:"version"`
+}
+
+type DisputeMessageRequest struct {
+	Message string `validate:"required" json:"message"`
+}
+
+// DisputeRevision is the revised version of the disputed payment the sender resubmits
+type DisputeRevision struct {
+	Message     string                  `json:"message"`
+	Description string                  `json:"description"`
+	HourlyRate  decimal.Decimal         `json:"hourlyRate"`
+	Amount      decimal.Decimal         `json:"amount"`
+	Details     []storage.PaymentDetail `json:"details"`
+	TaxRate     decimal.Decimal         `json:"taxRate"`
+	Discount    decimal.Decimal         `json:"discount"`
+	Subtotal    decimal.Decimal         `json:"subtotal"`
+	TaxAmount   decimal.Decimal         `json:"taxAmount"`
+	Version     int64                   `json:"version"`
+}
+
+// DisputeResolution resolves the dispute, it is accepted by the receiver or withdrawn by the sender
+type DisputeResolution struct {
+	Status  storage.DisputeStatus `json:"status"`
+	Message string                `json:"message"`
+	Version int64                 `json:"version"`
+}
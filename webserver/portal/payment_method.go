@@ -11,7 +11,9 @@ type CreatePaymentMethodRequest struct {
 	Label   string `json:"label" validate:"required"`
 	Coin    string `json:"coin" validate:"required"`
 	Network string `json:"network" validate:"required"` // Network code (e.g., "btc", "erc20")
-	Address string `json:"address" validate:"required"`
+	Address string `json:"address" validate:"required_without=ExtendedKey"`
+	// ExtendedKey is a watch-only extended public key used instead of a static address (btc, ltc and dcr networks)
+	ExtendedKey string `json:"extendedKey" validate:"required_without=Address"`
 }
 
 // UpdatePaymentMethodRequest represents the request to update a payment method (only label can be updated)
@@ -11,4 +11,5 @@ type ProjectRequest struct {
 	CreatorId      uint64          `json:"CreatorId"`
 	TargetOwnerId  uint64          `json:"targetOwnerId"`
 	TargetMergeIds string          `json:"targetMergeIds"`
+	Version        int64           `json:"version"`
 }
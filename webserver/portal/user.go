@@ -51,18 +51,24 @@ type GenerateQRForm struct {
 type AdminSummaryReport struct {
 	TotalInvoices    int                  `json:"totalInvoices"`
 	TotalAmount      float64              `json:"totalAmount"`
+	TotalTax         float64              `json:"totalTax"`
+	Currency         utils.Currency       `json:"currency"`
 	SentInvoices     PaymentStatusSummary `json:"sentInvoices"`
 	PayableInvoices  PaymentStatusSummary `json:"payableInvoices"`
 	PaidInvoices     PaymentStatusSummary `json:"paidInvoices"`
+	CreditNotes      PaymentStatusSummary `json:"creditNotes"`
 	UserUsageSummary []UserUsageSummary   `json:"userUsageSummary"`
 }
 
 type AdminSummaryReportDetailUser struct {
 	TotalInvoices          int                      `json:"totalInvoices"`
 	TotalAmount            float64                  `json:"totalAmount"`
+	TotalTax               float64                  `json:"totalTax"`
+	Currency               utils.Currency           `json:"currency"`
 	SentInvoices           PaymentStatusSummary     `json:"sentInvoices"`
 	PayableInvoices        PaymentStatusSummary     `json:"payableInvoices"`
 	PaidInvoices           PaymentStatusSummary     `json:"paidInvoices"`
+	CreditNotes            PaymentStatusSummary     `json:"creditNotes"`
 	UserDetailUsageSummary []UserDetailUsageSummary `json:"userDetailUsageSummary"`
 }
 
@@ -83,14 +89,17 @@ type UserDetailUsageSummary struct {
 	Receiver     string    `json:"receiver"`
 	Status       int       `json:"status"`
 	Amount       float64   `json:"amount"`
+	Tax          float64   `json:"tax"`
 	AcceptedCoin string    `json:"acceptedCoin"`
 	StartDate    time.Time `json:"startDate"`
 	LastEdited   time.Time `json:"lastEdited"`
 }
 
+// PaymentStatusSummary is the number of invoices, their amount and the tax included in the amount
 type PaymentStatusSummary struct {
 	InvoiceNum uint64  `json:"invoiceNum"`
 	Amount     float64 `json:"amount"`
+	Tax        float64 `json:"tax"`
 }
 
 func (f RegisterForm) User() (*storage.User, error) {
@@ -184,3 +193,10 @@ type TimerUpdateRequest struct {
 	ProjectId   int64  `json:"projectId"`
 	Description string `json:"description"`
 }
+
+// InvoiceNumberingRequest updates the numbering scheme of the invoices of the sender
+type InvoiceNumberingRequest struct {
+	Prefix      string `validate:"max=20" json:"prefix"`
+	YearlyReset bool   `json:"yearlyReset"`
+	Padding     int    `validate:"gte=0,lte=12" json:"padding"`
+}
@@ -12,8 +12,8 @@ func (s *WebServer) Route() {
 	s.mux.Use(middleware.Recoverer, cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Logintype", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Logintype", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "Content-Disposition", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -66,6 +66,8 @@ func (s *WebServer) Route() {
 			r.Route("/setting", func(r chi.Router) {
 				r.Get("/payment", userRouter.getPaymentSetting)
 				r.Put("/payment", userRouter.updatePaymentSetting)
+				r.Get("/invoice-number", userRouter.getInvoiceNumbering)
+				r.Put("/invoice-number", userRouter.updateInvoiceNumbering)
 			})
 			r.Route("/payment-methods", func(r chi.Router) {
 				var paymentMethodRouter = apiPaymentMethod{WebServer: s}
@@ -73,6 +75,7 @@ func (s *WebServer) Route() {
 				r.Get("/", paymentMethodRouter.getPaymentMethods)
 				r.Put("/{id:[0-9]+}", paymentMethodRouter.updatePaymentMethod)
 				r.Delete("/{id:[0-9]+}", paymentMethodRouter.deletePaymentMethod)
+				r.Get("/{id:[0-9]+}/addresses", paymentMethodRouter.getDerivedAddresses)
 				r.Post("/validate-address", paymentMethodRouter.validateAddress)
 			})
 			r.Post("/start_timer", userRouter.startTimer)
@@ -115,34 +118,68 @@ func (s *WebServer) Route() {
 		r.Route("/payment", func(r chi.Router) {
 			r.Use(s.loggedInMiddleware)
 			var paymentRouter = apiPayment{WebServer: s}
+			var creditNoteRouter = apiCreditNote{WebServer: s}
+			var disputeRouter = apiDispute{WebServer: s}
 			r.Post("/", paymentRouter.createPayment)
 			r.Post("/create-url", paymentRouter.createPaymentUrl)
 			r.Get("/{id:[0-9]+}", paymentRouter.getPayment)
+			r.Get("/{id:[0-9]+}/pdf", paymentRouter.getPaymentPdf)
+			r.Get("/{id:[0-9]+}/events", paymentRouter.getPaymentEvents)
+			r.Get("/{id:[0-9]+}/credit-notes", creditNoteRouter.getCreditNotes)
+			r.Post("/{id:[0-9]+}/dispute", disputeRouter.openDispute)
+			r.Get("/{id:[0-9]+}/disputes", disputeRouter.getDisputes)
 			r.Post("/create-url/{id:[0-9]+}", paymentRouter.updatePayment)
 			r.Post("/{id:[0-9]+}", paymentRouter.updatePayment)
 			r.Post("/request-rate", paymentRouter.requestRate)
 			r.Post("/process", paymentRouter.processPayment)
 			r.Post("/approve", paymentRouter.approveRequest)
 			r.Post("/reject", paymentRouter.rejectPayment)
-			r.Post("/bulk-paid-btc", paymentRouter.bulkPaidBTC)
+			r.Post("/bulk-paid", paymentRouter.bulkPaid)
+			r.Post("/bulk-paid-btc", paymentRouter.bulkPaid)
+			r.Post("/bulk-psbt", paymentRouter.bulkPsbt)
 			r.Get("/list", paymentRouter.listPayments)
-			r.Get("/btc-bulk-rate", paymentRouter.getBtcBulkRate)
+			r.Get("/bulk-rate", paymentRouter.getBulkRate)
+			r.Get("/btc-bulk-rate", paymentRouter.getBulkRate)
 			r.Delete("/delete/{id:[0-9]+}", paymentRouter.deleteDraft)
 			r.Get("/monthly-summary", paymentRouter.getMonthlySummary)
 			r.Get("/initialization-count", paymentRouter.getInitializationCount)
-			r.Get("/bulk-pay-count", paymentRouter.countBulkPayBTC)
+			r.Get("/bulk-pay-count", paymentRouter.countBulkPay)
 			r.Get("/has-report", paymentRouter.hasReport)
 			r.Get("/payment-report", paymentRouter.paymentReport)
 			r.Get("/invoice-report", paymentRouter.invoiceReport)
 			r.Get("/address-report", paymentRouter.addressReport)
 			r.Get("/exchange-list", paymentRouter.getExchangeList)
+			r.Get("/rate-history", paymentRouter.getRateHistory)
+			r.Get("/currencies", paymentRouter.getCurrencies)
 			r.Get("/get-payment-users", paymentRouter.getPaymentUsers)
+			r.Route("/credit-note", func(r chi.Router) {
+				r.Post("/", creditNoteRouter.createCreditNote)
+				r.Put("/{id:[0-9]+}", creditNoteRouter.updateCreditNote)
+				r.Post("/{id:[0-9]+}/refund", creditNoteRouter.refundCreditNote)
+			})
+			r.Route("/dispute", func(r chi.Router) {
+				r.Post("/{id:[0-9]+}/message", disputeRouter.addDisputeMessage)
+				r.Post("/{id:[0-9]+}/revise", disputeRouter.reviseDisputedPayment)
+				r.Post("/{id:[0-9]+}/resolve", disputeRouter.resolveDispute)
+			})
+			r.Route("/recurring", func(r chi.Router) {
+				var recurringRouter = apiRecurringPayment{WebServer: s}
+				r.Post("/", recurringRouter.createRecurringPayment)
+				r.Get("/", recurringRouter.getRecurringPayments)
+				r.Get("/{id:[0-9]+}", recurringRouter.getRecurringPayment)
+				r.Put("/{id:[0-9]+}", recurringRouter.updateRecurringPayment)
+				r.Post("/{id:[0-9]+}/pause", recurringRouter.pauseRecurringPayment)
+				r.Post("/{id:[0-9]+}/resume", recurringRouter.resumeRecurringPayment)
+				r.Delete("/{id:[0-9]+}", recurringRouter.deleteRecurringPayment)
+			})
 		})
 		r.Route("/payment-url", func(r chi.Router) {
 			var paymentRouter = apiPayment{WebServer: s}
 			r.Post("/request-rate", paymentRouter.requestRateForPayUrl)
 			r.Get("/exchange-list", paymentRouter.getExchangeList)
 			r.Get("/pay/{id:[0-9]+}/{code}", paymentRouter.getPaymentUrl)
+			r.Get("/pay/{id:[0-9]+}/{code}/pdf", paymentRouter.getPaymentUrlPdf)
+			r.Get("/{id:[0-9]+}/pdf", paymentRouter.getPaymentPdfWithToken)
 			r.Post("/process", paymentRouter.processPaymentUrl)
 		})
 		r.Route("/project", func(r chi.Router) {
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/Paytrackpro/paytrack-be/authpb"
 	"github.com/Paytrackpro/paytrack-be/storage"
@@ -12,23 +13,45 @@ import (
 )
 
 type Config struct {
-	Exchange        string `yaml:"exchange"`
-	ExchangeList    string `yaml:"allowexchanges"`
-	CoimarketcapKey string `yaml:"coimarketcapKey"`
-	AuthType        int    `yaml:"authType"`
-	AuthHost        string `yaml:"authHost"`
-	BaseUrl         string `yaml:"baseUrl"`
+	Exchange        string      `yaml:"exchange"`
+	ExchangeList    string      `yaml:"allowexchanges"`
+	CoimarketcapKey string      `yaml:"coimarketcapKey"`
+	AuthType        int         `yaml:"authType"`
+	AuthHost        string      `yaml:"authHost"`
+	BaseUrl         string      `yaml:"baseUrl"`
+	Chain           ChainConfig `yaml:"chain"`
+	// RateProviders configures the exchanges the rates are requested from
+	RateProviders []RateProviderConfig `yaml:"rateProviders"`
+	// RateCacheTTL is the number of seconds the rates of the exchanges are cached
+	RateCacheTTL int `yaml:"rateCacheTtl"`
+	// RateOutlierThreshold is the deviation from the median rate (percent) over which the rate of an exchange is discarded
+	RateOutlierThreshold float64 `yaml:"rateOutlierThreshold"`
+	// RateSampleRawDays is the number of days the rate samples are kept as sampled, the older ones are averaged per hour
+	RateSampleRawDays int `yaml:"rateSampleRawDays"`
+	// RateSampleRetentionDays is the number of days the hourly rate samples are kept, they are kept forever when it is 0
+	RateSampleRetentionDays int `yaml:"rateSampleRetentionDays"`
+	// Fx configures the fiat rates of the invoices not issued in USD
+	Fx FxConfig `yaml:"fx"`
+	// GapLimit is the number of unpaid addresses that can be derived from an extended key in a row
+	GapLimit int `yaml:"gapLimit"`
+	// QuoteTTL is the number of seconds a rate quote can be used to pay a payment
+	QuoteTTL int `yaml:"quoteTtl"`
 }
 
 type Service struct {
-	db              *gorm.DB
-	Conf            Config
-	exchange        string
-	ExchangeList    string
-	coinMaketCapKey string
-	timeState       *actionTimeState
-	socket          *socketio.Server
-	AuthClient      *authpb.AuthServiceClient
+	db            *gorm.DB
+	Conf          Config
+	exchange      string
+	ExchangeList  string
+	timeState     *actionTimeState
+	socket        *socketio.Server
+	AuthClient    *authpb.AuthServiceClient
+	txVerifiers   map[verifierKey]chainVerifier
+	rateMtx       sync.RWMutex
+	rateProviders map[string]RateProvider
+	rateCache     *rateCache
+	fxProvider    FxProvider
+	fxCache       *fxCache
 }
 
 func NewService(conf Config, db *gorm.DB, socket *socketio.Server) *Service {
@@ -37,32 +60,46 @@ func NewService(conf Config, db *gorm.DB, socket *socketio.Server) *Service {
 		authClient = InitAuthClient(conf.AuthHost)
 	}
 	return &Service{
-		db:              db,
-		Conf:            conf,
-		exchange:        conf.Exchange,
-		coinMaketCapKey: conf.CoimarketcapKey,
-		ExchangeList:    conf.ExchangeList,
-		timeState:       NewActionTime(),
-		socket:          socket,
-		AuthClient:      authClient,
+		db:            db,
+		Conf:          conf,
+		exchange:      conf.Exchange,
+		ExchangeList:  conf.ExchangeList,
+		timeState:     NewActionTime(),
+		socket:        socket,
+		AuthClient:    authClient,
+		txVerifiers:   newTxVerifiers(conf.Chain),
+		rateProviders: newRateProviders(conf),
+		rateCache:     newRateCache(),
+		fxProvider:    newFxProvider(conf.Fx),
+		fxCache:       newFxCache(),
 	}
 }
 
-func (s *Service) ApprovePaymentRequest(id, userId uint64) (*storage.Payment, error) {
+func (s *Service) ApprovePaymentRequest(userId uint64, request portal.ApprovalRequest) (*storage.Payment, error) {
 	var payment storage.Payment
-	if err := s.db.First(&payment, "id = ?", id).Error; err != nil {
+	if err := s.db.First(&payment, "id = ?", request.PaymentId).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("payment not found")
 		}
 		return nil, err
 	}
+	if err := storage.CheckVersion(&payment, request.Version); err != nil {
+		return nil, err
+	}
+	before := storage.NewPaymentSnapshot(payment)
 	for i, approver := range payment.Approvers {
 		if approver.ApproverId == userId {
 			payment.Approvers[i].IsApproved = true
 		}
 	}
 
-	if err := s.db.Save(&payment).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := storage.UpdateVersioned(tx, &payment); err != nil {
+			return err
+		}
+		return recordPaymentEvent(tx, before, payment, userId, storage.PaymentActionApproved)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -156,7 +193,9 @@ func (s *Service) UpdateApproverSetting(userId uint64, approvers []portal.Approv
 	}
 
 	//update approver for all payment
+	befores := make([]storage.PaymentSnapshot, len(payments))
 	for i, payment := range payments {
+		befores[i] = storage.NewPaymentSnapshot(*payment)
 		approverMap := make(map[uint64]storage.Approver, 0)
 		for _, approver := range payment.Approvers {
 			approverMap[approver.ApproverId] = approver
@@ -201,9 +240,15 @@ func (s *Service) UpdateApproverSetting(userId uint64, approvers []portal.Approv
 
 	// update payment
 	if len(payments) > 0 {
-		if err := tx.Save(&payments).Error; err != nil {
-			tx.Rollback()
-			return nil, err
+		for i, payment := range payments {
+			if err := storage.UpdateVersioned(tx, payment); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			if err := recordPaymentEvent(tx, befores[i], *payment, userId, storage.PaymentActionUpdated); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
 		}
 	}
 	tx.Commit()
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// walletGapLimit is the number of consecutive unused addresses ending the scan of a wallet extended public key
+	walletGapLimit = 20
+	// dustLimit is the smallest output in satoshis relayed by the bitcoin nodes
+	dustLimit = 546
+	// txOverheadVsize is the size of the version, locktime, counters and segwit marker of a transaction
+	txOverheadVsize = 11
+	// rbfSequence signals the transaction can be replaced to bump its fee
+	rbfSequence = wire.MaxTxInSequenceNum - 2
+)
+
+type walletUtxo struct {
+	outPoint wire.OutPoint
+	value    int64
+	address  string
+	pkScript []byte
+}
+
+// BuildBulkPsbt returns an unsigned BIP-174 transaction paying the BTC payments at the rate of the bulk quote with one output
+// per address. Once the signed transaction is broadcast, its txid marks the payments paid through BulkPaid
+func (s *Service) BuildBulkPsbt(userId uint64, request portal.BulkPsbtRequest) (*portal.BulkPsbtResponse, error) {
+	method, network := utils.PaymentTypeBTC, utils.NetworkBTC
+	payments, err := s.bulkPayablePayments(userId, method, network, request.PaymentList)
+	if err != nil {
+		return nil, err
+	}
+	// the quote is only checked, it is used by the bulk payment recording the broadcast transaction
+	quote, err := s.GetBulkRateQuote(request.QuoteId, userId, method, request.PaymentList)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := s.bulkPaymentRates(payments, quote.Rate)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].Id < payments[j].Id })
+
+	// invoices sharing an address are paid by the same output
+	outputs := make([]*portal.BulkPsbtOutput, 0)
+	outputByAddress := make(map[string]*portal.BulkPsbtOutput)
+	for _, paym := range payments {
+		rate := rates[paym.Id]
+		if !rate.IsPositive() {
+			return nil, utils.NewError(fmt.Errorf("rate is required to pay payment %d", paym.Id), utils.ErrorBadRequest)
+		}
+		output, ok := outputByAddress[paym.PaymentAddress]
+		if !ok {
+			output = &portal.BulkPsbtOutput{Address: paym.PaymentAddress}
+			outputByAddress[paym.PaymentAddress] = output
+			outputs = append(outputs, output)
+		}
+		output.Amount = output.Amount.Add(utils.ConvertToCoin(paym.Amount, rate, method))
+		output.PaymentIds = append(output.PaymentIds, paym.Id)
+	}
+
+	utxos, changeAddress, err := s.bulkPsbtUtxos(request)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.IsEmpty(request.ChangeAddress) {
+		changeAddress = strings.TrimSpace(request.ChangeAddress)
+	}
+	return buildBulkPsbt(outputs, utxos, changeAddress, request.FeeRate)
+}
+
+// buildBulkPsbt spends the utxos to the outputs at the fee rate (sat/vB), the change is sent to the change address
+func buildBulkPsbt(outputs []*portal.BulkPsbtOutput, utxos []walletUtxo, changeAddress string, feeRate int64) (*portal.BulkPsbtResponse, error) {
+	method := utils.PaymentTypeBTC
+	txOuts := make([]*wire.TxOut, 0, len(outputs)+1)
+	var outputTotal, outputsVsize int64
+	for _, output := range outputs {
+		pkScript, err := bitcoinPkScript(output.Address)
+		if err != nil {
+			return nil, utils.NewError(fmt.Errorf("payment address %s: %v", output.Address, err), utils.ErrorBadRequest)
+		}
+		value := toBaseUnits(output.Amount, method.Decimals()).Int64()
+		if value < dustLimit {
+			return nil, utils.NewError(fmt.Errorf("the output of %s BTC to %s is below the dust limit", output.Amount, output.Address), utils.ErrorBadRequest)
+		}
+		txOuts = append(txOuts, wire.NewTxOut(value, pkScript))
+		outputTotal += value
+		outputsVsize += outputVsize(pkScript)
+	}
+
+	// the largest utxos are spent first until they pay the outputs and the fee
+	sort.SliceStable(utxos, func(i, j int) bool { return utxos[i].value > utxos[j].value })
+	selected := make([]walletUtxo, 0)
+	var inputTotal, inputsVsize, fee int64
+	for _, utxo := range utxos {
+		vsize, err := inputVsize(utxo.pkScript)
+		if err != nil {
+			return nil, utils.NewError(fmt.Errorf("utxo %s: %v", utxo.outPoint, err), utils.ErrorBadRequest)
+		}
+		selected = append(selected, utxo)
+		inputTotal += utxo.value
+		inputsVsize += vsize
+		fee = feeRate * (txOverheadVsize + inputsVsize + outputsVsize)
+		if inputTotal >= outputTotal+fee {
+			break
+		}
+	}
+	if inputTotal < outputTotal+fee {
+		return nil, utils.NewError(fmt.Errorf("the utxos hold %s BTC, %s BTC is needed to pay the payments and the fee",
+			btcutil.Amount(inputTotal).Format(btcutil.AmountBTC), btcutil.Amount(outputTotal+fee).Format(btcutil.AmountBTC)), utils.ErrorBadRequest)
+	}
+
+	// the change below the dust limit is left to the fee
+	var change int64
+	if !utils.IsEmpty(changeAddress) {
+		changeScript, err := bitcoinPkScript(changeAddress)
+		if err != nil {
+			return nil, utils.NewError(fmt.Errorf("change address %s: %v", changeAddress, err), utils.ErrorBadRequest)
+		}
+		feeWithChange := fee + feeRate*outputVsize(changeScript)
+		if inputTotal-outputTotal-feeWithChange >= dustLimit {
+			change = inputTotal - outputTotal - feeWithChange
+			txOuts = append(txOuts, wire.NewTxOut(change, changeScript))
+		}
+	} else if inputTotal-outputTotal-fee >= dustLimit {
+		return nil, utils.NewError(fmt.Errorf("a change address is required"), utils.ErrorBadRequest)
+	}
+	fee = inputTotal - outputTotal - change
+
+	outPoints := make([]*wire.OutPoint, 0, len(selected))
+	sequences := make([]uint32, 0, len(selected))
+	for i := range selected {
+		outPoints = append(outPoints, &selected[i].outPoint)
+		sequences = append(sequences, rbfSequence)
+	}
+	packet, err := psbt.New(outPoints, txOuts, 2, 0, sequences)
+	if err != nil {
+		return nil, err
+	}
+	// the legacy inputs need the whole previous transaction, the wallet completes them when it signs
+	for i, utxo := range selected {
+		if txscript.GetScriptClass(utxo.pkScript) != txscript.PubKeyHashTy {
+			packet.Inputs[i].WitnessUtxo = wire.NewTxOut(utxo.value, utxo.pkScript)
+		}
+	}
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &portal.BulkPsbtResponse{
+		Psbt:    encoded,
+		Inputs:  make([]portal.PsbtUtxo, 0, len(selected)),
+		Outputs: make([]portal.BulkPsbtOutput, 0, len(outputs)),
+		Fee:     decimal.New(fee, -method.Decimals()),
+	}
+	for _, utxo := range selected {
+		response.Inputs = append(response.Inputs, portal.PsbtUtxo{
+			TxId:    utxo.outPoint.Hash.String(),
+			Vout:    utxo.outPoint.Index,
+			Amount:  decimal.New(utxo.value, -method.Decimals()),
+			Address: utxo.address,
+		})
+	}
+	for _, output := range outputs {
+		response.Outputs = append(response.Outputs, *output)
+	}
+	if change > 0 {
+		response.ChangeAddress = changeAddress
+		response.Change = decimal.New(change, -method.Decimals())
+	}
+	return response, nil
+}
+
+// bulkPsbtUtxos returns the utxos of the request or the unspent outputs of the wallet extended public key
+// with its first unused change address
+func (s *Service) bulkPsbtUtxos(request portal.BulkPsbtRequest) ([]walletUtxo, string, error) {
+	if len(request.Utxos) == 0 {
+		if utils.IsEmpty(request.ExtendedKey) {
+			return nil, "", utils.NewError(fmt.Errorf("utxos or an extended public key are required"), utils.ErrorBadRequest)
+		}
+		return s.walletUtxos(request.ExtendedKey)
+	}
+	utxos := make([]walletUtxo, 0, len(request.Utxos))
+	seen := make(map[wire.OutPoint]bool)
+	for _, utxo := range request.Utxos {
+		hash, err := chainhash.NewHashFromStr(utxo.TxId)
+		if err != nil {
+			return nil, "", utils.NewError(fmt.Errorf("invalid utxo txid %s", utxo.TxId), utils.ErrorBadRequest)
+		}
+		outPoint := wire.NewOutPoint(hash, utxo.Vout)
+		if seen[*outPoint] {
+			return nil, "", utils.NewError(fmt.Errorf("utxo %s is listed more than once", outPoint), utils.ErrorBadRequest)
+		}
+		seen[*outPoint] = true
+		pkScript, err := bitcoinPkScript(utxo.Address)
+		if err != nil {
+			return nil, "", utils.NewError(fmt.Errorf("utxo address %s: %v", utxo.Address, err), utils.ErrorBadRequest)
+		}
+		value := toBaseUnits(utxo.Amount, utils.PaymentTypeBTC.Decimals()).Int64()
+		if value <= 0 {
+			return nil, "", utils.NewError(fmt.Errorf("the amount of utxo %s:%d must be positive", utxo.TxId, utxo.Vout), utils.ErrorBadRequest)
+		}
+		utxos = append(utxos, walletUtxo{
+			outPoint: *outPoint,
+			value:    value,
+			address:  utxo.Address,
+			pkScript: pkScript,
+		})
+	}
+	return utxos, "", nil
+}
+
+// walletUtxos scans the receive and change addresses of the extended public key on the esplora backend
+// until the gap limit and returns their unspent outputs with the first unused change address
+func (s *Service) walletUtxos(extendedKey string) ([]walletUtxo, string, error) {
+	verifier, _ := s.GetTxVerifier(utils.PaymentTypeBTC, utils.NetworkBTC)
+	esplora, ok := verifier.(*esploraVerifier)
+	if !ok {
+		return nil, "", utils.NewError(fmt.Errorf("an esplora backend for BTC is required to look up the utxos of an extended public key"), utils.ErrorBadRequest)
+	}
+	if err := utils.VerifyExtendedKey(extendedKey, utils.NetworkBTC); err != nil {
+		return nil, "", utils.NewError(err, utils.ErrorBadRequest)
+	}
+	utxos := make([]walletUtxo, 0)
+	changeAddress := ""
+	for _, branch := range []uint32{utils.BranchExternal, utils.BranchInternal} {
+		unused := 0
+		for index := uint32(0); unused < walletGapLimit; index++ {
+			address, err := utils.DeriveBranchAddress(extendedKey, utils.NetworkBTC, branch, index)
+			if err != nil {
+				return nil, "", err
+			}
+			txCount, err := esplora.getAddressTxCount(address)
+			if err != nil {
+				return nil, "", err
+			}
+			if txCount == 0 {
+				if branch == utils.BranchInternal && changeAddress == "" {
+					changeAddress = address
+				}
+				unused++
+				continue
+			}
+			unused = 0
+			addressUtxos, err := esplora.getAddressUtxos(address)
+			if err != nil {
+				return nil, "", err
+			}
+			pkScript, err := bitcoinPkScript(address)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, utxo := range addressUtxos {
+				hash, err := chainhash.NewHashFromStr(utxo.Txid)
+				if err != nil {
+					return nil, "", err
+				}
+				utxos = append(utxos, walletUtxo{
+					outPoint: *wire.NewOutPoint(hash, utxo.Vout),
+					value:    utxo.Value,
+					address:  address,
+					pkScript: pkScript,
+				})
+			}
+		}
+	}
+	if len(utxos) == 0 {
+		return nil, "", utils.NewError(fmt.Errorf("the extended public key has no unspent outputs"), utils.ErrorBadRequest)
+	}
+	return utxos, changeAddress, nil
+}
+
+func bitcoinPkScript(address string) ([]byte, error) {
+	decoded, err := btcutil.DecodeAddress(strings.TrimSpace(address), &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bitcoin address")
+	}
+	return txscript.PayToAddrScript(decoded)
+}
+
+// inputVsize returns the virtual size of an input spending the script, the script hash outputs are expected
+// to be nested segwit as the ones derived from a ypub
+func inputVsize(pkScript []byte) (int64, error) {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.WitnessV0PubKeyHashTy:
+		return 68, nil
+	case txscript.WitnessV1TaprootTy:
+		return 58, nil
+	case txscript.ScriptHashTy:
+		return 91, nil
+	case txscript.PubKeyHashTy:
+		return 148, nil
+	}
+	return 0, fmt.Errorf("only single key inputs are supported")
+}
+
+func outputVsize(pkScript []byte) int64 {
+	// value, script length and script
+	return 8 + 1 + int64(len(pkScript))
+}
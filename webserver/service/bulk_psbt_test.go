@@ -0,0 +1,123 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	psbtTestPayee   = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+	psbtTestWallet  = "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"
+	psbtTestChange  = "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"
+	psbtTestFeeRate = 2
+)
+
+func psbtTestUtxos(t *testing.T, sats ...int64) []walletUtxo {
+	request := portal.BulkPsbtRequest{}
+	for i, value := range sats {
+		request.Utxos = append(request.Utxos, portal.PsbtUtxo{
+			TxId:    strings.Repeat(string(rune('1'+i)), 64),
+			Vout:    uint32(i),
+			Amount:  decimal.New(value, -8),
+			Address: psbtTestWallet,
+		})
+	}
+	utxos, _, err := (&Service{}).bulkPsbtUtxos(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utxos
+}
+
+func TestBuildBulkPsbt(t *testing.T) {
+	// a P2WPKH input is 68 vB, a P2WPKH output 31 vB and the overhead 11 vB
+	tests := []struct {
+		name          string
+		payment       int64
+		utxos         []int64
+		changeAddress string
+		inputs        int
+		change        int64
+		fee           int64
+		fails         bool
+	}{
+		{name: "largest utxo first with change", payment: 100000, utxos: []int64{50000, 200000}, changeAddress: psbtTestChange, inputs: 1, change: 99718, fee: 282},
+		{name: "second utxo for the fee", payment: 220000, utxos: []int64{50000, 200000}, changeAddress: psbtTestChange, inputs: 2, change: 29582, fee: 418},
+		{name: "dust change left to the fee", payment: 100000, utxos: []int64{100500}, changeAddress: psbtTestChange, inputs: 1, fee: 500},
+		{name: "dust change without change address", payment: 100000, utxos: []int64{100500}, inputs: 1, fee: 500},
+		{name: "change address required", payment: 100000, utxos: []int64{200000}, fails: true},
+		{name: "dust output", payment: 500, utxos: []int64{200000}, changeAddress: psbtTestChange, fails: true},
+		{name: "utxos too small", payment: 100000, utxos: []int64{50000, 50100}, changeAddress: psbtTestChange, fails: true},
+	}
+	for _, test := range tests {
+		outputs := []*portal.BulkPsbtOutput{{Address: psbtTestPayee, Amount: decimal.New(test.payment, -8), PaymentIds: []uint64{1, 2}}}
+		response, err := buildBulkPsbt(outputs, psbtTestUtxos(t, test.utxos...), test.changeAddress, psbtTestFeeRate)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !response.Fee.Equal(decimal.New(test.fee, -8)) || !response.Change.Equal(decimal.New(test.change, -8)) {
+			t.Errorf("%s: fee %s and change %s, expected %d and %d sats", test.name, response.Fee, response.Change, test.fee, test.change)
+		}
+
+		packet, err := psbt.NewFromRawBytes(strings.NewReader(response.Psbt), true)
+		if err != nil {
+			t.Fatalf("%s: decode psbt: %v", test.name, err)
+		}
+		tx := packet.UnsignedTx
+		if len(tx.TxIn) != test.inputs || len(response.Inputs) != test.inputs {
+			t.Fatalf("%s: %d inputs, expected %d", test.name, len(tx.TxIn), test.inputs)
+		}
+		var inputTotal int64
+		for i, in := range tx.TxIn {
+			if in.Sequence != rbfSequence {
+				t.Errorf("%s: input %d does not signal replace by fee", test.name, i)
+			}
+			if packet.Inputs[i].WitnessUtxo == nil {
+				t.Fatalf("%s: the witness utxo of input %d is missing", test.name, i)
+			}
+			if in.PreviousOutPoint.Hash.String() != response.Inputs[i].TxId || in.PreviousOutPoint.Index != response.Inputs[i].Vout {
+				t.Errorf("%s: input %d spends %s, expected %s:%d", test.name, i, in.PreviousOutPoint, response.Inputs[i].TxId, response.Inputs[i].Vout)
+			}
+			inputTotal += packet.Inputs[i].WitnessUtxo.Value
+		}
+		expectedOutputs := 1
+		if test.change > 0 {
+			expectedOutputs = 2
+		}
+		if len(tx.TxOut) != expectedOutputs {
+			t.Fatalf("%s: %d outputs, expected %d", test.name, len(tx.TxOut), expectedOutputs)
+		}
+		if tx.TxOut[0].Value != test.payment {
+			t.Errorf("%s: the payee output is %d sats, expected %d", test.name, tx.TxOut[0].Value, test.payment)
+		}
+		var outputTotal int64
+		for _, out := range tx.TxOut {
+			outputTotal += out.Value
+		}
+		if inputTotal-outputTotal != test.fee {
+			t.Errorf("%s: the transaction pays %d sats of fee, expected %d", test.name, inputTotal-outputTotal, test.fee)
+		}
+	}
+}
+
+func TestBulkPsbtUtxosRejectDuplicates(t *testing.T) {
+	utxo := portal.PsbtUtxo{TxId: strings.Repeat("1", 64), Vout: 1, Amount: decimal.New(10000, -8), Address: psbtTestWallet}
+	other := utxo
+	other.Vout = 2
+	if _, _, err := (&Service{}).bulkPsbtUtxos(portal.BulkPsbtRequest{Utxos: []portal.PsbtUtxo{utxo, other}}); err != nil {
+		t.Errorf("the outputs of a transaction are distinct utxos: %v", err)
+	}
+	if _, _, err := (&Service{}).bulkPsbtUtxos(portal.BulkPsbtRequest{Utxos: []portal.PsbtUtxo{utxo, other, utxo}}); err == nil {
+		t.Error("expected an error for a utxo listed twice")
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/shopspring/decimal"
+)
+
+// dcrdataVerifier verifies decred transactions through a dcrdata compatible api
+// See: https://github.com/decred/dcrdata#apis
+type dcrdataVerifier struct {
+	baseUrl string
+}
+
+type dcrdataTx struct {
+	Txid string `json:"txid"`
+	Vout []struct {
+		Value        float64 `json:"value"`
+		N            uint32  `json:"n"`
+		ScriptPubKey struct {
+			Addresses []string `json:"addresses"`
+		} `json:"scriptPubKey"`
+	} `json:"vout"`
+	Confirmations int64 `json:"confirmations"`
+}
+
+func newDcrdataVerifier(baseUrl string) *dcrdataVerifier {
+	return &dcrdataVerifier{
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+	}
+}
+
+func (d *dcrdataVerifier) VerifyTx(txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s/api/tx/%s", d.baseUrl, txId),
+	}
+	var tx dcrdataTx
+	if err := HttpRequest(req, &tx); err != nil {
+		return nil, fmt.Errorf("get transaction %s failed: %v", txId, err)
+	}
+
+	// dcrdata returns the output values in DCR, sum them as atoms to avoid float rounding
+	var received dcrutil.Amount
+	for _, out := range tx.Vout {
+		for _, outAddress := range out.ScriptPubKey.Addresses {
+			if outAddress != address {
+				continue
+			}
+			value, err := dcrutil.NewAmount(out.Value)
+			if err != nil {
+				return nil, err
+			}
+			received += value
+			break
+		}
+	}
+	if received == 0 {
+		return nil, fmt.Errorf("transaction %s does not pay to %s", txId, address)
+	}
+	expected := dcrutil.Amount(toBaseUnits(expectedAmount, utils.PaymentTypeDCR.Decimals()).Int64())
+	if received < expected {
+		return nil, fmt.Errorf("transaction %s pays %.8f to %s, expected %.8f", txId, received.ToCoin(), address, expected.ToCoin())
+	}
+	return &TxVerification{
+		TxId:          txId,
+		Address:       address,
+		Amount:        decimal.New(int64(received), -utils.PaymentTypeDCR.Decimals()),
+		Confirmations: tx.Confirmations,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	dcrdataTestAddress = "DsUZxxoHJSty8DCfwfartwTYbuhmVct7tJu"
+	dcrdataTestOther   = "DsaAKsMvZ6HrqhmbhLjV9qVbPkkzF5daowT"
+)
+
+// newDcrdataStandIn serves the transactions by txid like the /api/tx endpoint of dcrdata
+func newDcrdataStandIn(t *testing.T, txs map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := txs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(tx))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dcrdataTestTx(t *testing.T, txId string, confirmations int64, outputs map[string][]float64) string {
+	t.Helper()
+	type vout struct {
+		Value        float64 `json:"value"`
+		N            uint32  `json:"n"`
+		ScriptPubKey struct {
+			Addresses []string `json:"addresses"`
+		} `json:"scriptPubKey"`
+	}
+	tx := struct {
+		Txid          string `json:"txid"`
+		Vout          []vout `json:"vout"`
+		Confirmations int64  `json:"confirmations"`
+	}{Txid: txId, Confirmations: confirmations}
+	for address, values := range outputs {
+		for _, value := range values {
+			out := vout{Value: value, N: uint32(len(tx.Vout))}
+			out.ScriptPubKey.Addresses = []string{address}
+			tx.Vout = append(tx.Vout, out)
+		}
+	}
+	b, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDcrdataVerifyTx(t *testing.T) {
+	server := newDcrdataStandIn(t, map[string]string{
+		"/api/tx/exact":     dcrdataTestTx(t, "exact", 3, map[string][]float64{dcrdataTestAddress: {1.5}, dcrdataTestOther: {10}}),
+		"/api/tx/split":     dcrdataTestTx(t, "split", 1, map[string][]float64{dcrdataTestAddress: {0.1, 0.2}}),
+		"/api/tx/short":     dcrdataTestTx(t, "short", 6, map[string][]float64{dcrdataTestAddress: {1.49999999}}),
+		"/api/tx/other":     dcrdataTestTx(t, "other", 6, map[string][]float64{dcrdataTestOther: {5}}),
+		"/api/tx/atomsonly": dcrdataTestTx(t, "atomsonly", 0, map[string][]float64{dcrdataTestAddress: {0.00000001}}),
+	})
+	verifier := newDcrdataVerifier(server.URL + "/")
+
+	tests := []struct {
+		name          string
+		txId          string
+		expected      string
+		amount        string
+		confirmations int64
+		fails         bool
+	}{
+		{name: "exact amount", txId: "exact", expected: "1.5", amount: "1.5", confirmations: 3},
+		{name: "outputs are summed without float rounding", txId: "split", expected: "0.3", amount: "0.3", confirmations: 1},
+		{name: "one atom short", txId: "short", expected: "1.5", fails: true},
+		{name: "no output to the address", txId: "other", expected: "1", fails: true},
+		{name: "one atom without confirmations", txId: "atomsonly", expected: "0.00000001", amount: "0.00000001"},
+		{name: "unknown transaction", txId: "missing", expected: "1", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verification, err := verifier.VerifyTx(test.txId, dcrdataTestAddress, decimal.RequireFromString(test.expected))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", verification)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verification.Amount.Equal(decimal.RequireFromString(test.amount)) {
+				t.Errorf("amount %s, expected %s", verification.Amount, test.amount)
+			}
+			if verification.Confirmations != test.confirmations {
+				t.Errorf("confirmations %d, expected %d", verification.Confirmations, test.confirmations)
+			}
+		})
+	}
+}
+
+func TestDcrdataRequiredConfirmations(t *testing.T) {
+	server := newDcrdataStandIn(t, map[string]string{
+		"/api/tx/pending":   dcrdataTestTx(t, "pending", 1, map[string][]float64{dcrdataTestAddress: {2}}),
+		"/api/tx/confirmed": dcrdataTestTx(t, "confirmed", 2, map[string][]float64{dcrdataTestAddress: {2}}),
+	})
+	s := &Service{txVerifiers: newTxVerifiers(ChainConfig{
+		Dcrdata: DcrdataConfig{BaseUrl: server.URL, MinConfirmations: 2},
+	})}
+
+	tests := []struct {
+		txId  string
+		final bool
+	}{
+		{txId: "pending", final: false},
+		{txId: "confirmed", final: true},
+	}
+	for _, test := range tests {
+		verification, err := s.VerifyTx(utils.PaymentTypeDCR, utils.NetworkDCR, test.txId, dcrdataTestAddress, decimal.NewFromInt(2))
+		if err != nil {
+			t.Fatalf("%s: %v", test.txId, err)
+		}
+		if verification.RequiredConfirmations != 2 {
+			t.Errorf("%s: required confirmations %d, expected 2", test.txId, verification.RequiredConfirmations)
+		}
+		if verification.Final() != test.final {
+			t.Errorf("%s: final %v, expected %v", test.txId, verification.Final(), test.final)
+		}
+	}
+
+	if _, err := s.VerifyTx(utils.PaymentTypeDCR, utils.NetworkDCR, "confirmed", dcrdataTestAddress, decimal.NewFromInt(3)); err == nil {
+		t.Error("expected an error for an amount short of the payment")
+	}
+}
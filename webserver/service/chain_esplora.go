@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/shopspring/decimal"
+)
+
+// esploraVerifier verifies bitcoin like transactions through an esplora compatible REST api
+// See: https://github.com/Blockstream/esplora/blob/master/API.md
+type esploraVerifier struct {
+	baseUrl string
+}
+
+type esploraTx struct {
+	Txid string `json:"txid"`
+	Vout []struct {
+		ScriptpubkeyAddress string `json:"scriptpubkey_address"`
+		Value               int64  `json:"value"`
+	} `json:"vout"`
+	Status struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int64 `json:"block_height"`
+	} `json:"status"`
+}
+
+type esploraAddress struct {
+	ChainStats struct {
+		TxCount int64 `json:"tx_count"`
+	} `json:"chain_stats"`
+	MempoolStats struct {
+		TxCount int64 `json:"tx_count"`
+	} `json:"mempool_stats"`
+}
+
+type esploraUtxo struct {
+	Txid  string `json:"txid"`
+	Vout  uint32 `json:"vout"`
+	Value int64  `json:"value"`
+}
+
+func newEsploraVerifier(baseUrl string) *esploraVerifier {
+	return &esploraVerifier{
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+	}
+}
+
+func (e *esploraVerifier) getTx(txId string) (*esploraTx, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s/tx/%s", e.baseUrl, txId),
+	}
+	var tx esploraTx
+	if err := HttpRequest(req, &tx); err != nil {
+		return nil, fmt.Errorf("get transaction %s failed: %v", txId, err)
+	}
+	return &tx, nil
+}
+
+func (e *esploraVerifier) getTipHeight() (int64, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s/blocks/tip/height", e.baseUrl),
+	}
+	var height int64
+	if err := HttpRequest(req, &height); err != nil {
+		return 0, fmt.Errorf("get tip height failed: %v", err)
+	}
+	return height, nil
+}
+
+// getAddressTxCount returns the number of confirmed and unconfirmed transactions of the address
+func (e *esploraVerifier) getAddressTxCount(address string) (int64, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s/address/%s", e.baseUrl, address),
+	}
+	var stats esploraAddress
+	if err := HttpRequest(req, &stats); err != nil {
+		return 0, fmt.Errorf("get address %s failed: %v", address, err)
+	}
+	return stats.ChainStats.TxCount + stats.MempoolStats.TxCount, nil
+}
+
+func (e *esploraVerifier) getAddressUtxos(address string) ([]esploraUtxo, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s/address/%s/utxo", e.baseUrl, address),
+	}
+	var utxos []esploraUtxo
+	if err := HttpRequest(req, &utxos); err != nil {
+		return nil, fmt.Errorf("get utxos of %s failed: %v", address, err)
+	}
+	return utxos, nil
+}
+
+func (e *esploraVerifier) VerifyTx(txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	tx, err := e.getTx(txId)
+	if err != nil {
+		return nil, err
+	}
+	var received int64
+	for _, out := range tx.Vout {
+		if out.ScriptpubkeyAddress == address {
+			received += out.Value
+		}
+	}
+	if received == 0 {
+		return nil, fmt.Errorf("transaction %s does not pay to %s", txId, address)
+	}
+	expected := btcutil.Amount(toBaseUnits(expectedAmount, utils.PaymentTypeBTC.Decimals()).Int64())
+	if received < int64(expected) {
+		return nil, fmt.Errorf("transaction %s pays %.8f to %s, expected %.8f", txId, btcutil.Amount(received).ToBTC(), address, expected.ToBTC())
+	}
+
+	var confirmations int64
+	if tx.Status.Confirmed {
+		tip, err := e.getTipHeight()
+		if err != nil {
+			return nil, err
+		}
+		confirmations = tip - tx.Status.BlockHeight + 1
+	}
+	return &TxVerification{
+		TxId:          txId,
+		Address:       address,
+		Amount:        decimal.New(received, -utils.PaymentTypeBTC.Decimals()),
+		Confirmations: confirmations,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	esploraTestAddress = "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"
+	esploraTestOther   = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	esploraTestTip     = 850000
+)
+
+// newEsploraStandIn serves the transactions by txid and the tip height like an esplora REST api
+func newEsploraStandIn(t *testing.T, txs map[string]esploraTx) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/blocks/tip/height" {
+			json.NewEncoder(w).Encode(esploraTestTip)
+			return
+		}
+		tx, ok := txs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(tx)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type esploraTestOutput struct {
+	address string
+	sats    int64
+}
+
+// esploraTestTx returns a transaction with the outputs, confirmed in the block when it is set
+func esploraTestTx(txId string, block int64, outputs ...esploraTestOutput) esploraTx {
+	tx := esploraTx{Txid: txId}
+	tx.Vout = make([]struct {
+		ScriptpubkeyAddress string `json:"scriptpubkey_address"`
+		Value               int64  `json:"value"`
+	}, len(outputs))
+	for i, output := range outputs {
+		tx.Vout[i].ScriptpubkeyAddress = output.address
+		tx.Vout[i].Value = output.sats
+	}
+	if block > 0 {
+		tx.Status.Confirmed = true
+		tx.Status.BlockHeight = block
+	}
+	return tx
+}
+
+func TestEsploraVerifyTx(t *testing.T) {
+	server := newEsploraStandIn(t, map[string]esploraTx{
+		"/tx/exact":   esploraTestTx("exact", esploraTestTip-2, esploraTestOutput{esploraTestAddress, 150000000}, esploraTestOutput{esploraTestOther, 1000}),
+		"/tx/split":   esploraTestTx("split", esploraTestTip, esploraTestOutput{esploraTestAddress, 10000000}, esploraTestOutput{esploraTestAddress, 20000000}),
+		"/tx/pending": esploraTestTx("pending", 0, esploraTestOutput{esploraTestAddress, 150000000}),
+		"/tx/short":   esploraTestTx("short", esploraTestTip, esploraTestOutput{esploraTestAddress, 149999999}),
+		"/tx/other":   esploraTestTx("other", esploraTestTip, esploraTestOutput{esploraTestOther, 150000000}),
+	})
+	verifier := newEsploraVerifier(server.URL + "/")
+
+	tests := []struct {
+		name          string
+		txId          string
+		expected      string
+		amount        string
+		confirmations int64
+		fails         bool
+	}{
+		{name: "exact amount", txId: "exact", expected: "1.5", amount: "1.5", confirmations: 3},
+		{name: "outputs to the address are summed", txId: "split", expected: "0.3", amount: "0.3", confirmations: 1},
+		{name: "unconfirmed transaction", txId: "pending", expected: "1.5", amount: "1.5", confirmations: 0},
+		{name: "one satoshi short", txId: "short", expected: "1.5", fails: true},
+		{name: "no output to the address", txId: "other", expected: "1.5", fails: true},
+		{name: "unknown transaction", txId: "missing", expected: "1", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verification, err := verifier.VerifyTx(test.txId, esploraTestAddress, decimal.RequireFromString(test.expected))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", verification)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verification.Amount.Equal(decimal.RequireFromString(test.amount)) {
+				t.Errorf("amount %s, expected %s", verification.Amount, test.amount)
+			}
+			if verification.Confirmations != test.confirmations {
+				t.Errorf("confirmations %d, expected %d", verification.Confirmations, test.confirmations)
+			}
+		})
+	}
+}
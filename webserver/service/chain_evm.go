@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/shopspring/decimal"
+)
+
+// evmRequestTimeout is the time the verifier waits for the endpoint to answer the requests verifying a transaction
+const evmRequestTimeout = 30 * time.Second
+
+// transferEventTopic is the keccak256 hash of the ERC20 event Transfer(address,address,uint256)
+var transferEventTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+// EvmLog is a log entry of a transaction receipt
+type EvmLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+// EvmReceipt is the part of a transaction receipt used to verify the transfers
+type EvmReceipt struct {
+	TransactionHash common.Hash     `json:"transactionHash"`
+	BlockNumber     *hexutil.Big    `json:"blockNumber"`
+	Status          hexutil.Uint64  `json:"status"`
+	To              *common.Address `json:"to"`
+	Logs            []EvmLog        `json:"logs"`
+}
+
+// EvmTransaction is the part of a transaction used to verify native coin transfers
+type EvmTransaction struct {
+	Hash  common.Hash     `json:"hash"`
+	To    *common.Address `json:"to"`
+	Value *hexutil.Big    `json:"value"`
+}
+
+// EvmBackend is the part of the ethereum json-rpc api used to verify transactions, its methods follow
+// ethereum.TransactionReader and ethereum.BlockNumberReader. The client of go-ethereum is not used: its
+// crypto package links a second copy of libsecp256k1 with cgo, which conflicts with the one of ltcd
+type EvmBackend interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*EvmReceipt, error)
+	TransactionByHash(ctx context.Context, txHash common.Hash) (*EvmTransaction, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// evmRpcClient calls an ethereum json-rpc endpoint
+type evmRpcClient struct {
+	*jsonRpcClient
+}
+
+func newEvmRpcClient(rpcUrl string) *evmRpcClient {
+	return &evmRpcClient{newJsonRpcClient(rpcUrl)}
+}
+
+func (c *evmRpcClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*EvmReceipt, error) {
+	var receipt EvmReceipt
+	if err := c.call(ctx, "eth_getTransactionReceipt", &receipt, txHash); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (c *evmRpcClient) TransactionByHash(ctx context.Context, txHash common.Hash) (*EvmTransaction, error) {
+	var tx EvmTransaction
+	if err := c.call(ctx, "eth_getTransactionByHash", &tx, txHash); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func (c *evmRpcClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var number hexutil.Uint64
+	if err := c.call(ctx, "eth_blockNumber", &number); err != nil {
+		return 0, err
+	}
+	return uint64(number), nil
+}
+
+// evmVerifier verifies the token transfers (or native transfers when no contract is set) of evm chains
+type evmVerifier struct {
+	backend  EvmBackend
+	contract *common.Address
+	decimals int32
+}
+
+// NewEvmTxVerifier creates a verifier of the token transfers of the contract.
+// A nil contract verifies the native coin transfers of the chain
+func NewEvmTxVerifier(backend EvmBackend, contract *common.Address, decimals int32) TxVerifier {
+	return &evmVerifier{
+		backend:  backend,
+		contract: contract,
+		decimals: decimals,
+	}
+}
+
+func (e *evmVerifier) VerifyTx(txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("address %s is not a valid evm address", address)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), evmRequestTimeout)
+	defer cancel()
+	to := common.HexToAddress(address)
+	hash := common.HexToHash(txId)
+	receipt, err := e.backend.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction receipt %s failed: %v", txId, err)
+	}
+	if receipt.Status != 1 {
+		return nil, fmt.Errorf("transaction %s was reverted", txId)
+	}
+
+	received := new(big.Int)
+	if e.contract == nil {
+		tx, err := e.backend.TransactionByHash(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("get transaction %s failed: %v", txId, err)
+		}
+		if tx.To != nil && *tx.To == to && tx.Value != nil {
+			received.Set(tx.Value.ToInt())
+		}
+	} else {
+		for _, l := range receipt.Logs {
+			if l.Address != *e.contract || len(l.Topics) != 3 || l.Topics[0] != transferEventTopic {
+				continue
+			}
+			if common.BytesToAddress(l.Topics[2].Bytes()) != to {
+				continue
+			}
+			received.Add(received, new(big.Int).SetBytes(l.Data))
+		}
+	}
+	if received.Sign() == 0 {
+		return nil, fmt.Errorf("transaction %s does not transfer to %s", txId, address)
+	}
+	expected := toBaseUnits(expectedAmount, e.decimals)
+	if received.Cmp(expected) < 0 {
+		return nil, fmt.Errorf("transaction %s transfers %s to %s, expected %s", txId,
+			fromBaseUnits(received, e.decimals), address, fromBaseUnits(expected, e.decimals))
+	}
+
+	var confirmations int64
+	if receipt.BlockNumber != nil {
+		head, err := e.backend.BlockNumber(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get block number failed: %v", err)
+		}
+		block := receipt.BlockNumber.ToInt().Uint64()
+		if head >= block {
+			confirmations = int64(head-block) + 1
+		}
+	}
+	return &TxVerification{
+		TxId:          txId,
+		Address:       address,
+		Amount:        decimal.NewFromBigInt(received, -e.decimals),
+		Confirmations: confirmations,
+	}, nil
+}
+
+func pow10(decimals int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
+
+// toBaseUnits converts a coin amount to the smallest unit of a token with the decimals, rounding half up
+func toBaseUnits(amount decimal.Decimal, decimals int32) *big.Int {
+	return amount.Shift(decimals).Round(0).BigInt()
+}
+
+func fromBaseUnits(value *big.Int, decimals int32) string {
+	return new(big.Rat).SetFrac(value, pow10(decimals)).FloatString(int(decimals))
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	evmTestToken     = common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	evmTestSender    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	evmTestRecipient = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	evmTestOther     = common.HexToAddress("0x3000000000000000000000000000000000000003")
+)
+
+// simulatedEvmChain mines the sent transactions in blocks and serves them through the ethereum json-rpc
+// methods used by the verifier, so the verifier is exercised through its rpc client
+type simulatedEvmChain struct {
+	mtx      sync.Mutex
+	head     uint64
+	pending  []common.Hash
+	txs      map[common.Hash]EvmTransaction
+	receipts map[common.Hash]EvmReceipt
+	server   *httptest.Server
+}
+
+func newSimulatedEvmChain(t *testing.T) *simulatedEvmChain {
+	t.Helper()
+	chain := &simulatedEvmChain{
+		txs:      make(map[common.Hash]EvmTransaction),
+		receipts: make(map[common.Hash]EvmReceipt),
+	}
+	chain.server = httptest.NewServer(http.HandlerFunc(chain.serveRpc))
+	t.Cleanup(chain.server.Close)
+	return chain
+}
+
+func (c *simulatedEvmChain) serveRpc(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Id     uint64            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var result interface{}
+	switch req.Method {
+	case "eth_blockNumber":
+		result = hexutil.Uint64(c.head)
+	case "eth_getTransactionByHash", "eth_getTransactionReceipt":
+		var hash common.Hash
+		if err := json.Unmarshal(req.Params[0], &hash); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method == "eth_getTransactionByHash" {
+			if tx, ok := c.txs[hash]; ok {
+				result = tx
+			}
+		} else if receipt, ok := c.receipts[hash]; ok && receipt.BlockNumber != nil {
+			// the nodes have no receipt for the pending transactions
+			result = receipt
+		}
+	default:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.Id,
+			"error":   map[string]interface{}{"code": -32601, "message": "method not found"},
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+}
+
+// transferToken sends a transfer of the token contract, the transaction is pending until the next block
+func (c *simulatedEvmChain) transferToken(to common.Address, amount int64, reverted bool) common.Hash {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	hash := common.BigToHash(big.NewInt(int64(len(c.txs) + 1)))
+	status := hexutil.Uint64(1)
+	if reverted {
+		status = 0
+	}
+	c.txs[hash] = EvmTransaction{Hash: hash, To: &evmTestToken, Value: (*hexutil.Big)(new(big.Int))}
+	c.receipts[hash] = EvmReceipt{
+		TransactionHash: hash,
+		Status:          status,
+		To:              &evmTestToken,
+		Logs: []EvmLog{{
+			Address: evmTestToken,
+			Topics:  []common.Hash{transferEventTopic, common.BytesToHash(evmTestSender.Bytes()), common.BytesToHash(to.Bytes())},
+			Data:    common.LeftPadBytes(big.NewInt(amount).Bytes(), 32),
+		}},
+	}
+	c.pending = append(c.pending, hash)
+	return hash
+}
+
+// transferNative sends the native coin of the chain, the transaction is pending until the next block
+func (c *simulatedEvmChain) transferNative(to common.Address, amount *big.Int) common.Hash {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	hash := common.BigToHash(big.NewInt(int64(len(c.txs) + 1)))
+	c.txs[hash] = EvmTransaction{Hash: hash, To: &to, Value: (*hexutil.Big)(amount)}
+	c.receipts[hash] = EvmReceipt{TransactionHash: hash, Status: 1, To: &to}
+	c.pending = append(c.pending, hash)
+	return hash
+}
+
+// commit mines a block with the pending transactions
+func (c *simulatedEvmChain) commit() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.head++
+	for _, hash := range c.pending {
+		receipt := c.receipts[hash]
+		receipt.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(c.head))
+		c.receipts[hash] = receipt
+	}
+	c.pending = nil
+}
+
+func TestEvmVerifyTokenTransfer(t *testing.T) {
+	chain := newSimulatedEvmChain(t)
+	client := newEvmRpcClient(chain.server.URL)
+	verifier := NewEvmTxVerifier(client, &evmTestToken, 6)
+
+	paid := chain.transferToken(evmTestRecipient, 25_500_000, false)
+	other := chain.transferToken(evmTestOther, 25_500_000, false)
+	short := chain.transferToken(evmTestRecipient, 25_499_999, false)
+	reverted := chain.transferToken(evmTestRecipient, 25_500_000, true)
+	chain.commit()
+
+	tests := []struct {
+		name  string
+		hash  common.Hash
+		fails bool
+	}{
+		{name: "token transfer", hash: paid},
+		{name: "wrong recipient", hash: other, fails: true},
+		{name: "short amount", hash: short, fails: true},
+		{name: "reverted transfer", hash: reverted, fails: true},
+		{name: "unknown transaction", hash: common.HexToHash("0xdead"), fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verification, err := verifier.VerifyTx(test.hash.Hex(), evmTestRecipient.Hex(), decimal.RequireFromString("25.5"))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", verification)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verification.Amount.Equal(decimal.RequireFromString("25.5")) {
+				t.Errorf("amount %s, expected 25.5", verification.Amount)
+			}
+			if verification.Confirmations != 1 {
+				t.Errorf("confirmations %d, expected 1", verification.Confirmations)
+			}
+		})
+	}
+}
+
+func TestEvmVerifyNativeTransfer(t *testing.T) {
+	chain := newSimulatedEvmChain(t)
+	verifier := NewEvmTxVerifier(newEvmRpcClient(chain.server.URL), nil, 18)
+
+	oneEth := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	hash := chain.transferNative(evmTestRecipient, oneEth)
+	chain.commit()
+
+	verification, err := verifier.VerifyTx(hash.Hex(), evmTestRecipient.Hex(), decimal.NewFromInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Amount.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("amount %s, expected 1", verification.Amount)
+	}
+	if _, err := verifier.VerifyTx(hash.Hex(), evmTestOther.Hex(), decimal.NewFromInt(1)); err == nil {
+		t.Error("expected an error for a transfer to another address")
+	}
+}
+
+func TestEvmRequiredConfirmations(t *testing.T) {
+	chain := newSimulatedEvmChain(t)
+	s := &Service{txVerifiers: make(map[verifierKey]chainVerifier)}
+	s.RegisterTxVerifier(utils.PaymentTypeUSDT, utils.NetworkERC20, NewEvmTxVerifier(newEvmRpcClient(chain.server.URL), &evmTestToken, 6), 3)
+
+	hash := chain.transferToken(evmTestRecipient, 10_000_000, false)
+	if _, err := s.VerifyTx(utils.PaymentTypeUSDT, utils.NetworkERC20, hash.Hex(), evmTestRecipient.Hex(), decimal.NewFromInt(10)); err == nil {
+		t.Fatal("expected an error for a pending transaction")
+	}
+	for block := int64(1); block <= 3; block++ {
+		chain.commit()
+		verification, err := s.VerifyTx(utils.PaymentTypeUSDT, utils.NetworkERC20, hash.Hex(), evmTestRecipient.Hex(), decimal.NewFromInt(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verification.Confirmations != block {
+			t.Errorf("confirmations %d, expected %d", verification.Confirmations, block)
+		}
+		if verification.Final() != (block >= 3) {
+			t.Errorf("final %v with %d confirmations of 3", verification.Final(), block)
+		}
+	}
+}
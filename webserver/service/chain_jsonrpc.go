@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+type jsonRpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Id      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type jsonRpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// jsonRpcClient calls a json-rpc 2.0 endpoint over http
+type jsonRpcClient struct {
+	rpcUrl string
+	nextId uint64
+}
+
+func newJsonRpcClient(rpcUrl string) *jsonRpcClient {
+	return &jsonRpcClient{
+		rpcUrl: rpcUrl,
+	}
+}
+
+// call sends the request and decodes the result into result.
+// A null result is reported as an error so callers can treat it as not found
+func (c *jsonRpcClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	payload, err := json.Marshal(jsonRpcRequest{
+		JsonRpc: "2.0",
+		Id:      atomic.AddUint64(&c.nextId, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	req := &ReqConfig{
+		Context: ctx,
+		Method:  http.MethodPost,
+		HttpUrl: c.rpcUrl,
+		Payload: payload,
+	}
+	var resp jsonRpcResponse
+	if err := HttpRequest(req, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s failed: %s (%d)", method, resp.Error.Message, resp.Error.Code)
+	}
+	if len(resp.Result) == 0 || string(resp.Result) == "null" {
+		return fmt.Errorf("%s: not found", method)
+	}
+	return json.Unmarshal(resp.Result, result)
+}
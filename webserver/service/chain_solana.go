@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// solanaRequestTimeout is the time the verifier waits for the endpoint to answer the requests verifying a transaction
+	solanaRequestTimeout = 30 * time.Second
+	// solanaRootedConfirmations is the confirmations of a finalized transaction, the cluster stops counting
+	// the confirmations once the block is rooted, after 31 confirmed blocks
+	solanaRootedConfirmations = 32
+	solanaFinalized           = "finalized"
+)
+
+// SolanaTokenBalance is the token balance of an account before or after a transaction
+type SolanaTokenBalance struct {
+	AccountIndex  int    `json:"accountIndex"`
+	Mint          string `json:"mint"`
+	Owner         string `json:"owner"`
+	UiTokenAmount struct {
+		Amount   string `json:"amount"`
+		Decimals int32  `json:"decimals"`
+	} `json:"uiTokenAmount"`
+}
+
+// SolanaTransaction is the part of a jsonParsed transaction used to verify token transfers
+type SolanaTransaction struct {
+	Slot uint64 `json:"slot"`
+	Meta struct {
+		Err               json.RawMessage      `json:"err"`
+		PreTokenBalances  []SolanaTokenBalance `json:"preTokenBalances"`
+		PostTokenBalances []SolanaTokenBalance `json:"postTokenBalances"`
+	} `json:"meta"`
+	Transaction struct {
+		Message struct {
+			AccountKeys []struct {
+				Pubkey string `json:"pubkey"`
+			} `json:"accountKeys"`
+		} `json:"message"`
+	} `json:"transaction"`
+}
+
+// SolanaSignatureStatus is the status of a transaction voted by the cluster. Confirmations is the number of
+// blocks confirmed on top of the block of the transaction, it is null once the block is rooted
+type SolanaSignatureStatus struct {
+	Slot               uint64          `json:"slot"`
+	Confirmations      *int64          `json:"confirmations"`
+	Err                json.RawMessage `json:"err"`
+	ConfirmationStatus string          `json:"confirmationStatus"`
+}
+
+// SolanaBackend is the part of the solana json-rpc api used to verify transactions.
+// A simulated chain can implement it to exercise the verifier
+type SolanaBackend interface {
+	GetTransaction(ctx context.Context, signature string) (*SolanaTransaction, error)
+	GetSignatureStatus(ctx context.Context, signature string) (*SolanaSignatureStatus, error)
+}
+
+// solanaRpcClient calls a solana json-rpc endpoint
+type solanaRpcClient struct {
+	*jsonRpcClient
+}
+
+func newSolanaRpcClient(rpcUrl string) *solanaRpcClient {
+	return &solanaRpcClient{newJsonRpcClient(rpcUrl)}
+}
+
+func (c *solanaRpcClient) GetTransaction(ctx context.Context, signature string) (*SolanaTransaction, error) {
+	var tx SolanaTransaction
+	opts := map[string]interface{}{
+		"encoding":                       "jsonParsed",
+		"commitment":                     "confirmed",
+		"maxSupportedTransactionVersion": 0,
+	}
+	if err := c.call(ctx, "getTransaction", &tx, signature, opts); err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func (c *solanaRpcClient) GetSignatureStatus(ctx context.Context, signature string) (*SolanaSignatureStatus, error) {
+	var statuses struct {
+		Value []*SolanaSignatureStatus `json:"value"`
+	}
+	opts := map[string]interface{}{"searchTransactionHistory": true}
+	if err := c.call(ctx, "getSignatureStatuses", &statuses, []string{signature}, opts); err != nil {
+		return nil, err
+	}
+	if len(statuses.Value) == 0 || statuses.Value[0] == nil {
+		return nil, fmt.Errorf("getSignatureStatuses: not found")
+	}
+	return statuses.Value[0], nil
+}
+
+// solanaVerifier verifies the spl token transfers of a mint to the associated token account of the recipient
+type solanaVerifier struct {
+	backend SolanaBackend
+	mint    solana.PublicKey
+}
+
+// NewSolanaTxVerifier creates a verifier of the spl token transfers of the mint
+func NewSolanaTxVerifier(backend SolanaBackend, mint solana.PublicKey) TxVerifier {
+	return &solanaVerifier{
+		backend: backend,
+		mint:    mint,
+	}
+}
+
+func (v *solanaVerifier) VerifyTx(txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	owner, err := solana.PublicKeyFromBase58(address)
+	if err != nil {
+		return nil, fmt.Errorf("address %s is not a valid solana address", address)
+	}
+	tokenAccount, _, err := solana.FindAssociatedTokenAddress(owner, v.mint)
+	if err != nil {
+		return nil, fmt.Errorf("find token account of %s failed: %v", address, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), solanaRequestTimeout)
+	defer cancel()
+	tx, err := v.backend.GetTransaction(ctx, txId)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction %s failed: %v", txId, err)
+	}
+	if len(tx.Meta.Err) > 0 && string(tx.Meta.Err) != "null" {
+		return nil, fmt.Errorf("transaction %s failed: %s", txId, tx.Meta.Err)
+	}
+
+	accountIndex := -1
+	for i, key := range tx.Transaction.Message.AccountKeys {
+		if key.Pubkey == tokenAccount.String() {
+			accountIndex = i
+			break
+		}
+	}
+	if accountIndex < 0 {
+		return nil, fmt.Errorf("transaction %s does not transfer to %s", txId, address)
+	}
+	pre, _, err := v.tokenBalance(tx.Meta.PreTokenBalances, accountIndex)
+	if err != nil {
+		return nil, err
+	}
+	post, decimals, err := v.tokenBalance(tx.Meta.PostTokenBalances, accountIndex)
+	if err != nil {
+		return nil, err
+	}
+	received := new(big.Int).Sub(post, pre)
+	if received.Sign() <= 0 {
+		return nil, fmt.Errorf("transaction %s does not transfer to %s", txId, address)
+	}
+	expected := toBaseUnits(expectedAmount, decimals)
+	if received.Cmp(expected) < 0 {
+		return nil, fmt.Errorf("transaction %s transfers %s to %s, expected %s", txId,
+			fromBaseUnits(received, decimals), address, fromBaseUnits(expected, decimals))
+	}
+
+	status, err := v.backend.GetSignatureStatus(ctx, txId)
+	if err != nil {
+		return nil, fmt.Errorf("get status of transaction %s failed: %v", txId, err)
+	}
+	verification := &TxVerification{
+		TxId:    txId,
+		Address: address,
+		Amount:  decimal.NewFromBigInt(received, -decimals),
+	}
+	switch {
+	case status.ConfirmationStatus == solanaFinalized:
+		verification.Finalized = true
+		verification.Confirmations = solanaRootedConfirmations
+	case status.Confirmations != nil:
+		verification.Confirmations = *status.Confirmations
+	}
+	return verification, nil
+}
+
+// tokenBalance returns the balance of the mint held by the account, zero when the account has no balance entry
+func (v *solanaVerifier) tokenBalance(balances []SolanaTokenBalance, accountIndex int) (*big.Int, int32, error) {
+	for _, balance := range balances {
+		if balance.AccountIndex != accountIndex || balance.Mint != v.mint.String() {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(balance.UiTokenAmount.Amount, 10)
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid token amount %s", balance.UiTokenAmount.Amount)
+		}
+		return amount, balance.UiTokenAmount.Decimals, nil
+	}
+	return new(big.Int), 0, nil
+}
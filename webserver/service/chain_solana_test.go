@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/shopspring/decimal"
+)
+
+// fakeSolanaBackend returns the transactions and the statuses of the cluster by signature
+type fakeSolanaBackend struct {
+	txs      map[string]*SolanaTransaction
+	statuses map[string]*SolanaSignatureStatus
+}
+
+func (b *fakeSolanaBackend) GetTransaction(ctx context.Context, signature string) (*SolanaTransaction, error) {
+	tx, ok := b.txs[signature]
+	if !ok {
+		return nil, fmt.Errorf("getTransaction: not found")
+	}
+	return tx, nil
+}
+
+func (b *fakeSolanaBackend) GetSignatureStatus(ctx context.Context, signature string) (*SolanaSignatureStatus, error) {
+	status, ok := b.statuses[signature]
+	if !ok {
+		return nil, fmt.Errorf("getSignatureStatuses: not found")
+	}
+	return status, nil
+}
+
+// solanaTestTransfer returns a transaction moving the balance of the token account from pre to post
+func solanaTestTransfer(tokenAccount, mint solana.PublicKey, pre, post string) *SolanaTransaction {
+	tx := &SolanaTransaction{}
+	tx.Transaction.Message.AccountKeys = []struct {
+		Pubkey string `json:"pubkey"`
+	}{{Pubkey: solana.NewWallet().PublicKey().String()}, {Pubkey: tokenAccount.String()}}
+	balance := func(amount string) SolanaTokenBalance {
+		b := SolanaTokenBalance{AccountIndex: 1, Mint: mint.String()}
+		b.UiTokenAmount.Amount = amount
+		b.UiTokenAmount.Decimals = 6
+		return b
+	}
+	tx.Meta.PreTokenBalances = []SolanaTokenBalance{balance(pre)}
+	tx.Meta.PostTokenBalances = []SolanaTokenBalance{balance(post)}
+	return tx
+}
+
+func TestSolanaConfirmations(t *testing.T) {
+	mint := solana.NewWallet().PublicKey()
+	owner := solana.NewWallet().PublicKey()
+	tokenAccount, _, err := solana.FindAssociatedTokenAddress(owner, mint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmations := int64(5)
+	backend := &fakeSolanaBackend{
+		txs: map[string]*SolanaTransaction{
+			"confirmed": solanaTestTransfer(tokenAccount, mint, "0", "7000000"),
+			"finalized": solanaTestTransfer(tokenAccount, mint, "1000000", "8000000"),
+			"short":     solanaTestTransfer(tokenAccount, mint, "0", "6999999"),
+		},
+		statuses: map[string]*SolanaSignatureStatus{
+			"confirmed": {Confirmations: &confirmations, ConfirmationStatus: "confirmed"},
+			"finalized": {ConfirmationStatus: solanaFinalized},
+			"short":     {Confirmations: &confirmations, ConfirmationStatus: "confirmed"},
+		},
+	}
+	verifier := NewSolanaTxVerifier(backend, mint)
+
+	tests := []struct {
+		signature     string
+		confirmations int64
+		final         bool
+		fails         bool
+	}{
+		{signature: "confirmed", confirmations: 5, final: false},
+		{signature: "finalized", confirmations: solanaRootedConfirmations, final: true},
+		{signature: "short", fails: true},
+		{signature: "unknown", fails: true},
+	}
+	for _, test := range tests {
+		verification, err := verifier.VerifyTx(test.signature, owner.String(), decimal.NewFromInt(7))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", test.signature, verification)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.signature, err)
+		}
+		// a finalized transaction is final whatever the confirmations required
+		verification.RequiredConfirmations = 100
+		if verification.Confirmations != test.confirmations {
+			t.Errorf("%s: confirmations %d, expected %d", test.signature, verification.Confirmations, test.confirmations)
+		}
+		if verification.Final() != test.final {
+			t.Errorf("%s: final %v, expected %v", test.signature, verification.Final(), test.final)
+		}
+		if !verification.Amount.Equal(decimal.NewFromInt(7)) {
+			t.Errorf("%s: amount %s, expected 7", test.signature, verification.Amount)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gagliardetto/solana-go"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+type ChainConfig struct {
+	// Esplora lists the esplora compatible REST backends (blockstream, mempool.space, litecoinspace...)
+	Esplora []EsploraConfig `yaml:"esplora"`
+	// Dcrdata is the dcrdata compatible backend used for decred
+	Dcrdata DcrdataConfig `yaml:"dcrdata"`
+	// Evm lists the json-rpc endpoints of the evm networks (erc20, bep20)
+	Evm []EvmConfig `yaml:"evm"`
+	// Solana is the json-rpc endpoint used for the spl tokens on solana
+	Solana SolanaConfig `yaml:"solana"`
+	// TrackInterval is the number of seconds between two checks of the confirming payments
+	TrackInterval int `yaml:"trackInterval"`
+	// ConfirmTimeout is the number of minutes a payment can stay confirming before it is flagged
+	ConfirmTimeout int `yaml:"confirmTimeout"`
+}
+
+type EsploraConfig struct {
+	// Network is the network code the backend serves, "btc" or "ltc"
+	Network utils.Network `yaml:"network"`
+	BaseUrl string        `yaml:"baseUrl"`
+	// MinConfirmations is the number of confirmations required before the payment is paid
+	MinConfirmations int64 `yaml:"minConfirmations"`
+}
+
+type DcrdataConfig struct {
+	BaseUrl          string `yaml:"baseUrl"`
+	MinConfirmations int64  `yaml:"minConfirmations"`
+}
+
+type EvmConfig struct {
+	// Network is the network code the endpoint serves, "erc20" or "bep20"
+	Network          utils.Network    `yaml:"network"`
+	RpcUrl           string           `yaml:"rpcUrl"`
+	MinConfirmations int64            `yaml:"minConfirmations"`
+	Tokens           []EvmTokenConfig `yaml:"tokens"`
+}
+
+type EvmTokenConfig struct {
+	// Coin is the coin code paid with the token: USDT, ETH, BTC, LTC
+	Coin string `yaml:"coin"`
+	// Contract is the token contract address, empty for the native coin of the network
+	Contract string `yaml:"contract"`
+	Decimals int32  `yaml:"decimals"`
+}
+
+type SolanaConfig struct {
+	RpcUrl           string              `yaml:"rpcUrl"`
+	MinConfirmations int64               `yaml:"minConfirmations"`
+	Tokens           []SolanaTokenConfig `yaml:"tokens"`
+}
+
+type SolanaTokenConfig struct {
+	// Coin is the coin code paid with the token: USDT
+	Coin string `yaml:"coin"`
+	// Mint is the base58 address of the token mint
+	Mint string `yaml:"mint"`
+}
+
+// TxVerification is the result of looking up a payment transaction on chain
+type TxVerification struct {
+	TxId          string          `json:"txId"`
+	Address       string          `json:"address"`
+	Amount        decimal.Decimal `json:"amount"`
+	Confirmations int64           `json:"confirmations"`
+	// RequiredConfirmations is the confirmations needed before the payment is paid
+	RequiredConfirmations int64 `json:"requiredConfirmations"`
+	// Finalized is set by the chains with finality once the transaction can not be rolled back,
+	// it needs no more confirmations
+	Finalized bool `json:"finalized"`
+}
+
+// Final returns true when the transaction is finalized or has the required confirmations
+func (v *TxVerification) Final() bool {
+	return v.Finalized || v.Confirmations >= v.RequiredConfirmations
+}
+
+// TxVerifier looks up a transaction on chain and checks that it pays at least
+// the expected amount to the address
+type TxVerifier interface {
+	VerifyTx(txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error)
+}
+
+type verifierKey struct {
+	method  utils.Method
+	network utils.Network
+}
+
+type chainVerifier struct {
+	verifier         TxVerifier
+	minConfirmations int64
+}
+
+func newTxVerifiers(conf ChainConfig) map[verifierKey]chainVerifier {
+	verifiers := make(map[verifierKey]chainVerifier)
+	for _, esplora := range conf.Esplora {
+		if utils.IsEmpty(esplora.BaseUrl) {
+			continue
+		}
+		verifier := chainVerifier{
+			verifier:         newEsploraVerifier(esplora.BaseUrl),
+			minConfirmations: esplora.MinConfirmations,
+		}
+		switch esplora.Network {
+		case utils.NetworkBTC:
+			verifiers[verifierKey{utils.PaymentTypeBTC, utils.NetworkBTC}] = verifier
+		case utils.NetworkLTC:
+			verifiers[verifierKey{utils.PaymentTypeLTC, utils.NetworkLTC}] = verifier
+		default:
+			log.Warnf("esplora backend is not supported for network %s", esplora.Network)
+		}
+	}
+	if !utils.IsEmpty(conf.Dcrdata.BaseUrl) {
+		verifiers[verifierKey{utils.PaymentTypeDCR, utils.NetworkDCR}] = chainVerifier{
+			verifier:         newDcrdataVerifier(conf.Dcrdata.BaseUrl),
+			minConfirmations: conf.Dcrdata.MinConfirmations,
+		}
+	}
+	for _, evm := range conf.Evm {
+		if utils.IsEmpty(evm.RpcUrl) {
+			continue
+		}
+		if evm.Network != utils.NetworkERC20 && evm.Network != utils.NetworkBEP20 {
+			log.Warnf("evm endpoint is not supported for network %s", evm.Network)
+			continue
+		}
+		client := newEvmRpcClient(evm.RpcUrl)
+		for _, token := range evm.Tokens {
+			coin := strings.ToUpper(token.Coin)
+			if !utils.IsCoinNetworkSupported(coin, string(evm.Network)) {
+				log.Warnf("coin %s is not supported on network %s", token.Coin, evm.Network)
+				continue
+			}
+			var contract *common.Address
+			if !utils.IsEmpty(token.Contract) {
+				if !common.IsHexAddress(token.Contract) {
+					log.Warnf("token contract %s of %s is not a valid address", token.Contract, token.Coin)
+					continue
+				}
+				address := common.HexToAddress(token.Contract)
+				contract = &address
+			}
+			verifiers[verifierKey{utils.MethodFromCoin(coin), evm.Network}] = chainVerifier{
+				verifier:         NewEvmTxVerifier(client, contract, token.Decimals),
+				minConfirmations: evm.MinConfirmations,
+			}
+		}
+	}
+	if !utils.IsEmpty(conf.Solana.RpcUrl) {
+		client := newSolanaRpcClient(conf.Solana.RpcUrl)
+		for _, token := range conf.Solana.Tokens {
+			coin := strings.ToUpper(token.Coin)
+			if !utils.IsCoinNetworkSupported(coin, string(utils.NetworkSolana)) {
+				log.Warnf("coin %s is not supported on network %s", token.Coin, utils.NetworkSolana)
+				continue
+			}
+			mint, err := solana.PublicKeyFromBase58(token.Mint)
+			if err != nil {
+				log.Warnf("token mint %s of %s is not a valid address", token.Mint, token.Coin)
+				continue
+			}
+			verifiers[verifierKey{utils.MethodFromCoin(coin), utils.NetworkSolana}] = chainVerifier{
+				verifier:         NewSolanaTxVerifier(client, mint),
+				minConfirmations: conf.Solana.MinConfirmations,
+			}
+		}
+	}
+	return verifiers
+}
+
+// RegisterTxVerifier sets the verifier used for a coin on a network and the confirmations it requires
+func (s *Service) RegisterTxVerifier(method utils.Method, network utils.Network, verifier TxVerifier, minConfirmations int64) {
+	s.txVerifiers[verifierKey{method, network}] = chainVerifier{
+		verifier:         verifier,
+		minConfirmations: minConfirmations,
+	}
+}
+
+// GetTxVerifier returns the verifier for a coin on a network, if one is configured
+func (s *Service) GetTxVerifier(method utils.Method, network utils.Network) (TxVerifier, bool) {
+	verifier, ok := s.txVerifiers[verifierKey{method, network}]
+	return verifier.verifier, ok
+}
+
+// MinConfirmations returns the confirmations a transaction of the coin needs before the payment is paid
+func (s *Service) MinConfirmations(method utils.Method, network utils.Network) int64 {
+	return s.txVerifiers[verifierKey{method, network}].minConfirmations
+}
+
+// ResolvePaymentNetwork returns the network the payment is paid on with the method.
+// The requested network wins, then the network saved on the payment settings and last the default network of the coin
+func (s *Service) ResolvePaymentNetwork(payment storage.Payment, method utils.Method, requested utils.Network) utils.Network {
+	if !utils.IsEmpty(string(requested)) {
+		return requested
+	}
+	for _, setting := range payment.PaymentSettings {
+		if setting.Type == method {
+			return setting.NetworkOrDefault()
+		}
+	}
+	return utils.DefaultNetworkForMethod(method)
+}
+
+// VerifyPaymentTx checks that the transaction pays the expected amount to the payment address.
+// It returns nil verification when no verifier is configured for the coin, the txid is then optional.
+// A coin with a verifier can not be paid without txid
+func (s *Service) VerifyPaymentTx(payment storage.Payment, method utils.Method, network utils.Network, txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	txId = strings.TrimSpace(txId)
+	if utils.IsEmpty(txId) {
+		if _, ok := s.GetTxVerifier(method, network); ok {
+			return nil, utils.NewError(fmt.Errorf("the txid of the %s transaction is required", strings.ToUpper(method.String())), utils.ErrorBadRequest)
+		}
+		return nil, nil
+	}
+	if len(payment.PaymentSettings) > 0 {
+		accepted := false
+		for _, setting := range payment.PaymentSettings {
+			if setting.Type == method && setting.Address == address {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return nil, utils.NewError(fmt.Errorf("the address %s is not accepted by the payment for %s", address, method), utils.ErrorTxVerifyFailed)
+		}
+	}
+	return s.VerifyTx(method, network, txId, address, expectedAmount)
+}
+
+// VerifyTx checks that the transaction pays the expected amount to the address with the verifier of the coin.
+// It returns nil verification when no verifier is configured for the coin on the network.
+// A transaction without the required confirmations is not an error, the payment is confirming until it has them
+func (s *Service) VerifyTx(method utils.Method, network utils.Network, txId, address string, expectedAmount decimal.Decimal) (*TxVerification, error) {
+	verifier, ok := s.GetTxVerifier(method, network)
+	if !ok {
+		return nil, nil
+	}
+	if !expectedAmount.IsPositive() {
+		return nil, utils.NewError(fmt.Errorf("expected amount must be greater than 0"), utils.ErrorTxVerifyFailed)
+	}
+	verification, err := verifier.VerifyTx(txId, address, expectedAmount)
+	if err != nil {
+		log.Warnf("verify tx %s paying to %s failed: %v", txId, address, err)
+		return nil, utils.NewError(err, utils.ErrorTxVerifyFailed)
+	}
+	verification.RequiredConfirmations = s.MinConfirmations(method, network)
+	return verification, nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestVerifyPaymentTxRequiresTxId(t *testing.T) {
+	s := &Service{txVerifiers: newTxVerifiers(ChainConfig{
+		Dcrdata: DcrdataConfig{BaseUrl: "http://dcrdata.invalid"},
+	})}
+	payment := storage.Payment{}
+
+	if _, err := s.VerifyPaymentTx(payment, utils.PaymentTypeDCR, utils.NetworkDCR, " ", dcrdataTestAddress, decimal.NewFromInt(1)); err == nil {
+		t.Error("expected an error without txid for a coin with a verifier")
+	}
+	verification, err := s.VerifyPaymentTx(payment, utils.PaymentTypeLTC, utils.NetworkLTC, "", "ltc1address", decimal.NewFromInt(1))
+	if err != nil || verification != nil {
+		t.Errorf("verification %+v (%v), expected no verification for a coin without verifier", verification, err)
+	}
+}
@@ -99,6 +99,10 @@ func (s *Service) RunMigrations() error {
 	if err := s.syncProjectName(); err != nil {
 		return err
 	}
+	//record the transaction of the payments paid before the partial payments
+	if err := s.syncPaymentTransactions(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTrackInterval  = time.Minute
+	defaultConfirmTimeout = 24 * time.Hour
+)
+
+func (s *Service) trackInterval() time.Duration {
+	if s.Conf.Chain.TrackInterval > 0 {
+		return time.Duration(s.Conf.Chain.TrackInterval) * time.Second
+	}
+	return defaultTrackInterval
+}
+
+func (s *Service) confirmTimeout() time.Duration {
+	if s.Conf.Chain.ConfirmTimeout > 0 {
+		return time.Duration(s.Conf.Chain.ConfirmTimeout) * time.Minute
+	}
+	return defaultConfirmTimeout
+}
+
+// RunConfirmationTracker polls the confirming transactions of the payments until they
+// have the required confirmations or the confirm timeout is over
+func (s *Service) RunConfirmationTracker() {
+	go func() {
+		for range time.Tick(s.trackInterval()) {
+			s.trackConfirmingTransactions()
+		}
+	}()
+}
+
+func (s *Service) trackConfirmingTransactions() {
+	var transactions []storage.PaymentTransaction
+	if err := s.db.Where("status = ?", storage.TransactionStatusConfirming).Find(&transactions).Error; err != nil {
+		log.Errorf("get confirming transactions failed: %v", err)
+		return
+	}
+	for i := range transactions {
+		if err := s.trackTransaction(&transactions[i]); err != nil {
+			log.Errorf("track transaction %d of payment %d failed: %v", transactions[i].Id, transactions[i].PaymentId, err)
+		}
+	}
+}
+
+func (s *Service) trackTransaction(transaction *storage.PaymentTransaction) error {
+	timedOut := time.Since(transaction.ConfirmingAt) > s.confirmTimeout()
+	verifier, ok := s.GetTxVerifier(transaction.PaymentMethod, transaction.PaymentNetwork)
+	if !ok {
+		// the backend of the coin was removed from the config, nothing can confirm the transaction anymore
+		return s.flagTransaction(transaction, fmt.Sprintf("no backend is configured to verify %s on %s", transaction.PaymentMethod, transaction.PaymentNetwork))
+	}
+	verification, err := verifier.VerifyTx(transaction.TxId, transaction.PaymentAddress, transaction.ExpectedAmount)
+	if err != nil {
+		// the transaction may not be seen by the backend yet, retry until the timeout
+		if timedOut {
+			return s.flagTransaction(transaction, err.Error())
+		}
+		log.Debugf("verify tx %s of payment %d failed: %v", transaction.TxId, transaction.PaymentId, err)
+		return nil
+	}
+
+	minConfirmations := s.MinConfirmations(transaction.PaymentMethod, transaction.PaymentNetwork)
+	verification.RequiredConfirmations = minConfirmations
+	if verification.Final() {
+		return s.confirmTransaction(transaction, verification.Confirmations)
+	}
+	if timedOut {
+		return s.flagTransaction(transaction, fmt.Sprintf("transaction %s has %d of %d required confirmations after %s",
+			transaction.TxId, verification.Confirmations, minConfirmations, s.confirmTimeout()))
+	}
+	if verification.Confirmations == transaction.Confirmations {
+		return nil
+	}
+	transaction.Confirmations = verification.Confirmations
+	return s.updateTransaction(transaction, map[string]interface{}{
+		"confirmations": transaction.Confirmations,
+	})
+}
+
+// confirmTransaction counts the confirming transaction in the paid amount of its payment
+func (s *Service) confirmTransaction(transaction *storage.PaymentTransaction, confirmations int64) error {
+	transaction.Status = storage.TransactionStatusConfirmed
+	transaction.Confirmations = confirmations
+	transaction.PaidAt = time.Now()
+	if err := s.updateTransaction(transaction, map[string]interface{}{
+		"status":        transaction.Status,
+		"confirmations": transaction.Confirmations,
+		"paid_at":       transaction.PaidAt,
+	}); err != nil {
+		return err
+	}
+	log.Infof("transaction %s of payment %d is confirmed with %d confirmations", transaction.TxId, transaction.PaymentId, confirmations)
+	return nil
+}
+
+// flagTransaction removes the transaction from the paid amount so the payer can submit another one
+func (s *Service) flagTransaction(transaction *storage.PaymentTransaction, reason string) error {
+	transaction.Status = storage.TransactionStatusFlagged
+	transaction.FlagReason = reason
+	if err := s.updateTransaction(transaction, map[string]interface{}{
+		"status":      transaction.Status,
+		"flag_reason": transaction.FlagReason,
+	}); err != nil {
+		return err
+	}
+	log.Warnf("transaction %s of payment %d was flagged: %s", transaction.TxId, transaction.PaymentId, reason)
+	return nil
+}
+
+// updateTransaction saves the columns of the transaction then the status of its payment
+func (s *Service) updateTransaction(transaction *storage.PaymentTransaction, columns map[string]interface{}) error {
+	var payment storage.Payment
+	var action storage.PaymentAction
+	switch transaction.Status {
+	case storage.TransactionStatusConfirmed:
+		action = storage.PaymentActionTransactionConfirmed
+	case storage.TransactionStatusFlagged:
+		action = storage.PaymentActionTransactionFlagged
+	default:
+		// the confirming transaction got more confirmations, it is not confirmed yet
+		action = storage.PaymentActionTransactionConfirmations
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(transaction).UpdateColumns(columns).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", transaction.PaymentId).First(&payment).Error; err != nil {
+			return err
+		}
+		before := storage.NewPaymentSnapshot(payment)
+		from := payment.Status
+		if err := s.refreshPaymentStatus(tx, &payment); err != nil {
+			return err
+		}
+		if err := storage.CheckPaymentTransition(from, payment.Status, storage.PaymentRoleSystem, payment.IsCreditNote()); err != nil {
+			return err
+		}
+		return recordPaymentEvent(tx, before, payment, 0, action)
+	})
+	if err != nil {
+		return err
+	}
+	s.broadcastPaymentChanged(&payment)
+	return nil
+}
+
+// broadcastPaymentChanged notifies the sender and the receiver of the payment
+func (s *Service) broadcastPaymentChanged(payment *storage.Payment) {
+	data := map[string]interface{}{
+		"id":            payment.Id,
+		"status":        payment.Status,
+		"confirmations": payment.Confirmations,
+		"txFlagged":     payment.TxFlagged,
+		"paidAmount":    payment.PaidAmount,
+	}
+	for _, userId := range []uint64{payment.SenderId, payment.ReceiverId} {
+		if userId == 0 {
+			continue
+		}
+		s.socket.BroadcastToRoom("", fmt.Sprint(userId), "reloadList", data)
+	}
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateCreditNote issues a credit note of the paid payment from its sender to its receiver.
+// The credit note goes through the approvers of the payment like an invoice before it can be refunded
+func (s *Service) CreateCreditNote(userId uint64, request portal.CreditNoteRequest) (*storage.Payment, error) {
+	original, err := s.creditedPayment(request.PaymentId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.CheckPaymentTransition(storage.PaymentStatusCreated, request.Status, storage.PaymentRoleSender, true); err != nil {
+		return nil, err
+	}
+	approvers := make(storage.Approvers, 0, len(original.Approvers))
+	for _, approver := range original.Approvers {
+		approver.IsApproved = approver.ApproverId == original.SenderId || approver.ApproverId == original.ReceiverId
+		approvers = append(approvers, approver)
+	}
+	creditNote := storage.Payment{
+		SenderId:            original.SenderId,
+		SenderName:          original.SenderName,
+		SenderDisplayName:   original.SenderDisplayName,
+		ReceiverId:          original.ReceiverId,
+		ReceiverName:        original.ReceiverName,
+		ReceiverDisplayName: original.ReceiverDisplayName,
+		ExternalEmail:       original.ExternalEmail,
+		ContactMethod:       original.ContactMethod,
+		Currency:            original.Currency.OrDefault(),
+		PaymentType:         original.PaymentType,
+		ProjectId:           original.ProjectId,
+		ProjectName:         original.ProjectName,
+		Approvers:           approvers,
+		Details:             make(storage.PaymentDetails, 0),
+		PaymentSettings:     make(storage.PaymentSettings, 0),
+		StartDate:           time.Now(),
+		CreditNoteOf:        original.Id,
+	}
+	applyCreditNoteRequest(&creditNote, request)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkCreditAmount(tx, original.Id, 0, request.Amount); err != nil {
+			return err
+		}
+		if err := assignInvoiceNumber(tx, &creditNote); err != nil {
+			return err
+		}
+		if err := tx.Create(&creditNote).Error; err != nil {
+			return invoiceNumberError(err, creditNote.InvoiceNumber)
+		}
+		return recordPaymentEvent(tx, nil, creditNote, userId, storage.PaymentActionCreated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &creditNote, nil
+}
+
+// UpdateCreditNote updates the draft credit note of the sender, it is sent when the status is sent
+func (s *Service) UpdateCreditNote(id, userId uint64, request portal.CreditNoteRequest) (*storage.Payment, error) {
+	creditNote, err := s.senderCreditNote(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if creditNote.Status != storage.PaymentStatusCreated {
+		return nil, utils.NewError(fmt.Errorf("only a draft credit note can be updated"), utils.ErrorBadRequest)
+	}
+	if err := storage.CheckVersion(creditNote, request.Version); err != nil {
+		return nil, err
+	}
+	if err := creditNote.CheckTransition(request.Status, storage.PaymentRoleSender); err != nil {
+		return nil, err
+	}
+	before := storage.NewPaymentSnapshot(*creditNote)
+	applyCreditNoteRequest(creditNote, request)
+	action := storage.PaymentActionUpdated
+	if creditNote.Status == storage.PaymentStatusSent {
+		action = storage.PaymentActionSent
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkCreditAmount(tx, creditNote.CreditNoteOf, creditNote.Id, request.Amount); err != nil {
+			return err
+		}
+		if err := assignInvoiceNumber(tx, creditNote); err != nil {
+			return err
+		}
+		if err := storage.UpdateVersioned(tx, creditNote); err != nil {
+			return invoiceNumberError(err, creditNote.InvoiceNumber)
+		}
+		return recordPaymentEvent(tx, before, *creditNote, userId, action)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return creditNote, nil
+}
+
+// RefundCreditNote settles the approved credit note. The refund tx is verified on chain in the coin the credited
+// payment was paid with and at its rate when the coin has a verifier, the credit note is settled as kept as credit
+// when there is no refund tx
+func (s *Service) RefundCreditNote(id, userId uint64, request portal.CreditNoteRefund) (*storage.Payment, error) {
+	creditNote, err := s.senderCreditNote(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if creditNote.Status == storage.PaymentStatusPaid {
+		return nil, utils.NewError(fmt.Errorf("the credit note was settled"), utils.ErrorInvalidTransition)
+	}
+	if err := storage.CheckVersion(creditNote, request.Version); err != nil {
+		return nil, err
+	}
+	if err := creditNote.CheckTransition(storage.PaymentStatusPaid, storage.PaymentRoleSender); err != nil {
+		return nil, err
+	}
+	for _, approver := range creditNote.Approvers {
+		if !approver.IsApproved {
+			return nil, utils.NewError(fmt.Errorf("the credit note is waiting for the approval of %s", approver.ApproverName), utils.ErrorBadRequest)
+		}
+	}
+	before := storage.NewPaymentSnapshot(*creditNote)
+	if !utils.IsEmpty(request.RefundAddress) {
+		creditNote.RefundAddress = strings.TrimSpace(request.RefundAddress)
+	}
+	creditNote.RefundTxId = strings.TrimSpace(request.RefundTxId)
+	action := storage.PaymentActionKeptAsCredit
+	if !utils.IsEmpty(creditNote.RefundTxId) {
+		if err := s.verifyRefund(creditNote); err != nil {
+			return nil, err
+		}
+		action = storage.PaymentActionRefunded
+	}
+	creditNote.Status = storage.PaymentStatusPaid
+	creditNote.PaidAt = time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := storage.UpdateVersioned(tx, creditNote); err != nil {
+			return err
+		}
+		return recordPaymentEvent(tx, before, *creditNote, userId, action)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return creditNote, nil
+}
+
+// verifyRefund checks the refund tx pays the credited amount to the refund address in the coin of the credited
+// payment, converted at the rate it was paid at. The refund is recorded as sent when the coin has no verifier
+func (s *Service) verifyRefund(creditNote *storage.Payment) error {
+	if utils.IsEmpty(creditNote.RefundAddress) {
+		return utils.NewError(fmt.Errorf("the refund address is required with the refund tx"), utils.ErrorBadRequest)
+	}
+	var original storage.Payment
+	if err := s.db.Where("id = ?", creditNote.CreditNoteOf).First(&original).Error; err != nil {
+		return err
+	}
+	method := original.PaymentMethod
+	network := s.ResolvePaymentNetwork(original, method, original.PaymentNetwork)
+	if _, ok := s.GetTxVerifier(method, network); !ok {
+		return nil
+	}
+	if !original.ConvertRate.IsPositive() {
+		return utils.NewError(fmt.Errorf("the rate the payment was paid at is unknown, the refund can not be verified"), utils.ErrorBadRequest)
+	}
+	expected := utils.ConvertToCoin(creditNote.Amount.Abs(), original.ConvertRate, method)
+	verification, err := s.VerifyTx(method, network, creditNote.RefundTxId, creditNote.RefundAddress, expected)
+	if err != nil {
+		return err
+	}
+	creditNote.PaymentMethod = method
+	creditNote.PaymentNetwork = network
+	creditNote.ConvertRate = original.ConvertRate
+	creditNote.ExpectedAmount = expected
+	creditNote.TxVerified = true
+	creditNote.Confirmations = verification.Confirmations
+	return nil
+}
+
+// GetCreditNotes returns the credit notes of the payment, the drafts are only returned to the sender
+func (s *Service) GetCreditNotes(payment storage.Payment, userId uint64) ([]storage.Payment, error) {
+	creditNotes := make([]storage.Payment, 0)
+	builder := s.db.Where("credit_note_of = ?", payment.Id)
+	if userId != payment.SenderId {
+		builder = builder.Where("status <> ?", storage.PaymentStatusCreated)
+	}
+	if err := builder.Order("created_at").Find(&creditNotes).Error; err != nil {
+		return nil, err
+	}
+	return creditNotes, nil
+}
+
+// creditedPayment returns the paid payment the sender credits
+func (s *Service) creditedPayment(id, userId uint64) (storage.Payment, error) {
+	var payment storage.Payment
+	if err := s.db.Where("id = ?", id).First(&payment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return payment, utils.NotFoundError
+		}
+		return payment, err
+	}
+	if payment.SenderId != userId {
+		return payment, utils.ForbiddenError
+	}
+	if payment.IsCreditNote() {
+		return payment, utils.NewError(fmt.Errorf("a credit note can not be credited"), utils.ErrorBadRequest)
+	}
+	if payment.Status != storage.PaymentStatusPaid {
+		return payment, utils.NewError(fmt.Errorf("only a paid payment can be credited"), utils.ErrorBadRequest)
+	}
+	return payment, nil
+}
+
+func (s *Service) senderCreditNote(id, userId uint64) (*storage.Payment, error) {
+	var creditNote storage.Payment
+	if err := s.db.Where("id = ? AND credit_note_of > 0", id).First(&creditNote).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NotFoundError
+		}
+		return nil, err
+	}
+	if creditNote.SenderId != userId {
+		return nil, utils.ForbiddenError
+	}
+	return &creditNote, nil
+}
+
+// checkCreditAmount checks the credited amount is positive and the credit notes of the payment,
+// except the updated one, do not credit more than its amount. The payment is locked until the transaction
+// saving the credit note ends, so two credit notes can not credit the same amount
+func checkCreditAmount(tx *gorm.DB, originalId, updatedId uint64, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return utils.NewError(fmt.Errorf("the credited amount must be greater than 0"), utils.ErrorBadRequest)
+	}
+	var original storage.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", originalId).First(&original).Error; err != nil {
+		return err
+	}
+	var credited decimal.NullDecimal
+	err := tx.Model(&storage.Payment{}).Select("SUM(-amount)").
+		Where("credit_note_of = ? AND id <> ? AND status <> ?", original.Id, updatedId, storage.PaymentStatusRejected).
+		Scan(&credited).Error
+	if err != nil {
+		return err
+	}
+	creditable := original.Amount.Sub(credited.Decimal)
+	if amount.GreaterThan(creditable) {
+		return utils.NewError(fmt.Errorf("the credited amount must not be greater than %s", creditable), utils.ErrorBadRequest)
+	}
+	return nil
+}
+
+func applyCreditNoteRequest(creditNote *storage.Payment, request portal.CreditNoteRequest) {
+	creditNote.CreditReason = request.Reason
+	creditNote.Description = request.Description
+	if utils.IsEmpty(creditNote.Description) {
+		creditNote.Description = request.Reason
+	}
+	creditNote.RefundAddress = request.RefundAddress
+	creditNote.RefundTxId = request.RefundTxId
+	amountTotals(request.Amount.Neg()).apply(creditNote)
+	creditNote.Status = request.Status
+	if creditNote.Status == storage.PaymentStatusSent {
+		creditNote.SentAt = time.Now()
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultGapLimit is the gap limit used by most wallets (BIP44) when they scan for used addresses
+const defaultGapLimit = 20
+
+func (s *Service) gapLimit() int64 {
+	if s.Conf.GapLimit > 0 {
+		return int64(s.Conf.GapLimit)
+	}
+	return defaultGapLimit
+}
+
+// reserveDerivedAddress returns the address of the extended key payment method the next payment is paid to.
+// An address released by a deleted payment is reused first, then the next index is derived while the
+// unpaid addresses stay below the gap limit so the wallet of the user can still find the payments
+func (s *Service) reserveDerivedAddress(tx *gorm.DB, methodId uint64) (*storage.DerivedAddress, error) {
+	var method storage.UserPaymentMethod
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", methodId).First(&method).Error; err != nil {
+		return nil, err
+	}
+	if !method.IsExtendedKey() {
+		return nil, fmt.Errorf("payment method %d has no extended key", methodId)
+	}
+
+	var released storage.DerivedAddress
+	err := tx.Where("user_payment_method_id = ? AND payment_id NOT IN (SELECT id FROM payments)", methodId).
+		Order("derivation_index").First(&released).Error
+	if err == nil {
+		return &released, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var lastUsed sql.NullInt64
+	err = tx.Raw(`SELECT MAX(d.derivation_index) FROM derived_addresses d JOIN payments p ON p.id = d.payment_id
+		WHERE d.user_payment_method_id = ? AND p.status IN ?`, methodId,
+		[]storage.PaymentStatus{storage.PaymentStatusPaid, storage.PaymentStatusConfirming, storage.PaymentStatusPartiallyPaid}).Scan(&lastUsed).Error
+	if err != nil {
+		return nil, err
+	}
+	unused := int64(method.NextIndex)
+	if lastUsed.Valid {
+		unused = int64(method.NextIndex) - lastUsed.Int64 - 1
+	}
+	if unused >= s.gapLimit() {
+		return nil, utils.NewError(fmt.Errorf("the payment method %s has %d unpaid addresses, the gap limit of %d is reached",
+			method.Label, unused, s.gapLimit()), utils.ErrorBadRequest)
+	}
+
+	address, err := utils.DeriveAddress(method.ExtendedKey, utils.NetworkFromCode(method.Network), method.NextIndex)
+	if err != nil {
+		return nil, utils.NewError(err, utils.ErrorBadRequest)
+	}
+	derived := &storage.DerivedAddress{
+		UserPaymentMethodId: method.Id,
+		DerivationIndex:     method.NextIndex,
+		Address:             address,
+	}
+	if err := tx.Create(derived).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&method).UpdateColumn("next_index", method.NextIndex+1).Error; err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
+
+// reservePaymentAddress derives the address of the sent payment paid to an extended key payment method.
+// The drafts get their address when they are sent so they do not count in the gap limit of the method,
+// a payment keeps the address derived for it. The caller links the returned address to the saved payment
+func (s *Service) reservePaymentAddress(tx *gorm.DB, payment *storage.Payment) (*storage.DerivedAddress, error) {
+	if payment.Status == storage.PaymentStatusCreated || payment.UserPaymentMethodId == nil || *payment.UserPaymentMethodId == 0 {
+		return nil, nil
+	}
+	if payment.Id > 0 {
+		var reserved int64
+		if err := tx.Model(&storage.DerivedAddress{}).Where("payment_id = ?", payment.Id).Count(&reserved).Error; err != nil {
+			return nil, err
+		}
+		if reserved > 0 {
+			return nil, nil
+		}
+	}
+	var method storage.UserPaymentMethod
+	if err := tx.Where("id = ?", *payment.UserPaymentMethodId).First(&method).Error; err != nil {
+		return nil, err
+	}
+	if !method.IsExtendedKey() {
+		return nil, nil
+	}
+	derived, err := s.reserveDerivedAddress(tx, method.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(payment.PaymentSettings) == 0 {
+		payment.PaymentSettings = storage.PaymentSettings{{
+			Type:    getCoinMethodType(method.Coin),
+			Network: utils.NetworkFromCode(method.Network),
+		}}
+	}
+	payment.PaymentSettings[0].Address = derived.Address
+	payment.PaymentAddress = derived.Address
+	return derived, nil
+}
+
+// GetDerivedAddresses returns the addresses derived from the extended key of a payment method
+func (s *Service) GetDerivedAddresses(methodId, userId uint64) ([]storage.DerivedAddress, error) {
+	if _, err := s.GetPaymentMethod(methodId, userId); err != nil {
+		return nil, err
+	}
+	var addresses []storage.DerivedAddress
+	if err := s.db.Where("user_payment_method_id = ?", methodId).Order("derivation_index").Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
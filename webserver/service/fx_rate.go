@@ -0,0 +1,225 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Frankfurter = "frankfurter"
+
+	frankfurterURL  = "https://api.frankfurter.app/latest"
+	defaultFxTTL    = 10 * time.Minute
+	defaultFxSource = Frankfurter
+	// rateDecimals is the precision of the coin rates converted to another currency
+	rateDecimals = 8
+)
+
+// FxConfig configures the provider of the fiat exchange rates used for the invoices not issued in USD
+type FxConfig struct {
+	// Provider is "frankfurter" (ECB reference rates) or "static"
+	Provider string `yaml:"provider"`
+	BaseUrl  string `yaml:"baseUrl"`
+	Timeout  int    `yaml:"timeout"`
+	// CacheTtl is the number of seconds the fiat rates are cached
+	CacheTtl int `yaml:"cacheTtl"`
+	// Rates are the USD values of a unit of the currencies for the static provider, e.g. EUR: 1.08
+	Rates map[string]float64 `yaml:"rates"`
+	// ReportingCurrency is the currency the amounts of the reports are converted to
+	ReportingCurrency string `yaml:"reportingCurrency"`
+}
+
+// FxProvider returns the amount of the quote currency a unit of the base currency is worth
+type FxProvider interface {
+	GetFxRate(base, quote utils.Currency) (float64, error)
+}
+
+type frankfurterResponse struct {
+	Amount float64            `json:"amount"`
+	Base   string             `json:"base"`
+	Date   string             `json:"date"`
+	Rates  map[string]float64 `json:"rates"`
+}
+
+type frankfurterProvider struct {
+	baseUrl string
+	timeout time.Duration
+}
+
+func (p *frankfurterProvider) GetFxRate(base, quote utils.Currency) (float64, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: p.baseUrl,
+		Payload: map[string]string{
+			"from": base.String(),
+			"to":   quote.String(),
+		},
+		Timeout: p.timeout,
+	}
+	var res frankfurterResponse
+	if err := HttpRequest(req, &res); err != nil {
+		return 0, err
+	}
+	rate, ok := res.Rates[quote.String()]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("get %s/%s rate failed", base, quote)
+	}
+	return rate, nil
+}
+
+// staticFxProvider converts with the USD values of the currencies set in the config
+type staticFxProvider struct {
+	usdRates map[string]float64
+}
+
+func (p *staticFxProvider) GetFxRate(base, quote utils.Currency) (float64, error) {
+	baseUsd, err := p.usdRate(base)
+	if err != nil {
+		return 0, err
+	}
+	quoteUsd, err := p.usdRate(quote)
+	if err != nil {
+		return 0, err
+	}
+	return baseUsd / quoteUsd, nil
+}
+
+func (p *staticFxProvider) usdRate(currency utils.Currency) (float64, error) {
+	if currency.OrDefault() == utils.CurrencyUSD {
+		return 1, nil
+	}
+	rate, ok := p.usdRates[currency.String()]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no static rate for %s", currency)
+	}
+	return rate, nil
+}
+
+func newFxProvider(conf FxConfig) FxProvider {
+	switch strings.ToLower(conf.Provider) {
+	case Static:
+		usdRates := make(map[string]float64)
+		for currency, rate := range conf.Rates {
+			usdRates[strings.ToUpper(currency)] = rate
+		}
+		return &staticFxProvider{usdRates: usdRates}
+	case "", defaultFxSource:
+	default:
+		log.Warnf("unknown fx provider %s, %s is used", conf.Provider, defaultFxSource)
+	}
+	timeout := defaultHttpClientTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	baseUrl := conf.BaseUrl
+	if utils.IsEmpty(baseUrl) {
+		baseUrl = frankfurterURL
+	}
+	return &frankfurterProvider{baseUrl: baseUrl, timeout: timeout}
+}
+
+type cachedFxRate struct {
+	rate      float64
+	fetchedAt time.Time
+}
+
+type fxCache struct {
+	mtx   sync.Mutex
+	rates map[string]cachedFxRate
+}
+
+func newFxCache() *fxCache {
+	return &fxCache{rates: make(map[string]cachedFxRate)}
+}
+
+func (s *Service) fxTTL() time.Duration {
+	if s.Conf.Fx.CacheTtl > 0 {
+		return time.Duration(s.Conf.Fx.CacheTtl) * time.Second
+	}
+	return defaultFxTTL
+}
+
+// SetFxProvider replaces the provider of the fiat rates
+func (s *Service) SetFxProvider(provider FxProvider) {
+	s.fxCache.mtx.Lock()
+	defer s.fxCache.mtx.Unlock()
+	s.fxProvider = provider
+	s.fxCache.rates = make(map[string]cachedFxRate)
+}
+
+// GetFxRate returns the amount of the quote currency a unit of the base currency is worth
+func (s *Service) GetFxRate(base, quote utils.Currency) (float64, error) {
+	base, quote = base.OrDefault(), quote.OrDefault()
+	if base == quote {
+		return 1, nil
+	}
+	key := fmt.Sprintf("%s/%s", base, quote)
+	s.fxCache.mtx.Lock()
+	defer s.fxCache.mtx.Unlock()
+	if cached, ok := s.fxCache.rates[key]; ok && time.Since(cached.fetchedAt) < s.fxTTL() {
+		return cached.rate, nil
+	}
+	rate, err := s.fxProvider.GetFxRate(base, quote)
+	if err != nil {
+		// an outdated rate is better than no invoice conversion at all
+		if cached, ok := s.fxCache.rates[key]; ok {
+			log.Warnf("get %s rate failed, the rate of %s is used: %v", key, cached.fetchedAt, err)
+			return cached.rate, nil
+		}
+		return 0, err
+	}
+	s.fxCache.rates[key] = cachedFxRate{rate: rate, fetchedAt: time.Now()}
+	return rate, nil
+}
+
+// ConvertAmount converts the fiat amount between the currencies
+func (s *Service) ConvertAmount(amount decimal.Decimal, from, to utils.Currency) (decimal.Decimal, error) {
+	rate, err := s.GetFxRate(from, to)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.Mul(decimal.NewFromFloat(rate)), nil
+}
+
+// RateInCurrency converts the USDT rate of a coin to the rate in the currency of an invoice
+func (s *Service) RateInCurrency(usdRate decimal.Decimal, currency utils.Currency) (decimal.Decimal, error) {
+	if currency.OrDefault() == utils.CurrencyUSD {
+		return usdRate, nil
+	}
+	usdValue, err := s.GetFxRate(currency, utils.CurrencyUSD)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return usdRate.DivRound(decimal.NewFromFloat(usdValue), rateDecimals), nil
+}
+
+// ReportingCurrency returns the currency the amounts of the reports are converted to
+func (s *Service) ReportingCurrency() utils.Currency {
+	currency, err := utils.ParseCurrency(s.Conf.Fx.ReportingCurrency)
+	if err != nil {
+		return utils.DefaultCurrency
+	}
+	return currency
+}
+
+// ToReportingAmount converts the amount and the tax of the payment to the reporting currency.
+// The report is not built when the fiat rate can not be fetched, like the totals of sumCurrencyTotals
+func (s *Service) ToReportingAmount(payment storage.Payment) (float64, float64, error) {
+	currency := s.ReportingCurrency()
+	amount, err := s.ConvertAmount(payment.Amount, payment.Currency, currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("convert amount of payment %d: %v", payment.Id, err)
+	}
+	tax, err := s.ConvertAmount(payment.TaxAmount, payment.Currency, currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("convert tax of payment %d: %v", payment.Id, err)
+	}
+	return amount.InexactFloat64(), tax.InexactFloat64(), nil
+}
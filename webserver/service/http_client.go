@@ -19,11 +19,14 @@ type HttpClient struct {
 }
 
 type ReqConfig struct {
+	// Context cancels the request, the request is only cancelled by its timeout when it is nil
+	Context  context.Context
 	Payload  interface{}
 	Method   string
 	HttpUrl  string
 	Header   map[string]string
 	FormData url.Values
+	Timeout  time.Duration
 }
 
 const defaultHttpClientTimeout = 30 * time.Second
@@ -86,7 +89,11 @@ func (c *HttpClient) query(reqConfig *ReqConfig) (resp *http.Response, err error
 	}
 
 	// Create http request
-	req, err := http.NewRequestWithContext(c.context, reqConfig.Method, reqConfig.HttpUrl, body)
+	ctx := c.context
+	if reqConfig.Context != nil {
+		ctx = reqConfig.Context
+	}
+	req, err := http.NewRequestWithContext(ctx, reqConfig.Method, reqConfig.HttpUrl, body)
 	if err != nil {
 		return nil, fmt.Errorf("error creating http request: %v", err)
 	}
@@ -122,6 +129,9 @@ func (c *HttpClient) query(reqConfig *ReqConfig) (resp *http.Response, err error
 // the returned json(Byte data) into an respObj interface.
 func HttpRequest(reqConfig *ReqConfig, respObj interface{}) error {
 	client := newClient()
+	if reqConfig.Timeout > 0 {
+		client.httpClient.Timeout = reqConfig.Timeout
+	}
 
 	httpResp, err := client.query(reqConfig)
 	if err != nil {
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// GetInvoiceNumbering returns the numbering scheme of the invoices of the user, or the default one
+func (s *Service) GetInvoiceNumbering(userId uint64) (storage.InvoiceNumbering, error) {
+	return getInvoiceNumbering(s.db, userId)
+}
+
+// UpdateInvoiceNumbering saves the numbering scheme of the user, it applies to the invoices sent afterwards.
+// The sequence is not reset, the next invoice continues the numbers of the year
+func (s *Service) UpdateInvoiceNumbering(userId uint64, request portal.InvoiceNumberingRequest) (storage.InvoiceNumbering, error) {
+	numbering, err := s.GetInvoiceNumbering(userId)
+	if err != nil {
+		return numbering, err
+	}
+	numbering.Prefix = request.Prefix
+	numbering.YearlyReset = request.YearlyReset
+	numbering.Padding = request.Padding
+	if err := s.db.Save(&numbering).Error; err != nil {
+		return numbering, err
+	}
+	return numbering, nil
+}
+
+func getInvoiceNumbering(db *gorm.DB, userId uint64) (storage.InvoiceNumbering, error) {
+	var numbering storage.InvoiceNumbering
+	err := db.Where("user_id = ?", userId).First(&numbering).Error
+	if err == gorm.ErrRecordNotFound {
+		return storage.DefaultInvoiceNumbering(userId), nil
+	}
+	return numbering, err
+}
+
+// assignInvoiceNumber gives the sent payment the next number of its sender. The sequence is incremented in
+// the transaction saving the payment: the sequence row stays locked until the transaction ends so the concurrent
+// invoices of the sender are numbered one after another, and a rollback releases the number so there is no gap
+func assignInvoiceNumber(tx *gorm.DB, payment *storage.Payment) error {
+	if len(payment.InvoiceNumber) > 0 || payment.Status == storage.PaymentStatusCreated {
+		return nil
+	}
+	numbering, err := getInvoiceNumbering(tx, payment.SenderId)
+	if err != nil {
+		return err
+	}
+	sentAt := payment.SentAt
+	if sentAt.IsZero() {
+		sentAt = time.Now()
+	}
+	year := numbering.SequenceYear(sentAt)
+	var number int64
+	err = tx.Raw(`INSERT INTO invoice_number_sequences (user_id, year, last_number, updated_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (user_id, year) DO UPDATE SET last_number = invoice_number_sequences.last_number + 1, updated_at = EXCLUDED.updated_at
+		RETURNING last_number`, payment.SenderId, year, time.Now()).Scan(&number).Error
+	if err != nil {
+		return err
+	}
+	invoiceNumber := numbering.Format(year, number)
+	var used int64
+	err = tx.Model(&storage.Payment{}).Where("sender_id = ? AND invoice_number = ? AND id <> ?", payment.SenderId, invoiceNumber, payment.Id).Count(&used).Error
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return invoiceNumberUsedError(invoiceNumber)
+	}
+	payment.InvoiceNumber = invoiceNumber
+	return nil
+}
+
+// invoiceNumberError returns a clear error when the payment can not be saved because its number is used by another
+// invoice of the sender
+func invoiceNumberError(err error, invoiceNumber string) error {
+	if e, ok := err.(*pgconn.PgError); ok && e.Code == utils.PgsqlDuplicateErrorCode && e.ConstraintName == storage.PaymentInvoiceNumberIndex {
+		return invoiceNumberUsedError(invoiceNumber)
+	}
+	return err
+}
+
+func invoiceNumberUsedError(invoiceNumber string) error {
+	return utils.NewError(fmt.Errorf("the invoice number %s is already used, please change the prefix of the invoice numbering", invoiceNumber), utils.ErrorObjectExist)
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/shopspring/decimal"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const (
+	pdfMargin     = 15.0
+	pdfPageWidth  = 210.0 - 2*pdfMargin
+	pdfLineHeight = 6.0
+	pdfDateLayout = "Jan 02, 2006"
+	// pdfFont is the embedded utf-8 font of the invoices, the names and descriptions are not limited to cp1252
+	pdfFont = "Go"
+)
+
+// pdfColumn is a column of the line items table, the column with no width takes the remaining width
+type pdfColumn struct {
+	title string
+	width float64
+	align string
+	value func(detail storage.PaymentDetail) string
+}
+
+// invoicePdf renders the invoice of a payment on an A4 page
+type invoicePdf struct {
+	pdf     *gofpdf.Fpdf
+	payment storage.Payment
+}
+
+// RenderInvoicePDF renders the invoice of the payment with its line items, totals, payment instructions
+// and the transactions that paid it
+func (s *Service) RenderInvoicePDF(payment storage.Payment, transactions []storage.PaymentTransaction) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(invoiceLabel(payment), true)
+	pdf.AddUTF8FontFromBytes(pdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", gobold.TTF)
+	pdf.AddPage()
+	invoice := &invoicePdf{
+		pdf:     pdf,
+		payment: payment,
+	}
+	invoice.header()
+	invoice.parties()
+	invoice.lineItems()
+	invoice.totals()
+	if payment.Status == storage.PaymentStatusPaid {
+		invoice.paidStatus(transactions)
+	} else {
+		invoice.paymentInstructions(transactions)
+	}
+	if err := pdf.Error(); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := pdf.Output(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *invoicePdf) text(style string, size float64, width float64, align string, text string) {
+	p.pdf.SetFont(pdfFont, style, size)
+	p.pdf.CellFormat(width, pdfLineHeight, text, "", 0, align, false, 0, "")
+}
+
+func (p *invoicePdf) line(style string, size float64, text string) {
+	p.pdf.SetFont(pdfFont, style, size)
+	p.pdf.MultiCell(pdfPageWidth, pdfLineHeight, text, "", "L", false)
+}
+
+func (p *invoicePdf) section(title string) {
+	p.pdf.Ln(4)
+	p.line("B", 11, title)
+}
+
+func (p *invoicePdf) amount(amount decimal.Decimal) string {
+	return fmt.Sprintf("%s %s", amount.StringFixed(2), p.payment.Currency.OrDefault())
+}
+
+func (p *invoicePdf) header() {
+	title := "INVOICE"
+	if p.payment.IsCreditNote() {
+		title = "CREDIT NOTE"
+	}
+	p.text("B", 20, pdfPageWidth/2, "L", title)
+	p.text("B", 12, pdfPageWidth/2, "R", p.payment.DisplayNumber())
+	p.pdf.Ln(10)
+	issuedAt := p.payment.SentAt
+	if issuedAt.IsZero() {
+		issuedAt = p.payment.CreatedAt
+	}
+	p.text("", 10, pdfPageWidth/2, "L", "Date: "+issuedAt.Format(pdfDateLayout))
+	p.text("B", 10, pdfPageWidth/2, "R", "Status: "+strings.ToUpper(p.payment.Status.String()))
+	p.pdf.Ln(pdfLineHeight)
+	if p.payment.ShowProjectOnInvoice && !utils.IsEmpty(p.payment.ProjectName) {
+		p.line("", 10, "Project: "+p.payment.ProjectName)
+	}
+	if p.payment.IsCreditNote() {
+		p.line("", 10, fmt.Sprintf("Credits payment #%d: %s", p.payment.CreditNoteOf, p.payment.CreditReason))
+	}
+}
+
+func (p *invoicePdf) parties() {
+	sender := firstNonEmpty(p.payment.SenderDisplayName, p.payment.SenderName)
+	receiver := firstNonEmpty(p.payment.ReceiverDisplayName, p.payment.ReceiverName)
+	if p.payment.ContactMethod == storage.PaymentTypeEmail {
+		receiver = p.payment.ExternalEmail
+	}
+	p.pdf.Ln(4)
+	p.text("B", 10, pdfPageWidth/2, "L", "From")
+	p.text("B", 10, pdfPageWidth/2, "L", "Bill to")
+	p.pdf.Ln(pdfLineHeight)
+	p.text("", 10, pdfPageWidth/2, "L", sender)
+	p.text("", 10, pdfPageWidth/2, "L", receiver)
+	p.pdf.Ln(pdfLineHeight)
+	if !utils.IsEmpty(p.payment.Description) {
+		p.pdf.Ln(2)
+		p.line("", 10, p.payment.Description)
+	}
+}
+
+// columns returns the columns of the line items, the date and project columns are shown as the sender chose,
+// the type and tax columns when a line is not labor or has its own tax rate
+func (p *invoicePdf) columns() []pdfColumn {
+	columns := make([]pdfColumn, 0, 8)
+	showType, showTax := false, false
+	for _, detail := range p.payment.Details {
+		showType = showType || !detail.Type.IsLabor()
+		showTax = showTax || detail.TaxRate != nil
+	}
+	if p.payment.ShowDateOnInvoiceLine {
+		columns = append(columns, pdfColumn{title: "Date", width: 24, align: "L", value: func(detail storage.PaymentDetail) string {
+			return utils.HandlerDateFormat(detail.Date)
+		}})
+	}
+	columns = append(columns, pdfColumn{title: "Description", align: "L", value: func(detail storage.PaymentDetail) string {
+		return detail.Description
+	}})
+	if showType {
+		columns = append(columns, pdfColumn{title: "Type", width: 18, align: "L", value: func(detail storage.PaymentDetail) string {
+			if detail.Type.IsLabor() {
+				return string(storage.LineTypeLabor)
+			}
+			return string(detail.Type)
+		}})
+	}
+	if p.payment.ShowProjectOnInvoice {
+		columns = append(columns, pdfColumn{title: "Project", width: 32, align: "L", value: func(detail storage.PaymentDetail) string {
+			return detail.ProjectName
+		}})
+	}
+	columns = append(columns,
+		pdfColumn{title: "Qty", width: 18, align: "R", value: func(detail storage.PaymentDetail) string {
+			if !detail.Quantity.IsPositive() {
+				return ""
+			}
+			return detail.Quantity.String()
+		}},
+		pdfColumn{title: "Price", width: 26, align: "R", value: func(detail storage.PaymentDetail) string {
+			if !detail.Quantity.IsPositive() {
+				return ""
+			}
+			price := p.payment.HourlyRate
+			if detail.Price.IsPositive() {
+				price = detail.Price
+			}
+			return price.StringFixed(2)
+		}},
+		pdfColumn{title: "Amount", width: 28, align: "R", value: func(detail storage.PaymentDetail) string {
+			return detail.Cost.StringFixed(2)
+		}},
+	)
+	if showTax {
+		columns = append(columns, pdfColumn{title: "Tax", width: 14, align: "R", value: func(detail storage.PaymentDetail) string {
+			rate := p.payment.TaxRate
+			if detail.TaxRate != nil {
+				rate = *detail.TaxRate
+			}
+			return rate.String() + "%"
+		}})
+	}
+	fixed := 0.0
+	for _, column := range columns {
+		fixed += column.width
+	}
+	for i := range columns {
+		if columns[i].width == 0 {
+			columns[i].width = pdfPageWidth - fixed
+		}
+	}
+	return columns
+}
+
+// tableHeader draws the titles of the line item columns, on the first page of the table and on the pages it continues on
+func (p *invoicePdf) tableHeader(columns []pdfColumn) {
+	p.pdf.SetFont(pdfFont, "B", 9)
+	p.pdf.SetFillColor(235, 235, 235)
+	for _, column := range columns {
+		p.pdf.CellFormat(column.width, pdfLineHeight+1, column.title, "B", 0, column.align, true, 0, "")
+	}
+	p.pdf.Ln(-1)
+	p.pdf.SetFont(pdfFont, "", 9)
+}
+
+func (p *invoicePdf) lineItems() {
+	if len(p.payment.Details) == 0 {
+		return
+	}
+	columns := p.columns()
+	p.pdf.Ln(4)
+	p.tableHeader(columns)
+	for _, detail := range p.payment.Details {
+		// the row is as high as its longest wrapped cell
+		cells := make([][]string, len(columns))
+		lines := 1
+		for i, column := range columns {
+			cells[i] = p.pdf.SplitText(column.value(detail), column.width-2)
+			if len(cells[i]) > lines {
+				lines = len(cells[i])
+			}
+		}
+		height := float64(lines) * 5
+		if p.pdf.GetY()+height > 297-pdfMargin {
+			p.pdf.AddPage()
+			p.tableHeader(columns)
+		}
+		x, y := p.pdf.GetXY()
+		for i, column := range columns {
+			p.pdf.SetXY(x, y)
+			p.pdf.MultiCell(column.width, 5, strings.Join(cells[i], "\n"), "", column.align, false)
+			x += column.width
+		}
+		p.pdf.SetXY(pdfMargin, y+height)
+		p.pdf.Line(pdfMargin, y+height, pdfMargin+pdfPageWidth, y+height)
+	}
+}
+
+func (p *invoicePdf) totals() {
+	p.pdf.Ln(4)
+	labelWidth := pdfPageWidth - 45
+	total := func(style, label string, amount decimal.Decimal) {
+		p.text(style, 10, labelWidth, "R", label)
+		p.text(style, 10, 45, "R", p.amount(amount))
+		p.pdf.Ln(pdfLineHeight)
+	}
+	if len(p.payment.TaxLines) > 0 || p.payment.Discount.IsPositive() {
+		total("", "Subtotal", p.payment.NetAmount())
+		if p.payment.Discount.IsPositive() {
+			total("", "Discount", p.payment.Discount.Neg())
+		}
+		for _, taxLine := range p.payment.TaxLines {
+			total("", fmt.Sprintf("Tax %s%% on %s", taxLine.Rate, p.amount(taxLine.Base)), taxLine.Tax)
+		}
+	}
+	total("B", "Total", p.payment.Amount)
+	if p.payment.PaidAmount.IsPositive() {
+		total("", "Paid", p.payment.PaidAmount)
+		balance := p.payment.Amount.Sub(p.payment.PaidAmount)
+		if balance.IsNegative() {
+			balance = decimal.Zero
+		}
+		total("B", "Balance due", balance)
+	}
+}
+
+// paymentInstructions lists the coins and the addresses the invoice can be paid to
+func (p *invoicePdf) paymentInstructions(transactions []storage.PaymentTransaction) {
+	if len(p.payment.PaymentSettings) > 0 {
+		p.section("Payment instructions")
+		p.line("", 9, "Request the rate of the coin on the payment page, then send the quoted amount to the address of the coin:")
+		for _, setting := range p.payment.PaymentSettings {
+			network := setting.NetworkOrDefault()
+			p.line("", 9, fmt.Sprintf("%s on %s: %s", setting.Type.Info().Name, network.Info().Name, setting.Address))
+		}
+	}
+	p.transactions(transactions)
+}
+
+func (p *invoicePdf) paidStatus(transactions []storage.PaymentTransaction) {
+	p.section("Paid")
+	paidAt := ""
+	if !p.payment.PaidAt.IsZero() {
+		paidAt = " on " + p.payment.PaidAt.Format(pdfDateLayout)
+	}
+	if p.payment.IsCreditNote() {
+		p.line("", 10, fmt.Sprintf("This credit note was settled%s.", paidAt))
+		if !utils.IsEmpty(p.payment.RefundTxId) {
+			p.line("", 9, fmt.Sprintf("Refund to %s: %s", p.payment.RefundAddress, p.payment.RefundTxId))
+		}
+		return
+	}
+	p.line("", 10, fmt.Sprintf("This invoice was paid%s.", paidAt))
+	if len(transactions) == 0 && !utils.IsEmpty(p.payment.TxId) {
+		p.line("", 9, "Transaction: "+p.payment.TxId)
+	}
+	p.transactions(transactions)
+}
+
+// transactions lists the confirmed and confirming transactions paying the invoice
+func (p *invoicePdf) transactions(transactions []storage.PaymentTransaction) {
+	listed := make([]storage.PaymentTransaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if transaction.Status != storage.TransactionStatusFlagged {
+			listed = append(listed, transaction)
+		}
+	}
+	if len(listed) == 0 {
+		return
+	}
+	p.section("Transactions")
+	for _, transaction := range listed {
+		date := transaction.PaidAt
+		if date.IsZero() {
+			date = transaction.CreatedAt
+		}
+		p.line("", 9, fmt.Sprintf("%s  %s (%s %s, %s)", formatPdfDate(date), p.amount(transaction.Amount),
+			transaction.ExpectedAmount.String(), strings.ToUpper(transaction.PaymentMethod.String()), transaction.Status))
+		if !utils.IsEmpty(transaction.TxId) {
+			p.line("", 8, "txid: "+transaction.TxId)
+		}
+	}
+}
+
+func formatPdfDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format(pdfDateLayout)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if !utils.IsEmpty(value) {
+			return value
+		}
+	}
+	return ""
+}
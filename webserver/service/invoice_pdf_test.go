@@ -0,0 +1,49 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/shopspring/decimal"
+)
+
+func TestRenderInvoicePDF(t *testing.T) {
+	details := make(storage.PaymentDetails, 0, 60)
+	for i := 0; i < 60; i++ {
+		details = append(details, storage.PaymentDetail{
+			Quantity:    decimal.NewFromInt(1),
+			Price:       decimal.NewFromInt(10),
+			Cost:        decimal.NewFromInt(10),
+			Description: fmt.Sprintf("Übersetzung %d – Ελληνικά, кириллица, tiếng Việt €", i),
+		})
+	}
+	payment := storage.Payment{
+		Id:                1,
+		SenderName:        "józef",
+		SenderDisplayName: "Józef Łukasiewicz",
+		ReceiverName:      "Дмитрий",
+		Description:       "Çalışma saatleri — Ιανουάριος",
+		Details:           details,
+		Amount:            decimal.NewFromInt(600),
+		Status:            storage.PaymentStatusSent,
+		CreatedAt:         time.Now(),
+	}
+
+	pdf, err := (&Service{}).RenderInvoicePDF(payment, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatal("the output is not a pdf")
+	}
+	// the 60 lines continue on the next pages, the embedded font is a true type font and not a core font
+	if pages := bytes.Count(pdf, []byte("/Type /Page\n")); pages < 2 {
+		t.Errorf("%d pages, expected the line items to continue on a second page", pages)
+	}
+	if !bytes.Contains(pdf, []byte("/FontFile2")) || bytes.Contains(pdf, []byte("/BaseFont /Helvetica")) {
+		t.Error("expected the embedded utf-8 font instead of the core Helvetica font")
+	}
+}
@@ -1,7 +1,6 @@
 package service
 
 import (
-	"database/sql"
 	"fmt"
 	"slices"
 	"strconv"
@@ -11,6 +10,7 @@ import (
 	"github.com/Paytrackpro/paytrack-be/storage"
 	"github.com/Paytrackpro/paytrack-be/utils"
 	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -19,46 +19,62 @@ func getCoinMethodType(coin string) utils.Method {
 	return utils.MethodFromCoin(coin)
 }
 
-func (s *Service) GetBulkPaymentBTC(userId uint64, page, pageSize int, order string) ([]storage.Payment, int64, error) {
-	if page != 0 {
-		page = page - 1
+// bulkPayNetwork checks the coin can be paid on the network, the network defaults to the default network of the coin
+func bulkPayNetwork(method utils.Method, network utils.Network) (utils.Network, error) {
+	if !utils.IsMethodSupported(method) {
+		return network, utils.NewError(fmt.Errorf("coin %s is not supported", method), utils.ErrorBadRequest)
 	}
-	var count int64
-	payments := make([]storage.Payment, 0)
-	//Get count of payments
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM payments WHERE payment_settings @> '[{"type": "%s"}]' AND status <> %d AND status <> %d AND status <> %d AND receiver_id = %d`,
-		utils.PaymentTypeBTC.String(), storage.PaymentStatusPaid, storage.PaymentStatusRejected, storage.PaymentStatusCreated, userId)
-	if err := s.db.Raw(countQuery).Scan(&count).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return payments, 0, nil
-		}
-		return nil, 0, err
+	if utils.IsEmpty(string(network)) {
+		network = utils.DefaultNetworkForMethod(method)
 	}
-
-	if pageSize == 0 {
-		pageSize = int(count)
-		page = 1
+	if !utils.IsCoinNetworkSupported(strings.ToUpper(method.String()), string(network)) {
+		return network, utils.NewError(fmt.Errorf("%s is not supported on network %s", method, network), utils.ErrorBadRequest)
 	}
+	return network, nil
+}
 
-	offset := page * pageSize
-	query := fmt.Sprintf(`SELECT * FROM payments WHERE payment_settings @> '[{"type": "%s"}]' AND status <> %d AND status <> %d AND status <> %d AND receiver_id = %d LIMIT %d OFFSET %d`,
-		utils.PaymentTypeBTC.String(), storage.PaymentStatusPaid, storage.PaymentStatusRejected, storage.PaymentStatusCreated, userId, pageSize, offset)
+// bulkPayableQuery selects the payments received by the user that are ready to pay and accept the coin on the network.
+// The payment settings saved before the networks existed are paid on the default network of the coin
+func (s *Service) bulkPayableQuery(userId uint64, method utils.Method, network utils.Network) *gorm.DB {
+	return s.db.Model(&storage.Payment{}).
+		Where("receiver_id = ? AND status IN ? AND credit_note_of = 0", userId, []storage.PaymentStatus{storage.PaymentStatusSent, storage.PaymentStatusConfirmed}).
+		Where(`CASE WHEN jsonb_typeof(payment_settings) = 'array' THEN EXISTS (SELECT 1 FROM jsonb_array_elements(payment_settings) AS setting
+			WHERE setting->>'type' = ? AND COALESCE(NULLIF(setting->>'network', ''), ?) = ?) ELSE false END`,
+			string(method), string(utils.DefaultNetworkForMethod(method)), string(network))
+}
 
-	if err := s.db.Raw(query).Scan(&payments).Order(order).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return payments, 0, nil
+// GetBulkPayments returns the payments the user can pay in bulk with the coin on the network.
+// Every payment is returned when the page size is not set
+func (s *Service) GetBulkPayments(userId uint64, method utils.Method, network utils.Network, page, pageSize int, order string) ([]storage.Payment, int64, error) {
+	network, err := bulkPayNetwork(method, network)
+	if err != nil {
+		return nil, 0, err
+	}
+	var count int64
+	payments := make([]storage.Payment, 0)
+	if err := s.bulkPayableQuery(userId, method, network).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	query := s.bulkPayableQuery(userId, method, network).Order(order)
+	if pageSize > 0 {
+		if page < 1 {
+			page = 1
 		}
+		query = query.Limit(pageSize).Offset((page - 1) * pageSize)
+	}
+	if err := query.Find(&payments).Error; err != nil {
 		return nil, 0, err
 	}
-
 	return payments, count, nil
 }
 
-func (s *Service) CountBulkPaymentBTC(userId uint64) (int64, error) {
+func (s *Service) CountBulkPayments(userId uint64, method utils.Method, network utils.Network) (int64, error) {
+	network, err := bulkPayNetwork(method, network)
+	if err != nil {
+		return 0, err
+	}
 	var count int64
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM payments WHERE payment_settings @> '[{"type": "%s"}]'  AND status <> %d AND status <> %d AND status <> %d AND receiver_id = %d`, utils.PaymentTypeBTC.String(), storage.PaymentStatusPaid, storage.PaymentStatusRejected, storage.PaymentStatusCreated, userId)
-
-	if err := s.db.Raw(countQuery).Scan(&count).Error; err != nil {
+	if err := s.bulkPayableQuery(userId, method, network).Count(&count).Error; err != nil {
 		return 0, err
 	}
 	return count, nil
@@ -68,8 +84,8 @@ func (s *Service) GetRequestSummary(userId uint64, summaryFilter portal.SummaryF
 	var requestSentCount int64
 	var requestReceivedCount int64
 	var requestPaidCount int64
-	var totalPaid sql.NullFloat64
-	var totalReceived sql.NullFloat64
+	var totalPaid []currencyTotal
+	var totalReceived []currencyTotal
 	var paymentSummary portal.PaymentSummary
 	var idArray = strings.Split(summaryFilter.Ids, ",")
 	var idsInt = make([]int, len(idArray))
@@ -77,27 +93,28 @@ func (s *Service) GetRequestSummary(userId uint64, summaryFilter portal.SummaryF
 		idsInt[i], _ = strconv.Atoi(v)
 	}
 	if len(summaryFilter.Ids) == 0 {
-		buildRequestSentCount := s.db.Model(&storage.Payment{}).Where("sender_id = ? AND status <> ? AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusCreated, summaryFilter.Month)
+		buildRequestSentCount := s.db.Model(&storage.Payment{}).Where("sender_id = ? AND status <> ? AND credit_note_of = 0 AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusCreated, summaryFilter.Month)
 		if err := buildRequestSentCount.Count(&requestSentCount).Error; err != nil {
 			return paymentSummary, err
 		}
 	} else {
-		buildRequestSentCount := s.db.Model(&storage.Payment{}).Where("sender_id = ? AND status <> ? AND EXTRACT(MONTH FROM sent_at) = ? AND receiver_id IN ?", userId, storage.PaymentStatusCreated, summaryFilter.Month, idsInt)
+		buildRequestSentCount := s.db.Model(&storage.Payment{}).Where("sender_id = ? AND status <> ? AND credit_note_of = 0 AND EXTRACT(MONTH FROM sent_at) = ? AND receiver_id IN ?", userId, storage.PaymentStatusCreated, summaryFilter.Month, idsInt)
 		if err := buildRequestSentCount.Count(&requestSentCount).Error; err != nil {
 			return paymentSummary, err
 		}
 	}
-	buildRequestReceivedCount := s.db.Model(&storage.Payment{}).Where("receiver_id = ? AND status <> ? AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusCreated, summaryFilter.Month)
+	buildRequestReceivedCount := s.db.Model(&storage.Payment{}).Where("receiver_id = ? AND status <> ? AND credit_note_of = 0 AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusCreated, summaryFilter.Month)
 	if err := buildRequestReceivedCount.Count(&requestReceivedCount).Error; err != nil {
 		return paymentSummary, err
 	}
 
-	buildRequestPaidCount := s.db.Model(&storage.Payment{}).Where("receiver_id = ? AND status = ? AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusPaid, summaryFilter.Month)
+	buildRequestPaidCount := s.db.Model(&storage.Payment{}).Where("receiver_id = ? AND status = ? AND credit_note_of = 0 AND EXTRACT(MONTH FROM sent_at) = ?", userId, storage.PaymentStatusPaid, summaryFilter.Month)
 	if err := buildRequestPaidCount.Count(&requestPaidCount).Error; err != nil {
 		return paymentSummary, err
 	}
 
-	totalPaidQuery := fmt.Sprintf(`SELECT sum(amount) FROM payments WHERE status = %d AND receiver_id = %d AND EXTRACT(MONTH FROM paid_at) = %d`, storage.PaymentStatusPaid, userId, summaryFilter.Month)
+	// the refunded credit notes have a negative amount, they net against the paid payments
+	totalPaidQuery := fmt.Sprintf(`SELECT currency, sum(amount) AS total, sum(tax_amount) AS tax FROM payments WHERE status = %d AND receiver_id = %d AND EXTRACT(MONTH FROM paid_at) = %d GROUP BY currency`, storage.PaymentStatusPaid, userId, summaryFilter.Month)
 
 	if err := s.db.Raw(totalPaidQuery).Scan(&totalPaid).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -105,9 +122,9 @@ func (s *Service) GetRequestSummary(userId uint64, summaryFilter portal.SummaryF
 		}
 		return paymentSummary, err
 	}
-	var totalRececiverQuery = fmt.Sprintf(`SELECT sum(amount) FROM payments WHERE status = %d AND sender_id = %d AND EXTRACT(MONTH FROM paid_at) = %d`, storage.PaymentStatusPaid, userId, summaryFilter.Month)
+	var totalRececiverQuery = fmt.Sprintf(`SELECT currency, sum(amount) AS total, sum(tax_amount) AS tax FROM payments WHERE status = %d AND sender_id = %d AND EXTRACT(MONTH FROM paid_at) = %d GROUP BY currency`, storage.PaymentStatusPaid, userId, summaryFilter.Month)
 	if len(summaryFilter.Ids) > 0 {
-		totalRececiverQuery = fmt.Sprintf(`SELECT sum(amount) FROM payments WHERE status = %d AND sender_id = %d AND EXTRACT(MONTH FROM paid_at) = %d AND receiver_id IN (%s)`, storage.PaymentStatusPaid, userId, summaryFilter.Month, summaryFilter.Ids)
+		totalRececiverQuery = fmt.Sprintf(`SELECT currency, sum(amount) AS total, sum(tax_amount) AS tax FROM payments WHERE status = %d AND sender_id = %d AND EXTRACT(MONTH FROM paid_at) = %d AND receiver_id IN (%s) GROUP BY currency`, storage.PaymentStatusPaid, userId, summaryFilter.Month, summaryFilter.Ids)
 	}
 	if err := s.db.Raw(totalRececiverQuery).Scan(&totalReceived).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -119,13 +136,53 @@ func (s *Service) GetRequestSummary(userId uint64, summaryFilter portal.SummaryF
 	paymentSummary.RequestSent = uint64(requestSentCount)
 	paymentSummary.RequestReceived = uint64(requestReceivedCount)
 	paymentSummary.RequestPaid = uint64(requestPaidCount)
-	paymentSummary.TotalPaid = totalPaid.Float64
-	paymentSummary.TotalReceived = totalReceived.Float64
+	paymentSummary.Currency = s.ReportingCurrency()
+	var err error
+	paymentSummary.TotalPaid, paymentSummary.TotalPaidTax, paymentSummary.TotalPaidByCurrency, err = s.sumCurrencyTotals(totalPaid)
+	if err != nil {
+		return paymentSummary, err
+	}
+	paymentSummary.TotalReceived, paymentSummary.TotalReceivedTax, paymentSummary.TotalReceivedByCurrency, err = s.sumCurrencyTotals(totalReceived)
+	if err != nil {
+		return paymentSummary, err
+	}
 
 	return paymentSummary, nil
 }
 
+type currencyTotal struct {
+	Currency utils.Currency
+	Total    decimal.Decimal
+	Tax      decimal.Decimal
+}
+
+// sumCurrencyTotals returns the sum of the totals and of their tax converted to the reporting currency
+// and the totals of each currency
+func (s *Service) sumCurrencyTotals(totals []currencyTotal) (decimal.Decimal, decimal.Decimal, map[utils.Currency]decimal.Decimal, error) {
+	sum, tax := decimal.Zero, decimal.Zero
+	byCurrency := make(map[utils.Currency]decimal.Decimal)
+	for _, total := range totals {
+		currency := total.Currency.OrDefault()
+		byCurrency[currency] = byCurrency[currency].Add(total.Total)
+		converted, err := s.ConvertAmount(total.Total, total.Currency, s.ReportingCurrency())
+		if err != nil {
+			return decimal.Zero, decimal.Zero, nil, err
+		}
+		sum = sum.Add(converted)
+		convertedTax, err := s.ConvertAmount(total.Tax, total.Currency, s.ReportingCurrency())
+		if err != nil {
+			return decimal.Zero, decimal.Zero, nil, err
+		}
+		tax = tax.Add(convertedTax)
+	}
+	return sum, tax, byCurrency, nil
+}
+
 func (s *Service) CreatePayment(userId uint64, userName string, displayName string, showDraftForRecipient bool, request portal.PaymentRequest) (*storage.Payment, error) {
+	// the sender only saves the payment as draft or sends it to the receiver
+	if err := storage.CheckPaymentTransition(storage.PaymentStatusCreated, request.Status, storage.PaymentRoleSender, false); err != nil {
+		return nil, err
+	}
 	var reciver storage.User
 	payment := storage.Payment{
 		SenderId:              userId,
@@ -135,6 +192,7 @@ func (s *Service) CreatePayment(userId uint64, userName string, displayName stri
 		Details:               request.Details,
 		Status:                request.Status,
 		HourlyRate:            request.HourlyRate,
+		Currency:              request.Currency.OrDefault(),
 		PaymentSettings:       request.PaymentSettings,
 		ShowDraftRecipient:    showDraftForRecipient,
 		ShowDateOnInvoiceLine: request.ShowDateOnInvoiceLine,
@@ -157,10 +215,12 @@ func (s *Service) CreatePayment(userId uint64, userName string, displayName stri
 		payment.PaymentSettings = storage.PaymentSettings{
 			{
 				Type:    getCoinMethodType(paymentMethod.Coin),
+				Network: utils.NetworkFromCode(paymentMethod.Network),
 				Address: paymentMethod.Address,
 			},
 		}
 		payment.PaymentMethod = getCoinMethodType(paymentMethod.Coin)
+		// the address of an extended key payment method is derived when the payment is sent
 		payment.PaymentAddress = paymentMethod.Address
 	}
 
@@ -194,18 +254,22 @@ func (s *Service) CreatePayment(userId uint64, userName string, displayName stri
 	}
 
 	if len(request.Details) > 0 {
-		amount, err := calculateAmount(request)
+		totals, err := calculateAmount(request)
 		if err != nil {
 			return nil, utils.NewError(err, utils.ErrorBadRequest)
 		}
-		payment.Amount = amount
+		totals.apply(&payment)
 		startDate, err := getStartDate(request)
 		if err != nil {
 			return nil, utils.NewError(err, utils.ErrorBadRequest)
 		}
 		payment.StartDate = startDate
 	} else {
-		payment.Amount = request.Amount
+		totals, err := requestAmountTotals(request)
+		if err != nil {
+			return nil, utils.NewError(err, utils.ErrorBadRequest)
+		}
+		totals.apply(&payment)
 		payment.StartDate = time.Now()
 	}
 
@@ -295,7 +359,7 @@ func (s *Service) CreatePayment(userId uint64, userName string, displayName stri
 					DisplayName: userInfo.DisplayName,
 					Role:        int(userInfo.Role),
 				})
-				if err := tx.Save(&project).Error; err != nil {
+				if err := storage.UpdateVersioned(tx, &project); err != nil {
 					tx.Rollback()
 					return nil, err
 				}
@@ -304,7 +368,26 @@ func (s *Service) CreatePayment(userId uint64, userName string, displayName stri
 		tx.Commit()
 	}
 
-	if err := s.db.Save(&payment).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		derived, err := s.reservePaymentAddress(tx, &payment)
+		if err != nil {
+			return err
+		}
+		if err := assignInvoiceNumber(tx, &payment); err != nil {
+			return err
+		}
+		if err := tx.Save(&payment).Error; err != nil {
+			return invoiceNumberError(err, payment.InvoiceNumber)
+		}
+		if err := recordPaymentEvent(tx, nil, payment, userId, storage.PaymentActionCreated); err != nil {
+			return err
+		}
+		if derived == nil {
+			return nil
+		}
+		return tx.Model(derived).UpdateColumn("payment_id", payment.Id).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &payment, nil
@@ -359,24 +442,51 @@ func (s *Service) UpdatePayment(id, userId uint64, request portal.PaymentRequest
 		}
 		return nil, err
 	}
+	if payment.IsCreditNote() {
+		return nil, utils.NewError(fmt.Errorf("the credit notes are updated with the credit note api"), utils.ErrorBadRequest)
+	}
+	if payment.Status == storage.PaymentStatusDisputed {
+		return nil, utils.NewError(fmt.Errorf("the payment is disputed, the sender revises it in the dispute"), utils.ErrorBadRequest)
+	}
+	if err := storage.CheckVersion(&payment, request.Version); err != nil {
+		return nil, err
+	}
+	originalStatus := payment.Status
+	wasDraft := originalStatus == storage.PaymentStatusCreated
+	before := storage.NewPaymentSnapshot(payment)
 
-	if userId == 0 || request.ReceiverId == userId {
+	if userId == 0 || payment.ReceiverId == userId {
 		// receiver or external update
 		// allow recipient update status to sent or confirmed, or Rejected
-		if payment.Status == storage.PaymentStatusSent || payment.Status == storage.PaymentStatusConfirmed || payment.Status == storage.PaymentStatusRejected {
-			payment.Status = request.Status
-			if request.Status == storage.PaymentStatusSent && payment.Status != request.Status {
+		if payment.Status != request.Status {
+			if err := payment.CheckTransition(request.Status, storage.PaymentRoleReceiver); err != nil {
+				return nil, err
+			}
+			if request.Status == storage.PaymentStatusSent {
 				//update sentAt when status to sent
 				payment.SentAt = time.Now()
 			}
+			payment.Status = request.Status
 		}
 		payment.TxId = request.TxId
 	} else {
 		// sender update
+		if payment.SenderId != userId {
+			return nil, utils.ForbiddenError
+		}
+		if err := payment.CheckSenderEdit(); err != nil {
+			return nil, err
+		}
 		payment.Description = request.Description
 		payment.Details = request.Details
 		payment.HourlyRate = request.HourlyRate
-		payment.PaymentSettings = request.PaymentSettings
+		if request.Currency != "" {
+			payment.Currency = request.Currency
+		}
+		// the settings of a payment method are kept, with the address derived for the payment
+		if payment.UserPaymentMethodId == nil || *payment.UserPaymentMethodId == 0 {
+			payment.PaymentSettings = request.PaymentSettings
+		}
 		payment.ShowDateOnInvoiceLine = request.ShowDateOnInvoiceLine
 		payment.ShowProjectOnInvoice = request.ShowProjectOnInvoice
 		if payment.ShowProjectOnInvoice {
@@ -390,18 +500,22 @@ func (s *Service) UpdatePayment(id, userId uint64, request portal.PaymentRequest
 			payment.ReceiptImg = request.ReceiptImg
 		}
 		if len(request.Details) > 0 {
-			amount, err := calculateAmount(request)
+			totals, err := calculateAmount(request)
 			if err != nil {
 				return nil, utils.NewError(err, utils.ErrorBadRequest)
 			}
-			payment.Amount = amount
+			totals.apply(&payment)
 			startDate, err := getStartDate(request)
 			if err != nil {
 				startDate = payment.CreatedAt
 			}
 			payment.StartDate = startDate
 		} else {
-			payment.Amount = request.Amount
+			totals, err := requestAmountTotals(request)
+			if err != nil {
+				return nil, utils.NewError(err, utils.ErrorBadRequest)
+			}
+			totals.apply(&payment)
 			payment.StartDate = payment.CreatedAt
 		}
 		// use for sender update status from save as draft to sent
@@ -537,20 +651,82 @@ func (s *Service) UpdatePayment(id, userId uint64, request portal.PaymentRequest
 			payment.ShowDraftRecipient = request.ShowDraftRecipient
 			payment.Status = request.Status
 		}
+		// the sender saves the invoice as draft or sends it again
+		if err := storage.CheckPaymentTransition(originalStatus, payment.Status, storage.PaymentRoleSender, false); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.db.Save(&payment).Error; err != nil {
+	action := storage.PaymentActionUpdated
+	if wasDraft && payment.Status != storage.PaymentStatusCreated {
+		action = storage.PaymentActionSent
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var derived *storage.DerivedAddress
+		if wasDraft {
+			var err error
+			if derived, err = s.reservePaymentAddress(tx, &payment); err != nil {
+				return err
+			}
+			if err := assignInvoiceNumber(tx, &payment); err != nil {
+				return err
+			}
+		}
+		if err := storage.UpdateVersioned(tx, &payment); err != nil {
+			return invoiceNumberError(err, payment.InvoiceNumber)
+		}
+		if err := recordPaymentEvent(tx, before, payment, userId, action); err != nil {
+			return err
+		}
+		if derived == nil {
+			return nil
+		}
+		return tx.Model(derived).UpdateColumn("payment_id", payment.Id).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &payment, nil
 }
 
-func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request storage.PaymentFilter) ([]storage.Payment, int64, float64, error) {
+// RejectPayment rejects the payment for the reason of the actor, the actor is 0 for an external receiver
+func (s *Service) RejectPayment(payment *storage.Payment, actorId uint64, role storage.PaymentRole, request portal.PaymentReject) error {
+	if err := storage.CheckVersion(payment, request.Version); err != nil {
+		return err
+	}
+	if err := payment.CheckTransition(storage.PaymentStatusRejected, role); err != nil {
+		return err
+	}
+	before := storage.NewPaymentSnapshot(*payment)
+	payment.Status = storage.PaymentStatusRejected
+	payment.RejectionReason = request.RejectionReason
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := storage.UpdateVersioned(tx, payment); err != nil {
+			return err
+		}
+		return recordPaymentEvent(tx, before, *payment, actorId, storage.PaymentActionRejected)
+	})
+}
+
+// unpaidTotal returns the unpaid amount of the payments of the query, grouped by currency and converted to the reporting currency
+func (s *Service) unpaidTotal(query *gorm.DB) (portal.UnpaidTotal, error) {
+	var totals []currencyTotal
+	unpaid := portal.UnpaidTotal{Currency: s.ReportingCurrency()}
+	if err := query.Select("currency, SUM(amount - paid_amount) AS total").Group("currency").Scan(&totals).Error; err != nil {
+		return unpaid, err
+	}
+	var err error
+	unpaid.Total, _, unpaid.TotalByCurrency, err = s.sumCurrencyTotals(totals)
+	return unpaid, err
+}
+
+func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request storage.PaymentFilter) ([]storage.Payment, int64, portal.UnpaidTotal, error) {
 	if request.Page != 0 {
 		request.Page = request.Page - 1
 	}
 	var count int64
-	var totalAmountUnpaid sql.NullFloat64
+	var totalAmountUnpaid portal.UnpaidTotal
+	var err error
 	// var totalReceived sql.NullFloat64
 	payments := make([]storage.Payment, 0)
 	builder := s.db
@@ -564,9 +740,9 @@ func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request st
 			builder = builder.Where("sender_id = ? AND (? = 0 OR receiver_id IN (?))", userId, len(request.UserIds), request.UserIds)
 			buildCount = buildCount.Where("sender_id = ? AND (? = 0 OR receiver_id IN (?))", userId, len(request.UserIds), request.UserIds)
 		}
-		builderUnpaid := buildUnpaid.Select("SUM(amount)").Where("status <> ?", storage.PaymentStatusPaid)
-		if err := builderUnpaid.Scan(&totalAmountUnpaid).Error; err != nil {
-			return nil, 0, 0, err
+		builderUnpaid := buildUnpaid.Where("sender_id = ? AND (? = 0 OR receiver_id IN (?)) AND status <> ?", userId, len(request.UserIds), request.UserIds, storage.PaymentStatusPaid)
+		if totalAmountUnpaid, err = s.unpaidTotal(builderUnpaid); err != nil {
+			return nil, 0, totalAmountUnpaid, err
 		}
 
 	} else if request.RequestType == storage.PaymentTypeReminder {
@@ -577,9 +753,9 @@ func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request st
 			builder = builder.Where("receiver_id = ? AND (? = 0 OR sender_id IN (?)) AND (status <> ? OR (status = ? AND show_draft_recipient = ?))", userId, len(request.UserIds), request.UserIds, storage.PaymentStatusCreated, storage.PaymentStatusCreated, true)
 			buildCount = buildCount.Where("receiver_id = ? AND (? = 0 OR sender_id IN (?)) AND (status <> ? OR (status = ? AND show_draft_recipient = ?))", userId, len(request.UserIds), request.UserIds, storage.PaymentStatusCreated, storage.PaymentStatusCreated, true)
 		}
-		builderUnpaid := buildUnpaid.Select("SUM(amount) as total").Where("receiver_id = ? AND (? = 0 OR sender_id IN (?)) AND ((status <> ? AND status <> ?) OR (status = ? AND show_draft_recipient = ?))", userId, len(request.UserIds), request.UserIds, storage.PaymentStatusPaid, storage.PaymentStatusCreated, storage.PaymentStatusCreated, true)
-		if err := builderUnpaid.Scan(&totalAmountUnpaid).Error; err != nil {
-			return nil, 0, 0, err
+		builderUnpaid := buildUnpaid.Where("receiver_id = ? AND (? = 0 OR sender_id IN (?)) AND ((status <> ? AND status <> ?) OR (status = ? AND show_draft_recipient = ?))", userId, len(request.UserIds), request.UserIds, storage.PaymentStatusPaid, storage.PaymentStatusCreated, storage.PaymentStatusCreated, true)
+		if totalAmountUnpaid, err = s.unpaidTotal(builderUnpaid); err != nil {
+			return nil, 0, totalAmountUnpaid, err
 		}
 	} else if request.RequestType == storage.PaymentTypeApproval {
 		var projectIds []uint64
@@ -608,9 +784,9 @@ func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request st
 		countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM payments WHERE status = %d AND approvers @> '[{"approverId": %d%s}]' AND (project_id IN (SELECT project_id FROM projects WHERE approvers @> '[{"memberId": %d}]') %s)`, storage.PaymentStatusSent, userId, isApprovedQuery, userId, detailPart)
 		if err := s.db.Raw(countQuery).Scan(&count).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return payments, 0, 0, nil
+				return payments, 0, totalAmountUnpaid, nil
 			}
-			return nil, 0, 0, err
+			return nil, 0, totalAmountUnpaid, err
 		}
 
 		if request.Size == 0 {
@@ -622,20 +798,25 @@ func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request st
 		query := fmt.Sprintf(`SELECT * FROM payments WHERE status = %d AND approvers @> '[{"approverId": %d%s}]' AND (project_id IN (SELECT project_id FROM projects WHERE approvers @> '[{"memberId": %d}]') %s) LIMIT %d OFFSET %d`, storage.PaymentStatusSent, userId, isApprovedQuery, userId, detailPart, request.Size, offset)
 		if err := s.db.Raw(query).Scan(&payments).Order(request.Sort.Order).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return payments, 0, 0, nil
+				return payments, 0, totalAmountUnpaid, nil
 			}
-			return nil, 0, 0, err
+			return nil, 0, totalAmountUnpaid, err
 		}
-		return payments, count, 0, nil
+		return payments, count, totalAmountUnpaid, nil
 	} else {
 		if role != utils.UserRoleAdmin {
 			builder = builder.Where("receiver_id = ? OR sender_id = ?", userId, userId)
 			buildCount = buildCount.Where("receiver_id = ? OR sender_id = ?", userId, userId)
 		}
 	}
+	if len(request.InvoiceNumber) > 0 {
+		invoiceNumber := "%" + utils.EscapeLike(request.InvoiceNumber) + "%"
+		builder = builder.Where("invoice_number ILIKE ?", invoiceNumber)
+		buildCount = buildCount.Where("invoice_number ILIKE ?", invoiceNumber)
+	}
 
 	if err := buildCount.Count(&count).Error; err != nil {
-		return nil, 0, 0, err
+		return nil, 0, totalAmountUnpaid, err
 	}
 
 	if request.Size == 0 {
@@ -645,12 +826,12 @@ func (s *Service) GetListPayments(userId uint64, role utils.UserRole, request st
 	offset := request.Page * request.Size
 	if err := builder.Order(request.Sort.Order).Limit(request.Size).Offset(offset).Find(&payments).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return payments, 0, 0, nil
+			return payments, 0, totalAmountUnpaid, nil
 		}
-		return nil, 0, 0, err
+		return nil, 0, totalAmountUnpaid, err
 	}
 
-	return payments, count, totalAmountUnpaid.Float64, nil
+	return payments, count, totalAmountUnpaid, nil
 }
 
 func (s *Service) CheckHasReport(userId uint64) bool {
@@ -900,7 +1081,7 @@ func (s *Service) GetApprovalsCount(userId uint64, showApproved bool) (int64, er
 
 func (s *Service) GetUnpaidCount(userId uint64) (int64, error) {
 	var count int64
-	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM payments WHERE status <> %d AND status <> %d AND status <> %d AND receiver_id = %d`, storage.PaymentStatusPaid, storage.PaymentStatusRejected, storage.PaymentStatusCreated, userId)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM payments WHERE status <> %d AND status <> %d AND status <> %d AND status <> %d AND receiver_id = %d AND credit_note_of = 0`, storage.PaymentStatusPaid, storage.PaymentStatusRejected, storage.PaymentStatusCreated, storage.PaymentStatusConfirming, userId)
 	if err := s.db.Raw(countQuery).Scan(&count).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return 0, nil
@@ -910,9 +1091,89 @@ func (s *Service) GetUnpaidCount(userId uint64) (int64, error) {
 	return count, nil
 }
 
-func (s *Service) BulkPaidBTC(userId uint64, txId string, bulkPays []portal.BulkPaymentBTC) error {
+// BulkPaid marks the payments paid by one transaction of the coin on the network at the rate of the bulk quote.
+// Every payment must accept the coin on the network
+func (s *Service) BulkPaid(userId uint64, method utils.Method, network utils.Network, txId string, quoteId uint64, bulkPays []portal.BulkPayment) error {
+	network, err := bulkPayNetwork(method, network)
+	if err != nil {
+		return err
+	}
+	quote, err := s.GetBulkRateQuote(quoteId, userId, method, bulkPays)
+	if err != nil {
+		return err
+	}
+	payments, err := s.bulkPayablePayments(userId, method, network, bulkPays)
+	if err != nil {
+		return err
+	}
+	rates, err := s.bulkPaymentRates(payments, quote.Rate)
+	if err != nil {
+		return err
+	}
+
+	// verify the transaction on chain, invoices sharing an address are paid by the same outputs
+	verifications := make(map[string]*TxVerification)
+	if _, ok := s.GetTxVerifier(method, network); ok {
+		if utils.IsEmpty(strings.TrimSpace(txId)) {
+			return utils.NewError(fmt.Errorf("the txid of the %s transaction is required", strings.ToUpper(method.String())), utils.ErrorBadRequest)
+		}
+		expectedByAddress := make(map[string]decimal.Decimal)
+		for _, paym := range payments {
+			rate := rates[paym.Id]
+			if !rate.IsPositive() {
+				return utils.NewError(fmt.Errorf("rate is required to verify payment %d", paym.Id), utils.ErrorBadRequest)
+			}
+			expected := utils.ConvertToCoin(paym.Amount, rate, method)
+			expectedByAddress[paym.PaymentAddress] = expectedByAddress[paym.PaymentAddress].Add(expected)
+		}
+		for address, expected := range expectedByAddress {
+			verification, err := s.VerifyTx(method, network, txId, address, expected)
+			if err != nil {
+				return err
+			}
+			verifications[address] = verification
+		}
+	}
+
+	// every invoice is paid by its own transaction record of the bulk transaction
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := useBulkRateQuote(tx, quote.Id); err != nil {
+			return err
+		}
+		for _, pay := range payments {
+			transaction := &storage.PaymentTransaction{
+				PaymentMethod:  method,
+				PaymentNetwork: network,
+				PaymentAddress: pay.PaymentAddress,
+				TxId:           txId,
+				BulkQuoteId:    quote.Id,
+				Amount:         pay.Amount,
+				ConvertRate:    rates[pay.Id],
+				ConvertTime:    quote.CreatedAt,
+			}
+			if transaction.ConvertRate.IsPositive() {
+				transaction.ExpectedAmount = utils.ConvertToCoin(pay.Amount, transaction.ConvertRate, method)
+			}
+			if err := s.addPaymentTransaction(tx, userId, pay, transaction, verifications[pay.PaymentAddress]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*utils.Error); ok {
+			return err
+		}
+		log.Errorf("save bulk payment failed: %v", err)
+		return &utils.InternalError
+	}
+	return nil
+}
+
+// bulkPayablePayments loads the payments of a bulk payment with the address they are paid to with the coin on the network
+func (s *Service) bulkPayablePayments(userId uint64, method utils.Method, network utils.Network, bulkPays []portal.BulkPayment) ([]*storage.Payment, error) {
 	paymentIds := make([]int, 0)
-	bulkMap := make(map[int]portal.BulkPaymentBTC)
+	bulkMap := make(map[int]portal.BulkPayment)
 
 	for _, pay := range bulkPays {
 		paymentIds = append(paymentIds, pay.ID)
@@ -921,79 +1182,184 @@ func (s *Service) BulkPaidBTC(userId uint64, txId string, bulkPays []portal.Bulk
 
 	payments := make([]*storage.Payment, 0)
 	if err := s.db.Where("id IN ?", paymentIds).Find(&payments).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil
-		}
-		return err
+		return nil, err
+	}
+	if len(payments) != len(bulkMap) {
+		return nil, fmt.Errorf("%s", "some payments were not found")
 	}
 
 	// validate payment
 	for _, paym := range payments {
+		if paym.IsCreditNote() {
+			return nil, fmt.Errorf("credit note %d is refunded by its sender", paym.Id)
+		}
 		if paym.Status != storage.PaymentStatusConfirmed && paym.Status != storage.PaymentStatusSent {
-			return fmt.Errorf("%s", "all payments need to be ready for payment")
+			return nil, fmt.Errorf("%s", "all payments need to be ready for payment")
 		}
 
 		if paym.ReceiverId != userId {
-			return fmt.Errorf("%s", "all payments must be yours")
+			return nil, fmt.Errorf("%s", "all payments must be yours")
 		}
 		if len(paym.PaymentSettings) <= 0 {
-			return fmt.Errorf("%s", "Get payment method list failed")
+			return nil, fmt.Errorf("%s", "Get payment method list failed")
 		}
 
-		hasBTCMethod := false
-		btcAddress := ""
+		address := ""
 		for _, paySetting := range paym.PaymentSettings {
-			if paySetting.Type == utils.PaymentTypeBTC {
-				hasBTCMethod = true
-				btcAddress = paySetting.Address
+			if paySetting.Type == method && paySetting.NetworkOrDefault() == network {
+				address = paySetting.Address
 				break
 			}
 		}
-		if !hasBTCMethod {
-			return fmt.Errorf("%s", "Payment is not set to pay for BTC")
+		if utils.IsEmpty(address) {
+			return nil, utils.NewError(fmt.Errorf("payment %d is not set to pay for %s on %s", paym.Id, strings.ToUpper(method.String()), network), utils.ErrorBadRequest)
 		}
 
-		paym.PaymentMethod = utils.PaymentTypeBTC
-		paym.PaymentAddress = btcAddress
-		paym.TxId = txId
-		paym.PaidAt = time.Now()
-		paym.Status = storage.PaymentStatusPaid
+		paym.PaymentAddress = address
 	}
 
-	//Update data
-	for _, pay := range payments {
-		id := int(pay.Id)
-		pay.ConvertRate = bulkMap[id].Rate
-		pay.ConvertTime = time.Unix(bulkMap[id].ConvertTime, 0)
-		pay.TxId = txId
+	return payments, nil
+}
+
+// bulkPaymentRates converts the USD bulk rate to the currency of each payment
+func (s *Service) bulkPaymentRates(payments []*storage.Payment, usdRate decimal.Decimal) (map[uint64]decimal.Decimal, error) {
+	rates := make(map[uint64]decimal.Decimal)
+	for _, paym := range payments {
+		rate, err := s.RateInCurrency(usdRate, paym.Currency)
+		if err != nil {
+			return nil, err
+		}
+		rates[paym.Id] = rate
 	}
+	return rates, nil
+}
 
-	if err := s.db.Save(&payments).Error; err != nil {
-		fmt.Println("ERROR: ", err)
-		return &utils.InternalError
+// invoiceTotals are the amounts of an invoice computed from its lines
+type invoiceTotals struct {
+	subtotal decimal.Decimal
+	discount decimal.Decimal
+	taxRate  decimal.Decimal
+	tax      decimal.Decimal
+	amount   decimal.Decimal
+	taxLines storage.TaxLines
+}
+
+func (t invoiceTotals) apply(payment *storage.Payment) {
+	payment.Subtotal = t.subtotal
+	payment.Discount = t.discount
+	payment.TaxRate = t.taxRate
+	payment.TaxAmount = t.tax
+	payment.TaxLines = t.taxLines
+	payment.Amount = t.amount
+}
+
+// amountTotals are the totals of an invoice without lines, its amount has no tax
+func amountTotals(amount decimal.Decimal) invoiceTotals {
+	return invoiceTotals{subtotal: amount, amount: amount, taxLines: make(storage.TaxLines, 0)}
+}
+
+// requestAmountTotals are the totals of a request without lines. The tax and the discount are computed
+// from the lines, they are refused on an invoice without lines instead of being dropped
+func requestAmountTotals(request portal.PaymentRequest) (invoiceTotals, error) {
+	if !request.TaxRate.IsZero() || !request.TaxAmount.IsZero() || !request.Discount.IsZero() {
+		return invoiceTotals{}, fmt.Errorf("an invoice without lines can not have a tax or a discount")
 	}
-	return nil
+	return amountTotals(request.Amount), nil
+}
+
+var maxTaxRate = decimal.NewFromInt(100)
+
+func isValidTaxRate(rate decimal.Decimal) bool {
+	return rate.Abs().LessThanOrEqual(maxTaxRate)
 }
 
-func calculateAmount(request portal.PaymentRequest) (float64, error) {
-	var amount float64
+// calculateAmount checks the cost of the lines and computes the totals of the invoice. The lines are taxed at
+// their own rate or at the rate of the invoice, the discount is shared by the rates in proportion of their base
+// and the tax of each rate is rounded to the cent. The subtotal and tax of the request are checked when they
+// are sent, the amount is checked when the invoice has a tax or a discount
+func calculateAmount(request portal.PaymentRequest) (invoiceTotals, error) {
+	totals := invoiceTotals{discount: request.Discount, taxRate: request.TaxRate}
+	if request.Discount.IsNegative() {
+		return totals, fmt.Errorf("discount must not be negative")
+	}
+	if !isValidTaxRate(request.TaxRate) {
+		return totals, fmt.Errorf("tax rate must be between -100 and 100")
+	}
+	taxLines := make(storage.TaxLines, 0)
+	rateIndex := make(map[string]int)
 	for i, detail := range request.Details {
-		if detail.Quantity > 0 {
+		if !detail.Type.IsValid() {
+			return totals, fmt.Errorf("line type %s is invalid at line %d", detail.Type, i+1)
+		}
+		if detail.Quantity.IsPositive() {
 			var price = request.HourlyRate
-			if detail.Price > 0 {
+			if detail.Price.IsPositive() {
 				price = detail.Price
+			} else if !detail.Type.IsLabor() {
+				return totals, fmt.Errorf("payment detail price must be greater than 0 at line %d", i+1)
 			}
-			cost := detail.Quantity * price
-			if cost != detail.Cost {
-				return 0, fmt.Errorf("payment detail amount is incorrect at line %d", i+1)
+			cost := detail.Quantity.Mul(price)
+			if !cost.Equal(detail.Cost) {
+				return totals, fmt.Errorf("payment detail amount is incorrect at line %d", i+1)
 			}
-			if detail.Cost <= 0 {
-				return 0, fmt.Errorf("payment detail cost must be greater than 0 at line %d", i+1)
+			if !detail.Cost.IsPositive() {
+				return totals, fmt.Errorf("payment detail cost must be greater than 0 at line %d", i+1)
 			}
 		}
-		amount += detail.Cost
+		totals.subtotal = totals.subtotal.Add(detail.Cost)
+
+		rate := request.TaxRate
+		if detail.TaxRate != nil {
+			if !isValidTaxRate(*detail.TaxRate) {
+				return totals, fmt.Errorf("tax rate must be between -100 and 100 at line %d", i+1)
+			}
+			rate = *detail.TaxRate
+		} else if rate.IsZero() {
+			// the line is not taxed
+			continue
+		}
+		index, ok := rateIndex[rate.String()]
+		if !ok {
+			index = len(taxLines)
+			rateIndex[rate.String()] = index
+			taxLines = append(taxLines, storage.TaxLine{Rate: rate})
+		}
+		taxLines[index].Base = taxLines[index].Base.Add(detail.Cost)
+	}
+	if totals.discount.GreaterThan(totals.subtotal) {
+		return totals, fmt.Errorf("discount must not be greater than the subtotal")
+	}
+
+	taxedBase, shared := decimal.Zero, decimal.Zero
+	for _, taxLine := range taxLines {
+		taxedBase = taxedBase.Add(taxLine.Base)
+	}
+	for i := range taxLines {
+		if totals.discount.IsPositive() {
+			share := totals.discount.Mul(taxLines[i].Base).Div(totals.subtotal).Round(2)
+			if i == len(taxLines)-1 && taxedBase.Equal(totals.subtotal) {
+				// every line is taxed, the last rate takes the rounding of the shares
+				share = totals.discount.Sub(shared)
+			}
+			shared = shared.Add(share)
+			taxLines[i].Base = taxLines[i].Base.Sub(share)
+		}
+		taxLines[i].Tax = taxLines[i].Base.Mul(taxLines[i].Rate).Div(maxTaxRate).Round(2)
+		totals.tax = totals.tax.Add(taxLines[i].Tax)
+	}
+	totals.taxLines = taxLines
+	totals.amount = totals.subtotal.Sub(totals.discount).Add(totals.tax)
+
+	if !request.Subtotal.IsZero() && !request.Subtotal.Equal(totals.subtotal) {
+		return totals, fmt.Errorf("subtotal is incorrect, expected %s", totals.subtotal)
+	}
+	if !request.TaxAmount.IsZero() && !request.TaxAmount.Equal(totals.tax) {
+		return totals, fmt.Errorf("tax amount is incorrect, expected %s", totals.tax)
+	}
+	if (len(taxLines) > 0 || totals.discount.IsPositive()) && request.Amount.IsPositive() && !request.Amount.Equal(totals.amount) {
+		return totals, fmt.Errorf("amount is incorrect, expected %s", totals.amount)
 	}
-	return amount, nil
+	return totals, nil
 }
 
 func getStartDate(request portal.PaymentRequest) (time.Time, error) {
@@ -1047,19 +1413,19 @@ func (s *Service) SyncPaymentUser(db *gorm.DB, uID int, displayName, userName st
 	updatereceiverBuilder := db.Model(&storage.Payment{}).Where("receiver_id = ? AND status NOT IN (?,?) AND created_at >= date_trunc('month', now()) - interval '3 month'", uID, storage.PaymentStatusPaid, storage.PaymentStatusRejected)
 
 	if !utils.IsEmpty(displayName) {
-		if err := updateSenderBuilder.UpdateColumn("sender_display_name", displayName).Error; err != nil {
+		if err := updateSenderBuilder.UpdateColumns(map[string]interface{}{"sender_display_name": displayName, "version": storage.NextVersion}).Error; err != nil {
 			return err
 		}
-		if err := updatereceiverBuilder.UpdateColumn("receiver_display_name", displayName).Error; err != nil {
+		if err := updatereceiverBuilder.UpdateColumns(map[string]interface{}{"receiver_display_name": displayName, "version": storage.NextVersion}).Error; err != nil {
 			return err
 		}
 	}
 
 	if !utils.IsEmpty(userName) {
-		if err := updateSenderBuilder.UpdateColumn("sender_name", userName).Error; err != nil {
+		if err := updateSenderBuilder.UpdateColumns(map[string]interface{}{"sender_name": userName, "version": storage.NextVersion}).Error; err != nil {
 			return err
 		}
-		if err := updatereceiverBuilder.UpdateColumn("receiver_name", userName).Error; err != nil {
+		if err := updatereceiverBuilder.UpdateColumns(map[string]interface{}{"receiver_name": userName, "version": storage.NextVersion}).Error; err != nil {
 			return err
 		}
 	}
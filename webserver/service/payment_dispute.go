@@ -0,0 +1,330 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"gorm.io/gorm"
+)
+
+// OpenDispute disputes the sent payment for the receiver or an approver, the payment can not be paid
+// until the dispute is resolved
+func (s *Service) OpenDispute(paymentId, userId uint64, userName string, request portal.DisputeRequest) (*storage.PaymentDispute, error) {
+	var payment storage.Payment
+	if err := s.db.Where("id = ?", paymentId).First(&payment).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NotFoundError
+		}
+		return nil, err
+	}
+	if payment.SenderId == userId || !isDisputeParticipant(payment, userId) {
+		return nil, utils.NewError(fmt.Errorf("only the receiver and the approvers can dispute the payment"), utils.ErrorForbidden)
+	}
+	if payment.Status == storage.PaymentStatusDisputed {
+		return nil, utils.NewError(fmt.Errorf("the payment is already disputed"), utils.ErrorInvalidTransition)
+	}
+	if err := storage.CheckVersion(&payment, request.Version); err != nil {
+		return nil, err
+	}
+	role := storage.PaymentRoleApprover
+	if payment.ReceiverId == userId {
+		role = storage.PaymentRoleReceiver
+	}
+	if err := payment.CheckTransition(storage.PaymentStatusDisputed, role); err != nil {
+		return nil, err
+	}
+	for _, line := range request.Lines {
+		if line < 1 || line > len(payment.Details) {
+			return nil, utils.NewError(fmt.Errorf("line %d is not a line of the payment", line), utils.ErrorBadRequest)
+		}
+	}
+	dispute := &storage.PaymentDispute{
+		PaymentId:      payment.Id,
+		OpenedBy:       userId,
+		OpenedByName:   userName,
+		Reason:         request.Reason,
+		Lines:          request.Lines,
+		Status:         storage.DisputeStatusOpen,
+		PreviousStatus: payment.Status,
+	}
+	if dispute.Lines == nil {
+		dispute.Lines = make(storage.DisputeLines, 0)
+	}
+	before := storage.NewPaymentSnapshot(payment)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dispute).Error; err != nil {
+			return err
+		}
+		payment.Status = storage.PaymentStatusDisputed
+		if err := storage.UpdateVersioned(tx, &payment); err != nil {
+			return err
+		}
+		return recordPaymentEvent(tx, before, payment, userId, storage.PaymentActionDisputed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.broadcastDisputeChanged(payment, dispute)
+	return dispute, nil
+}
+
+// GetDisputes returns the disputes of the payment with their messages and the revisions of the payment
+func (s *Service) GetDisputes(paymentId uint64) ([]storage.PaymentDispute, error) {
+	disputes := make([]storage.PaymentDispute, 0)
+	if err := s.db.Where("payment_id = ?", paymentId).Order("created_at").Find(&disputes).Error; err != nil {
+		return nil, err
+	}
+	if len(disputes) == 0 {
+		return disputes, nil
+	}
+	// the messages and the revisions of every dispute are loaded at once
+	ids := make([]uint64, 0, len(disputes))
+	byId := make(map[uint64]*storage.PaymentDispute, len(disputes))
+	for i := range disputes {
+		ids = append(ids, disputes[i].Id)
+		byId[disputes[i].Id] = &disputes[i]
+	}
+	var messages []storage.DisputeMessage
+	if err := s.db.Where("dispute_id IN ?", ids).Order("created_at, id").Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		dispute := byId[message.DisputeId]
+		dispute.Messages = append(dispute.Messages, message)
+	}
+	var revisions []storage.PaymentRevision
+	if err := s.db.Where("dispute_id IN ?", ids).Order("version").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		dispute := byId[revision.DisputeId]
+		dispute.Revisions = append(dispute.Revisions, revision)
+	}
+	return disputes, nil
+}
+
+// AddDisputeMessage adds the message of the sender, the receiver or an approver to the thread of the open dispute
+func (s *Service) AddDisputeMessage(disputeId, userId uint64, userName string, request portal.DisputeMessageRequest) (*storage.DisputeMessage, error) {
+	dispute, payment, err := s.openDispute(disputeId)
+	if err != nil {
+		return nil, err
+	}
+	if !isDisputeParticipant(payment, userId) {
+		return nil, utils.ForbiddenError
+	}
+	message := &storage.DisputeMessage{
+		DisputeId: dispute.Id,
+		UserId:    userId,
+		UserName:  userName,
+		Message:   request.Message,
+	}
+	if err := s.db.Create(message).Error; err != nil {
+		return nil, err
+	}
+	s.broadcastDisputeChanged(payment, dispute)
+	return message, nil
+}
+
+// ReviseDisputedPayment resubmits the disputed payment with the revised lines of the sender. The current version
+// is kept as a revision and the approvals are reset, the payment stays disputed until the receiver accepts it
+func (s *Service) ReviseDisputedPayment(disputeId, userId uint64, userName string, request portal.DisputeRevision) (*storage.Payment, error) {
+	dispute, payment, err := s.openDispute(disputeId)
+	if err != nil {
+		return nil, err
+	}
+	if payment.SenderId != userId {
+		return nil, utils.NewError(fmt.Errorf("only the sender can revise the payment"), utils.ErrorForbidden)
+	}
+	if err := storage.CheckVersion(&payment, request.Version); err != nil {
+		return nil, err
+	}
+	revised := portal.PaymentRequest{
+		HourlyRate: request.HourlyRate,
+		Details:    request.Details,
+		Amount:     request.Amount,
+		TaxRate:    request.TaxRate,
+		Discount:   request.Discount,
+		Subtotal:   request.Subtotal,
+		TaxAmount:  request.TaxAmount,
+	}
+	var totals invoiceTotals
+	if len(request.Details) > 0 {
+		totals, err = calculateAmount(revised)
+	} else if !request.Amount.IsPositive() {
+		err = fmt.Errorf("the revised amount must be greater than 0")
+	} else {
+		totals, err = requestAmountTotals(revised)
+	}
+	if err != nil {
+		return nil, utils.NewError(err, utils.ErrorBadRequest)
+	}
+	before := storage.NewPaymentSnapshot(payment)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var revisions int64
+		if err := tx.Model(&storage.PaymentRevision{}).Where("payment_id = ?", payment.Id).Count(&revisions).Error; err != nil {
+			return err
+		}
+		revision := storage.NewPaymentRevision(payment, dispute.Id, int(revisions)+1)
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		payment.Description = request.Description
+		payment.HourlyRate = request.HourlyRate
+		payment.Details = request.Details
+		totals.apply(&payment)
+		for i, approver := range payment.Approvers {
+			payment.Approvers[i].IsApproved = approver.ApproverId == payment.SenderId || approver.ApproverId == payment.ReceiverId
+		}
+		if err := storage.UpdateVersioned(tx, &payment); err != nil {
+			return err
+		}
+		if err := recordPaymentEvent(tx, before, payment, userId, storage.PaymentActionRevised); err != nil {
+			return err
+		}
+		text := fmt.Sprintf("The payment was revised, version %d is kept", revision.Version)
+		if !utils.IsEmpty(request.Message) {
+			text = fmt.Sprintf("%s: %s", text, request.Message)
+		}
+		return tx.Create(&storage.DisputeMessage{DisputeId: dispute.Id, UserId: userId, UserName: userName, Message: text}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.broadcastDisputeChanged(payment, dispute)
+	return &payment, nil
+}
+
+// ResolveDispute closes the open dispute. The receiver or the user who opened it accepts the payment, which
+// goes back to its status before the dispute or to sent when it was revised. The sender withdraws the payment,
+// which is rejected for the reason of the dispute
+func (s *Service) ResolveDispute(disputeId, userId uint64, userName string, request portal.DisputeResolution) (*storage.PaymentDispute, error) {
+	dispute, payment, err := s.openDispute(disputeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.CheckVersion(&payment, request.Version); err != nil {
+		return nil, err
+	}
+	before := storage.NewPaymentSnapshot(payment)
+	var status storage.PaymentStatus
+	var role storage.PaymentRole
+	var text string
+	switch request.Status {
+	case storage.DisputeStatusAccepted:
+		if userId != payment.ReceiverId && userId != dispute.OpenedBy {
+			return nil, utils.NewError(fmt.Errorf("only the receiver can accept the payment"), utils.ErrorForbidden)
+		}
+		var revisions int64
+		if err := s.db.Model(&storage.PaymentRevision{}).Where("dispute_id = ?", dispute.Id).Count(&revisions).Error; err != nil {
+			return nil, err
+		}
+		status = dispute.PreviousStatus
+		if revisions > 0 {
+			status = storage.PaymentStatusSent
+		}
+		role = storage.PaymentRoleApprover
+		if userId == payment.ReceiverId {
+			role = storage.PaymentRoleReceiver
+		}
+		text = "The payment was accepted"
+	case storage.DisputeStatusWithdrawn:
+		if userId != payment.SenderId {
+			return nil, utils.NewError(fmt.Errorf("only the sender can withdraw the payment"), utils.ErrorForbidden)
+		}
+		status = storage.PaymentStatusRejected
+		role = storage.PaymentRoleSender
+		payment.RejectionReason = dispute.Reason
+		text = "The payment was withdrawn"
+	default:
+		return nil, utils.NewError(fmt.Errorf("a dispute is resolved as accepted or withdrawn"), utils.ErrorBadRequest)
+	}
+	if err := payment.CheckTransition(status, role); err != nil {
+		return nil, err
+	}
+	payment.Status = status
+	if !utils.IsEmpty(request.Message) {
+		text = fmt.Sprintf("%s: %s", text, request.Message)
+	}
+	now := time.Now()
+	dispute.Status = request.Status
+	dispute.Resolution = request.Message
+	dispute.ResolvedBy = userId
+	dispute.ResolvedAt = &now
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(dispute).Error; err != nil {
+			return err
+		}
+		if err := storage.UpdateVersioned(tx, &payment); err != nil {
+			return err
+		}
+		if err := recordPaymentEvent(tx, before, payment, userId, storage.PaymentActionDisputeResolved); err != nil {
+			return err
+		}
+		return tx.Create(&storage.DisputeMessage{DisputeId: dispute.Id, UserId: userId, UserName: userName, Message: text}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.broadcastDisputeChanged(payment, dispute)
+	return dispute, nil
+}
+
+// openDispute returns the open dispute and its payment
+func (s *Service) openDispute(disputeId uint64) (*storage.PaymentDispute, storage.Payment, error) {
+	var dispute storage.PaymentDispute
+	var payment storage.Payment
+	if err := s.db.Where("id = ?", disputeId).First(&dispute).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, payment, utils.NotFoundError
+		}
+		return nil, payment, err
+	}
+	if dispute.Status != storage.DisputeStatusOpen {
+		return nil, payment, utils.NewError(fmt.Errorf("the dispute is %s", dispute.Status), utils.ErrorBadRequest)
+	}
+	if err := s.db.Where("id = ?", dispute.PaymentId).First(&payment).Error; err != nil {
+		return nil, payment, err
+	}
+	return &dispute, payment, nil
+}
+
+// isDisputeParticipant returns true when the user is the sender, the receiver or an approver of the payment
+func isDisputeParticipant(payment storage.Payment, userId uint64) bool {
+	if userId == 0 {
+		return false
+	}
+	if userId == payment.SenderId || userId == payment.ReceiverId {
+		return true
+	}
+	for _, approver := range payment.Approvers {
+		if approver.ApproverId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastDisputeChanged reloads the lists of the sender and the receiver and notifies the participants
+// of the dispute in their rooms
+func (s *Service) broadcastDisputeChanged(payment storage.Payment, dispute *storage.PaymentDispute) {
+	s.broadcastPaymentChanged(&payment)
+	data := map[string]interface{}{
+		"paymentId":     payment.Id,
+		"paymentStatus": payment.Status,
+		"disputeId":     dispute.Id,
+		"status":        dispute.Status,
+	}
+	userIds := []uint64{payment.SenderId, payment.ReceiverId}
+	for _, approver := range payment.Approvers {
+		userIds = append(userIds, approver.ApproverId)
+	}
+	for _, userId := range userIds {
+		if userId == 0 {
+			continue
+		}
+		s.socket.BroadcastToRoom("", fmt.Sprint(userId), "disputeChanged", data)
+	}
+}
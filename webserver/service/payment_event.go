@@ -0,0 +1,25 @@
+package service
+
+import (
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"gorm.io/gorm"
+)
+
+// GetPaymentEvents returns the history of the payment, oldest first
+func (s *Service) GetPaymentEvents(paymentId uint64) ([]storage.PaymentEvent, error) {
+	events := make([]storage.PaymentEvent, 0)
+	if err := s.db.Where("payment_id = ?", paymentId).Order("created_at, id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// recordPaymentEvent appends the action of the actor to the history of the payment in the transaction
+// that saved it. An update that changed nothing is not recorded
+func recordPaymentEvent(tx *gorm.DB, before storage.PaymentSnapshot, payment storage.Payment, actorId uint64, action storage.PaymentAction) error {
+	event := storage.NewPaymentEvent(before, payment, actorId, action)
+	if action == storage.PaymentActionUpdated && len(event.Changes) == 0 {
+		return nil
+	}
+	return tx.Create(&event).Error
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/Paytrackpro/paytrack-be/storage"
 	"github.com/Paytrackpro/paytrack-be/utils"
@@ -36,19 +37,20 @@ func (s *Service) ValidatePaymentAddress(req portal.ValidateAddressRequest) port
 	}
 }
 
-// CreatePaymentMethod creates a new payment method for the user
-func (s *Service) CreatePaymentMethod(userId uint64, req portal.CreatePaymentMethodRequest) (*storage.UserPaymentMethod, error) {
-	// Validate the address first
-	validateReq := portal.ValidateAddressRequest{
-		Coin:    req.Coin,
-		Network: req.Network,
-		Address: req.Address,
+// ValidateExtendedKey validates the watch-only extended public key for a given coin and network
+func (s *Service) ValidateExtendedKey(coin, networkCode, extendedKey string) error {
+	if !utils.IsCoinNetworkSupported(coin, networkCode) {
+		return fmt.Errorf("unsupported coin-network combination: %s on %s", coin, networkCode)
 	}
-	validation := s.ValidatePaymentAddress(validateReq)
-	if !validation.IsValid {
-		return nil, fmt.Errorf("address validation failed: %s", validation.Reason)
+	network := utils.NetworkFromCode(networkCode)
+	if !utils.IsExtendedKeySupported(network) {
+		return fmt.Errorf("extended public keys are not supported on %s network", network.Info().Name)
 	}
+	return utils.VerifyExtendedKey(extendedKey, network)
+}
 
+// CreatePaymentMethod creates a new payment method for the user
+func (s *Service) CreatePaymentMethod(userId uint64, req portal.CreatePaymentMethodRequest) (*storage.UserPaymentMethod, error) {
 	// Create the payment method
 	paymentMethod := &storage.UserPaymentMethod{
 		UserId:  userId,
@@ -58,6 +60,26 @@ func (s *Service) CreatePaymentMethod(userId uint64, req portal.CreatePaymentMet
 		Address: req.Address,
 	}
 
+	if !utils.IsEmpty(req.ExtendedKey) {
+		// the addresses are derived from the extended key for each payment
+		if err := s.ValidateExtendedKey(req.Coin, req.Network, req.ExtendedKey); err != nil {
+			return nil, fmt.Errorf("address validation failed: %v", err)
+		}
+		paymentMethod.Address = ""
+		paymentMethod.ExtendedKey = strings.TrimSpace(req.ExtendedKey)
+	} else {
+		// Validate the address first
+		validateReq := portal.ValidateAddressRequest{
+			Coin:    req.Coin,
+			Network: req.Network,
+			Address: req.Address,
+		}
+		validation := s.ValidatePaymentAddress(validateReq)
+		if !validation.IsValid {
+			return nil, fmt.Errorf("address validation failed: %s", validation.Reason)
+		}
+	}
+
 	if err := s.db.Create(paymentMethod).Error; err != nil {
 		log.Error("CreatePaymentMethod: failed to create payment method", err)
 		return nil, err
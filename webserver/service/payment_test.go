@@ -0,0 +1,141 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/shopspring/decimal"
+)
+
+func TestRequestAmountTotals(t *testing.T) {
+	tests := []struct {
+		name    string
+		request portal.PaymentRequest
+		fails   bool
+	}{
+		{name: "amount only", request: portal.PaymentRequest{Amount: decimal.NewFromInt(100)}},
+		{name: "tax rate", request: portal.PaymentRequest{Amount: decimal.NewFromInt(100), TaxRate: decimal.NewFromInt(20)}, fails: true},
+		{name: "tax amount", request: portal.PaymentRequest{Amount: decimal.NewFromInt(120), TaxAmount: decimal.NewFromInt(20)}, fails: true},
+		{name: "discount", request: portal.PaymentRequest{Amount: decimal.NewFromInt(90), Discount: decimal.NewFromInt(10)}, fails: true},
+	}
+	for _, test := range tests {
+		totals, err := requestAmountTotals(test.request)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, the tax and the discount of an invoice without lines are dropped", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !totals.amount.Equal(test.request.Amount) || !totals.subtotal.Equal(test.request.Amount) || !totals.tax.IsZero() {
+			t.Errorf("%s: totals %+v, expected the amount without tax", test.name, totals)
+		}
+	}
+}
+
+func TestCalculateAmount(t *testing.T) {
+	d := decimal.RequireFromString
+	rate := func(value string) *decimal.Decimal {
+		r := d(value)
+		return &r
+	}
+	tests := []struct {
+		name     string
+		request  portal.PaymentRequest
+		subtotal string
+		tax      string
+		amount   string
+		fails    bool
+	}{
+		{
+			name: "discount before tax",
+			request: portal.PaymentRequest{TaxRate: d("10"), Discount: d("30"), Details: []storage.PaymentDetail{
+				{Quantity: d("2"), Price: d("50"), Cost: d("100")},
+				{Type: storage.LineTypeExpense, Quantity: d("1"), Price: d("50"), Cost: d("50")},
+			}},
+			subtotal: "150", tax: "12", amount: "132",
+		},
+		{
+			name: "tax rounded to the cent",
+			request: portal.PaymentRequest{TaxRate: d("7.5"), Details: []storage.PaymentDetail{
+				{Quantity: d("3"), Price: d("33.33"), Cost: d("99.99")},
+			}},
+			subtotal: "99.99", tax: "7.5", amount: "107.49",
+		},
+		{
+			name: "discount shared by the rates",
+			request: portal.PaymentRequest{Discount: d("10"), Details: []storage.PaymentDetail{
+				{Quantity: d("1"), Price: d("100"), Cost: d("100"), TaxRate: rate("20")},
+				{Quantity: d("1"), Price: d("50"), Cost: d("50"), TaxRate: rate("5")},
+			}},
+			// 6.67 and 3.33 of discount, 18.67 and 2.33 of tax
+			subtotal: "150", tax: "21", amount: "161",
+		},
+		{
+			name: "hourly rate of the labor lines",
+			request: portal.PaymentRequest{HourlyRate: d("40"), TaxRate: d("20"), Amount: d("120"), Details: []storage.PaymentDetail{
+				{Quantity: d("2.5"), Cost: d("100")},
+			}},
+			subtotal: "100", tax: "20", amount: "120",
+		},
+		{
+			name: "withheld tax",
+			request: portal.PaymentRequest{TaxRate: d("-15"), Details: []storage.PaymentDetail{
+				{Quantity: d("1"), Price: d("100"), Cost: d("100")},
+			}},
+			subtotal: "100", tax: "-15", amount: "85",
+		},
+		{
+			name: "incorrect amount",
+			request: portal.PaymentRequest{TaxRate: d("10"), Amount: d("100"), Details: []storage.PaymentDetail{
+				{Quantity: d("1"), Price: d("100"), Cost: d("100")},
+			}},
+			fails: true,
+		},
+		{
+			name: "incorrect line cost",
+			request: portal.PaymentRequest{Details: []storage.PaymentDetail{
+				{Quantity: d("3"), Price: d("10"), Cost: d("31")},
+			}},
+			fails: true,
+		},
+		{
+			name: "discount over the subtotal",
+			request: portal.PaymentRequest{Discount: d("101"), Details: []storage.PaymentDetail{
+				{Quantity: d("1"), Price: d("100"), Cost: d("100")},
+			}},
+			fails: true,
+		},
+		{
+			name:    "discount without lines",
+			request: portal.PaymentRequest{Amount: d("90"), Discount: d("10")},
+			fails:   true,
+		},
+		{
+			name: "tax rate over 100",
+			request: portal.PaymentRequest{TaxRate: d("150"), Details: []storage.PaymentDetail{
+				{Quantity: d("1"), Price: d("100"), Cost: d("100")},
+			}},
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		totals, err := calculateAmount(test.request)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !totals.subtotal.Equal(d(test.subtotal)) || !totals.tax.Equal(d(test.tax)) || !totals.amount.Equal(d(test.amount)) {
+			t.Errorf("%s: subtotal %s, tax %s and amount %s, expected %s, %s and %s", test.name,
+				totals.subtotal, totals.tax, totals.amount, test.subtotal, test.tax, test.amount)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetPaymentTransactions returns the transactions of the payment in the order they were submitted
+func (s *Service) GetPaymentTransactions(paymentId uint64) ([]storage.PaymentTransaction, error) {
+	transactions := make([]storage.PaymentTransaction, 0)
+	err := s.db.Where("payment_id = ?", paymentId).Order("created_at, id").Find(&transactions).Error
+	return transactions, err
+}
+
+// PaymentBalance returns the part of the payment amount that is not paid by a confirmed or confirming transaction
+func (s *Service) PaymentBalance(payment storage.Payment) (decimal.Decimal, error) {
+	return paymentBalance(s.db, payment)
+}
+
+func paymentBalance(db *gorm.DB, payment storage.Payment) (decimal.Decimal, error) {
+	var paid decimal.NullDecimal
+	err := db.Model(&storage.PaymentTransaction{}).Select("SUM(amount)").
+		Where("payment_id = ? AND status <> ?", payment.Id, storage.TransactionStatusFlagged).Scan(&paid).Error
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return payment.Amount.Sub(paid.Decimal), nil
+}
+
+// applyTxVerification saves the on chain verification on the transaction.
+// A transaction that can not be verified (no backend configured for the coin) is trusted as before the verifiers
+func applyTxVerification(transaction *storage.PaymentTransaction, verification *TxVerification) {
+	now := time.Now()
+	if verification == nil {
+		transaction.Status = storage.TransactionStatusConfirmed
+		transaction.PaidAt = now
+		return
+	}
+	transaction.TxVerified = true
+	transaction.Confirmations = verification.Confirmations
+	if verification.Final() {
+		transaction.Status = storage.TransactionStatusConfirmed
+		transaction.PaidAt = now
+		return
+	}
+	transaction.Status = storage.TransactionStatusConfirming
+	transaction.ConfirmingAt = now
+}
+
+// AddPaymentTransaction records a transaction paying a part or the rest of the payment and computes the status
+// of the payment from the sum of its transactions. The changes of the caller on the payment are saved too,
+// the actor is the user who paid or 0 for an external payer
+func (s *Service) AddPaymentTransaction(actorId uint64, payment *storage.Payment, transaction *storage.PaymentTransaction, verification *TxVerification) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.addPaymentTransaction(tx, actorId, payment, transaction, verification)
+	})
+}
+
+func (s *Service) addPaymentTransaction(tx *gorm.DB, actorId uint64, payment *storage.Payment, transaction *storage.PaymentTransaction, verification *TxVerification) error {
+	// lock the payment so two payers can not pay the same balance
+	var locked storage.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", payment.Id).First(&locked).Error; err != nil {
+		return err
+	}
+	// the changes of the caller are saved over the payment it loaded, the payer submits the transaction again
+	// when the payment was changed in between
+	if err := storage.CheckVersion(&locked, payment.Version); err != nil {
+		return err
+	}
+	balance, err := paymentBalance(tx, locked)
+	if err != nil {
+		return err
+	}
+	if !transaction.Amount.IsPositive() || transaction.Amount.GreaterThan(balance) {
+		return utils.NewError(fmt.Errorf("the payment balance changed, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	if transaction.QuoteId > 0 {
+		if err := useRateQuote(tx, transaction.QuoteId); err != nil {
+			return err
+		}
+	}
+	transaction.PaymentId = payment.Id
+	if err := checkTransactionUnused(tx, transaction); err != nil {
+		return err
+	}
+	applyTxVerification(transaction, verification)
+	if err := tx.Model(payment).Omit("UpdatedAt").Updates(payment).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(transaction).Error; err != nil {
+		if e, ok := err.(*pgconn.PgError); ok && e.Code == utils.PgsqlDuplicateErrorCode && e.ConstraintName == storage.PaymentTransactionTxIndex {
+			return transactionUsedError(transaction)
+		}
+		return err
+	}
+	if err := s.refreshPaymentStatus(tx, payment); err != nil {
+		return err
+	}
+	if err := locked.CheckTransition(payment.Status, storage.PaymentRoleSystem); err != nil {
+		return err
+	}
+	return recordPaymentEvent(tx, storage.NewPaymentSnapshot(locked), *payment, actorId, storage.PaymentActionTransactionAdded)
+}
+
+// checkTransactionUnused refuses a transaction to an address that already pays another payment, the payments of
+// the same bulk transaction excepted. The uses of the txid wait for each other until the end of the database transaction
+func checkTransactionUnused(tx *gorm.DB, transaction *storage.PaymentTransaction) error {
+	if utils.IsEmpty(transaction.TxId) {
+		return nil
+	}
+	key := fmt.Sprintf("%s:%s:%s", transaction.PaymentMethod, transaction.PaymentNetwork, transaction.TxId)
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+		return err
+	}
+	var count int64
+	err := tx.Model(&storage.PaymentTransaction{}).
+		Where("payment_method = ? AND payment_network = ? AND tx_id = ? AND payment_address = ? AND status <> ?",
+			transaction.PaymentMethod, transaction.PaymentNetwork, transaction.TxId, transaction.PaymentAddress, storage.TransactionStatusFlagged).
+		Where("bulk_quote_id = 0 OR bulk_quote_id <> ? OR payment_id = ?", transaction.BulkQuoteId, transaction.PaymentId).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return transactionUsedError(transaction)
+	}
+	return nil
+}
+
+func transactionUsedError(transaction *storage.PaymentTransaction) error {
+	return utils.NewError(fmt.Errorf("the transaction %s to %s already pays a payment", transaction.TxId, transaction.PaymentAddress), utils.ErrorObjectExist)
+}
+
+// refreshPaymentStatus computes the status of the payment from its transactions: paid when the confirmed
+// transactions pay the amount, confirming while a transaction waits for confirmations and partially paid otherwise.
+// The transaction fields of the payment show the last transaction
+func (s *Service) refreshPaymentStatus(db *gorm.DB, payment *storage.Payment) error {
+	var transactions []storage.PaymentTransaction
+	if err := db.Where("payment_id = ?", payment.Id).Order("created_at, id").Find(&transactions).Error; err != nil {
+		return err
+	}
+	if len(transactions) == 0 {
+		return nil
+	}
+	paid := decimal.Zero
+	confirming := false
+	var paidAt, confirmingAt time.Time
+	for _, transaction := range transactions {
+		switch transaction.Status {
+		case storage.TransactionStatusConfirmed:
+			paid = paid.Add(transaction.Amount)
+			if transaction.PaidAt.After(paidAt) {
+				paidAt = transaction.PaidAt
+			}
+		case storage.TransactionStatusConfirming:
+			confirming = true
+			if transaction.ConfirmingAt.After(confirmingAt) {
+				confirmingAt = transaction.ConfirmingAt
+			}
+		}
+	}
+	last := transactions[len(transactions)-1]
+	payment.PaidAmount = paid
+	payment.TxId = last.TxId
+	payment.ConvertRate = last.ConvertRate
+	payment.ConvertTime = last.ConvertTime
+	payment.ExpectedAmount = last.ExpectedAmount
+	payment.PaymentMethod = last.PaymentMethod
+	payment.PaymentNetwork = last.PaymentNetwork
+	payment.PaymentAddress = last.PaymentAddress
+	payment.TxVerified = last.TxVerified
+	payment.Confirmations = last.Confirmations
+	payment.TxFlagged = last.Status == storage.TransactionStatusFlagged
+	payment.TxFlagReason = last.FlagReason
+	payment.PaidAt = time.Time{}
+	switch {
+	case paid.GreaterThanOrEqual(payment.Amount):
+		payment.Status = storage.PaymentStatusPaid
+		payment.PaidAt = paidAt
+	case confirming:
+		payment.Status = storage.PaymentStatusConfirming
+		payment.ConfirmingAt = confirmingAt
+	case paid.IsPositive():
+		payment.Status = storage.PaymentStatusPartiallyPaid
+	default:
+		// every transaction was flagged, the payment goes back to the status it was paid from
+		// (sent or confirmed by the receiver) and the payer can submit another one
+		status, err := statusBeforeTransactions(db, payment.Id)
+		if err != nil {
+			return err
+		}
+		payment.Status = status
+	}
+	result := db.Model(payment).UpdateColumns(map[string]interface{}{
+		"paid_amount":     payment.PaidAmount,
+		"tx_id":           payment.TxId,
+		"convert_rate":    payment.ConvertRate,
+		"convert_time":    payment.ConvertTime,
+		"expected_amount": payment.ExpectedAmount,
+		"payment_method":  payment.PaymentMethod,
+		"payment_network": payment.PaymentNetwork,
+		"payment_address": payment.PaymentAddress,
+		"tx_verified":     payment.TxVerified,
+		"confirmations":   payment.Confirmations,
+		"tx_flagged":      payment.TxFlagged,
+		"tx_flag_reason":  payment.TxFlagReason,
+		"status":          payment.Status,
+		"paid_at":         payment.PaidAt,
+		"confirming_at":   payment.ConfirmingAt,
+		"version":         storage.NextVersion,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	payment.Version++
+	return nil
+}
+
+// statusBeforeTransactions returns the status of the payment before its first transaction from the history.
+// The payments paid before the history was recorded go back to sent
+func statusBeforeTransactions(db *gorm.DB, paymentId uint64) (storage.PaymentStatus, error) {
+	var event storage.PaymentEvent
+	err := db.Where("payment_id = ? AND action = ?", paymentId, storage.PaymentActionTransactionAdded).
+		Order("created_at, id").First(&event).Error
+	if err == gorm.ErrRecordNotFound {
+		return storage.PaymentStatusSent, nil
+	}
+	if err != nil {
+		return storage.PaymentStatusSent, err
+	}
+	change, ok := event.Changes["status"]
+	if !ok || len(change.From) == 0 {
+		return storage.PaymentStatusSent, nil
+	}
+	var status storage.PaymentStatus
+	if err := json.Unmarshal(change.From, &status); err != nil {
+		return storage.PaymentStatusSent, err
+	}
+	return status, nil
+}
+
+// syncPaymentTransactions records the transaction of the payments paid before they had transactions
+func (s *Service) syncPaymentTransactions() error {
+	var payments []storage.Payment
+	err := s.db.Where("status IN ? AND NOT EXISTS (SELECT 1 FROM payment_transactions t WHERE t.payment_id = payments.id)",
+		[]storage.PaymentStatus{storage.PaymentStatusPaid, storage.PaymentStatusConfirming}).Find(&payments).Error
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		transaction := storage.PaymentTransaction{
+			PaymentId:      payment.Id,
+			PaymentMethod:  payment.PaymentMethod,
+			PaymentNetwork: payment.PaymentNetwork,
+			PaymentAddress: payment.PaymentAddress,
+			TxId:           payment.TxId,
+			Amount:         payment.Amount,
+			ConvertRate:    payment.ConvertRate,
+			ConvertTime:    payment.ConvertTime,
+			ExpectedAmount: payment.ExpectedAmount,
+			Status:         storage.TransactionStatusConfirmed,
+			TxVerified:     payment.TxVerified,
+			Confirmations:  payment.Confirmations,
+			ConfirmingAt:   payment.ConfirmingAt,
+			PaidAt:         payment.PaidAt,
+		}
+		if payment.Status == storage.PaymentStatusConfirming {
+			transaction.Status = storage.TransactionStatusConfirming
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&transaction).Error; err != nil {
+				return err
+			}
+			if payment.Status != storage.PaymentStatusPaid {
+				return nil
+			}
+			return tx.Model(&payment).UpdateColumns(map[string]interface{}{
+				"paid_amount": payment.Amount,
+				"version":     storage.NextVersion,
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
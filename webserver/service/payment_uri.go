@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+// qrCodeSize is the size in pixels of the QR codes of the payment uris
+const qrCodeSize = 256
+
+type tokenContract struct {
+	contract string
+	decimals int32
+}
+
+// knownEvmTokens are the token contracts used when the token of the coin is not configured on the evm network
+var knownEvmTokens = map[verifierKey]tokenContract{
+	{utils.PaymentTypeUSDT, utils.NetworkERC20}: {contract: "0xdAC17F958D2ee523a2206206994597C13D831ec7", decimals: 6},
+	{utils.PaymentTypeUSDT, utils.NetworkBEP20}: {contract: "0x55d398326f99059fF775485246999027B3197955", decimals: 18},
+}
+
+// knownSolanaMints are the token mints used when the token of the coin is not configured on solana
+var knownSolanaMints = map[utils.Method]string{
+	utils.PaymentTypeUSDT: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB",
+}
+
+// PaymentURI returns the uri a wallet opens to pay the amount of the coin to the address on the network:
+// BIP-21 for bitcoin, litecoin and decred, EIP-681 for the evm networks and Solana Pay for the spl tokens
+func (s *Service) PaymentURI(payment storage.Payment, method utils.Method, network utils.Network, address string, amount decimal.Decimal) (string, error) {
+	label := invoiceLabel(payment)
+	switch network {
+	case utils.NetworkBTC:
+		return utils.BIP21URI("bitcoin", address, amount, label), nil
+	case utils.NetworkLTC:
+		return utils.BIP21URI("litecoin", address, amount, label), nil
+	case utils.NetworkDCR:
+		return utils.BIP21URI("decred", address, amount, label), nil
+	case utils.NetworkERC20, utils.NetworkBEP20:
+		chainId, _ := utils.EvmChainId(network)
+		token, err := s.evmToken(method, network)
+		if err != nil {
+			return "", err
+		}
+		return utils.EIP681URI(chainId, token.contract, address, amount.Shift(token.decimals).Round(0)), nil
+	case utils.NetworkSolana:
+		mint, err := s.solanaMint(method)
+		if err != nil {
+			return "", err
+		}
+		return utils.SolanaPayURI(address, mint, amount, label), nil
+	}
+	return "", fmt.Errorf("payment uris are not supported on network %s", network)
+}
+
+// PaymentQRCode returns the payment uri and its QR code PNG as a data uri
+func (s *Service) PaymentQRCode(payment storage.Payment, method utils.Method, network utils.Network, address string, amount decimal.Decimal) (string, string, error) {
+	uri, err := s.PaymentURI(payment, method, network, address, amount)
+	if err != nil {
+		return "", "", err
+	}
+	qrCode, err := utils.QRCodeBase64(uri, qrCodeSize)
+	if err != nil {
+		return "", "", err
+	}
+	return uri, qrCode, nil
+}
+
+// PaymentSettingAddress returns the requested address when the payment accepts it for the coin,
+// or the address of the payment setting of the coin on the network
+func PaymentSettingAddress(payment storage.Payment, method utils.Method, network utils.Network, requested string) string {
+	address := ""
+	for _, setting := range payment.PaymentSettings {
+		if setting.Type != method {
+			continue
+		}
+		if !utils.IsEmpty(requested) && setting.Address == requested {
+			return requested
+		}
+		if utils.IsEmpty(address) && setting.NetworkOrDefault() == network {
+			address = setting.Address
+		}
+	}
+	return address
+}
+
+// evmToken returns the configured contract of the coin on the evm network, an empty contract is the native coin
+func (s *Service) evmToken(method utils.Method, network utils.Network) (tokenContract, error) {
+	for _, evm := range s.Conf.Chain.Evm {
+		if evm.Network != network {
+			continue
+		}
+		for _, token := range evm.Tokens {
+			if utils.MethodFromCoin(strings.ToUpper(token.Coin)) != method {
+				continue
+			}
+			decimals := token.Decimals
+			if decimals <= 0 {
+				decimals = method.Decimals()
+			}
+			return tokenContract{contract: token.Contract, decimals: decimals}, nil
+		}
+	}
+	if method == utils.PaymentTypeETH && network == utils.NetworkERC20 {
+		return tokenContract{decimals: method.Decimals()}, nil
+	}
+	if token, ok := knownEvmTokens[verifierKey{method, network}]; ok {
+		return token, nil
+	}
+	return tokenContract{}, fmt.Errorf("no %s token is configured on %s", method, network)
+}
+
+func (s *Service) solanaMint(method utils.Method) (string, error) {
+	for _, token := range s.Conf.Chain.Solana.Tokens {
+		if utils.MethodFromCoin(strings.ToUpper(token.Coin)) == method {
+			return token.Mint, nil
+		}
+	}
+	if mint, ok := knownSolanaMints[method]; ok {
+		return mint, nil
+	}
+	return "", fmt.Errorf("no %s token is configured on solana", method)
+}
+
+// invoiceLabel names the invoice and the person who is paid in the wallet of the payer
+func invoiceLabel(payment storage.Payment) string {
+	sender := payment.SenderDisplayName
+	if utils.IsEmpty(sender) {
+		sender = payment.SenderName
+	}
+	if utils.IsEmpty(sender) {
+		return "Invoice " + payment.DisplayNumber()
+	}
+	return fmt.Sprintf("Invoice %s from %s", payment.DisplayNumber(), sender)
+}
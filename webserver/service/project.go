@@ -95,7 +95,7 @@ func (s *Service) GetMyProjects(userId uint64) ([]storage.ProjectResponse, error
 				if !utils.IsEmpty(creator.DisplayName) {
 					project.CreatorName = creator.DisplayName
 				}
-				if err := tx.Save(&project).Error; err != nil {
+				if err := storage.UpdateVersioned(tx, &project); err != nil {
 					tx.Rollback()
 					return make([]storage.ProjectResponse, 0), err
 				}
@@ -126,7 +126,7 @@ func (s *Service) ArchivedProject(creatorId uint64, projectId uint64) error {
 	}
 	project.Status = storage.ProjectCanceled
 	tx := s.db.Begin()
-	if err := tx.Save(&project).Error; err != nil {
+	if err := storage.UpdateVersioned(tx, &project); err != nil {
 		tx.Rollback()
 		log.Error("UpdateProject:save project fail with error: ", err)
 		return err
@@ -144,6 +144,9 @@ func (s *Service) UpdateProject(userId uint64, projectRequest portal.ProjectRequ
 		log.Error("UpdateProject:get project fail with error: ", err)
 		return project, err
 	}
+	if err := storage.CheckVersion(&project, projectRequest.Version); err != nil {
+		return project, err
+	}
 
 	project.ProjectName = projectRequest.ProjectName
 	project.Members = projectRequest.Members
@@ -173,7 +176,7 @@ func (s *Service) UpdateProject(userId uint64, projectRequest portal.ProjectRequ
 	}
 	tx := s.db.Begin()
 
-	if err := tx.Save(&project).Error; err != nil {
+	if err := storage.UpdateVersioned(tx, &project); err != nil {
 		tx.Rollback()
 		log.Error("UpdateProject:save project fail with error: ", err)
 		return project, err
@@ -212,7 +215,9 @@ func (s *Service) UpdateProject(userId uint64, projectRequest portal.ProjectRequ
 	}
 
 	// validate payment
-	for _, paym := range payments {
+	befores := make([]storage.PaymentSnapshot, len(payments))
+	for i, paym := range payments {
+		befores[i] = storage.NewPaymentSnapshot(*paym)
 		if paym.ProjectId == projectRequest.ProjectId {
 			paym.ProjectName = projectRequest.ProjectName
 		}
@@ -228,23 +233,30 @@ func (s *Service) UpdateProject(userId uint64, projectRequest portal.ProjectRequ
 		}
 	}
 
-	if len(payments) > 0 {
-		if err := s.db.Save(&payments).Error; err != nil {
+	for i, paym := range payments {
+		if err := storage.UpdateVersioned(tx, paym); err != nil {
 			tx.Rollback()
 			log.Error("UpdateProject:update payment info fail with error: ", err)
 			return project, err
 		}
+		if err := recordPaymentEvent(tx, befores[i], *paym, userId, storage.PaymentActionUpdated); err != nil {
+			tx.Rollback()
+			log.Error("UpdateProject:record payment event fail with error: ", err)
+			return project, err
+		}
 	}
 
 	tx.Commit()
 	//sync payment data
 	for _, syncId := range mergeIds {
-		s.SyncNewProjectId(syncId, project.ProjectId, project.ProjectName)
+		s.SyncNewProjectId(userId, syncId, project.ProjectId, project.ProjectName)
 	}
 	return project, nil
 }
 
-func (s *Service) SyncNewProjectId(oldProjectId, newProjectId uint64, newProjectName string) error {
+// SyncNewProjectId moves the payments of the merged project to the new project, the changes are recorded in the
+// history of the payments as made by the actor
+func (s *Service) SyncNewProjectId(actorId, oldProjectId, newProjectId uint64, newProjectName string) error {
 	// update all related data
 	payments := make([]*storage.Payment, 0)
 	query := fmt.Sprintf(`SELECT * FROM payments WHERE project_id = %d OR details @> '[{"projectId": %d}]'`, oldProjectId, oldProjectId)
@@ -256,7 +268,9 @@ func (s *Service) SyncNewProjectId(oldProjectId, newProjectId uint64, newProject
 	}
 
 	// validate payment
-	for _, paym := range payments {
+	befores := make([]storage.PaymentSnapshot, len(payments))
+	for i, paym := range payments {
+		befores[i] = storage.NewPaymentSnapshot(*paym)
 		if paym.ProjectId == oldProjectId {
 			paym.ProjectName = newProjectName
 			paym.ProjectId = newProjectId
@@ -274,12 +288,17 @@ func (s *Service) SyncNewProjectId(oldProjectId, newProjectId uint64, newProject
 		}
 	}
 	tx := s.db.Begin()
-	if len(payments) > 0 {
-		if err := s.db.Save(&payments).Error; err != nil {
+	for i, paym := range payments {
+		if err := storage.UpdateVersioned(tx, paym); err != nil {
 			tx.Rollback()
 			log.Error("UpdateProject:update payment info fail with error: ", err)
 			return err
 		}
+		if err := recordPaymentEvent(tx, befores[i], *paym, actorId, storage.PaymentActionUpdated); err != nil {
+			tx.Rollback()
+			log.Error("UpdateProject:record payment event fail with error: ", err)
+			return err
+		}
 	}
 	tx.Commit()
 	return nil
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultRateCacheTTL         = 30 * time.Second
+	defaultRateOutlierThreshold = 5.0
+)
+
+// cachedRates are the rates of a coin fetched from the exchanges at the same time
+type cachedRates struct {
+	// Rates are the rates of the exchanges close to the median
+	Rates map[string]float64
+	// Outliers are the rates discarded because they deviate too much from the median
+	Outliers  map[string]float64
+	Median    float64
+	FetchedAt time.Time
+}
+
+// rateCache keeps the rates of each coin. The lock only guards the map, the rates of a coin are fetched by one
+// request at a time out of the lock so a slow exchange delays the requests of its coin and not the others
+type rateCache struct {
+	mtx      sync.Mutex
+	rates    map[utils.Method]*cachedRates
+	fetching singleflight.Group
+}
+
+func newRateCache() *rateCache {
+	return &rateCache{rates: make(map[utils.Method]*cachedRates)}
+}
+
+// fresh returns the rates of the coin fetched less than the ttl ago
+func (c *rateCache) fresh(currency utils.Method, ttl time.Duration) (*cachedRates, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	cached, ok := c.rates[currency]
+	if !ok || time.Since(cached.FetchedAt) >= ttl {
+		return nil, false
+	}
+	return cached, true
+}
+
+func (c *rateCache) set(currency utils.Method, rates *cachedRates) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.rates[currency] = rates
+}
+
+func (c *rateCache) clear() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.rates = make(map[utils.Method]*cachedRates)
+}
+
+func (s *Service) rateCacheTTL() time.Duration {
+	if s.Conf.RateCacheTTL > 0 {
+		return time.Duration(s.Conf.RateCacheTTL) * time.Second
+	}
+	return defaultRateCacheTTL
+}
+
+func (s *Service) rateOutlierThreshold() float64 {
+	if s.Conf.RateOutlierThreshold > 0 {
+		return s.Conf.RateOutlierThreshold
+	}
+	return defaultRateOutlierThreshold
+}
+
+// aggregatedExchanges returns the allowed exchanges and the default one, they are queried together for the cache
+func (s *Service) aggregatedExchanges() []string {
+	exchanges := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, exchange := range append(strings.Split(s.ExchangeList, ","), s.exchange) {
+		exchange = strings.ToLower(strings.TrimSpace(exchange))
+		if utils.IsEmpty(exchange) || seen[exchange] {
+			continue
+		}
+		seen[exchange] = true
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges
+}
+
+func (s *Service) isAggregatedExchange(exchange string) bool {
+	exchange = strings.ToLower(strings.TrimSpace(exchange))
+	for _, aggregated := range s.aggregatedExchanges() {
+		if aggregated == exchange {
+			return true
+		}
+	}
+	return false
+}
+
+// getCachedRates returns the rates of the coin, they are fetched again from all the exchanges once the TTL is over.
+// The concurrent requests of the coin wait for the same fetch
+func (s *Service) getCachedRates(currency utils.Method) (*cachedRates, error) {
+	if cached, ok := s.rateCache.fresh(currency, s.rateCacheTTL()); ok {
+		return cached, nil
+	}
+	fetched, err, _ := s.rateCache.fetching.Do(currency.String(), func() (interface{}, error) {
+		// the rates may have been fetched by the request that was waited for
+		if cached, ok := s.rateCache.fresh(currency, s.rateCacheTTL()); ok {
+			return cached, nil
+		}
+		fetched, err := s.fetchAggregatedRates(currency)
+		if err != nil {
+			return nil, err
+		}
+		s.rateCache.set(currency, fetched)
+		return fetched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fetched.(*cachedRates), nil
+}
+
+// fetchAggregatedRates queries the exchanges concurrently and discards the rates deviating from the median
+// more than the outlier threshold (percent)
+func (s *Service) fetchAggregatedRates(currency utils.Method) (*cachedRates, error) {
+	exchanges := s.aggregatedExchanges()
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	rates := make(map[string]float64)
+	for _, exchange := range exchanges {
+		wg.Add(1)
+		go func(exchange string) {
+			defer wg.Done()
+			rate, err := s.fetchExchangeRate(exchange, currency)
+			if err != nil || rate <= 0 {
+				log.Debugf("get %s rate from %s failed: %v", currency, exchange, err)
+				return
+			}
+			mtx.Lock()
+			rates[exchange] = rate
+			mtx.Unlock()
+		}(exchange)
+	}
+	wg.Wait()
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("get %s rate failed", currency)
+	}
+
+	result := &cachedRates{
+		Rates:     make(map[string]float64),
+		Outliers:  make(map[string]float64),
+		FetchedAt: time.Now(),
+	}
+	median := medianRate(rates)
+	threshold := s.rateOutlierThreshold()
+	for exchange, rate := range rates {
+		if math.Abs(rate-median)/median*100 > threshold {
+			log.Warnf("%s rate %f of %s deviates from the median %f, discarded", currency, rate, exchange, median)
+			result.Outliers[exchange] = rate
+			continue
+		}
+		result.Rates[exchange] = rate
+	}
+	if len(result.Rates) == 0 {
+		return nil, fmt.Errorf("the %s rates of the exchanges do not agree", currency)
+	}
+	result.Median = medianRate(result.Rates)
+	return result, nil
+}
+
+func medianRate(rates map[string]float64) float64 {
+	values := make([]float64, 0, len(rates))
+	for _, rate := range rates {
+		values = append(values, rate)
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
+
+// GetReferenceRate returns the median rate of the coin over the exchanges
+func (s *Service) GetReferenceRate(currency utils.Method) (float64, error) {
+	cached, err := s.getCachedRates(currency)
+	if err != nil {
+		return 0, err
+	}
+	return cached.Median, nil
+}
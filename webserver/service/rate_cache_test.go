@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+// blockingRateProvider waits for the release of the coin before returning its rate
+type blockingRateProvider struct {
+	*fakeRateProvider
+	blocked utils.Method
+	release chan struct{}
+}
+
+func (p *blockingRateProvider) GetRate(currency utils.Method) (float64, error) {
+	if currency == p.blocked {
+		<-p.release
+	}
+	return p.fakeRateProvider.GetRate(currency)
+}
+
+func TestMedianRate(t *testing.T) {
+	tests := []struct {
+		rates  map[string]float64
+		median float64
+	}{
+		{rates: map[string]float64{}, median: 0},
+		{rates: map[string]float64{"a": 10}, median: 10},
+		{rates: map[string]float64{"a": 30, "b": 10, "c": 20}, median: 20},
+		{rates: map[string]float64{"a": 40, "b": 10, "c": 20, "d": 30}, median: 25},
+	}
+	for _, test := range tests {
+		if median := medianRate(test.rates); median != test.median {
+			t.Errorf("median of %v is %f, expected %f", test.rates, median, test.median)
+		}
+	}
+}
+
+func TestAggregatedRatesRejectOutliers(t *testing.T) {
+	s := newRateTestService(Config{ExchangeList: "a,b,c,d,broken", RateOutlierThreshold: 5}, map[string]RateProvider{
+		"a":      newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 100}),
+		"b":      newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 102}),
+		"c":      newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 98}),
+		"d":      newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 150}),
+		"broken": newFakeRateProvider(nil),
+	})
+
+	cached, err := s.getCachedRates(utils.PaymentTypeBTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached.Rates) != 3 {
+		t.Errorf("rates %v, expected the 3 rates close to the median", cached.Rates)
+	}
+	if _, ok := cached.Outliers["d"]; !ok || len(cached.Outliers) != 1 {
+		t.Errorf("outliers %v, expected the rate of d", cached.Outliers)
+	}
+	if cached.Median != 100 {
+		t.Errorf("median %f, expected 100 without the outlier", cached.Median)
+	}
+	if _, err := s.GetExchangeRate("d", utils.PaymentTypeBTC); err == nil {
+		t.Error("expected an error for the rate of the outlier")
+	}
+	if rate, err := s.GetExchangeRate("b", utils.PaymentTypeBTC); err != nil || rate != 102 {
+		t.Errorf("rate %f (%v), expected 102", rate, err)
+	}
+	if _, err := s.GetReferenceRate(utils.PaymentTypeLTC); err == nil {
+		t.Error("expected an error when no exchange has a rate")
+	}
+}
+
+func TestAggregatedRatesDisagree(t *testing.T) {
+	s := newRateTestService(Config{ExchangeList: "a,b", RateOutlierThreshold: 5}, map[string]RateProvider{
+		"a": newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 100}),
+		"b": newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 200}),
+	})
+	if _, err := s.GetReferenceRate(utils.PaymentTypeBTC); err == nil {
+		t.Error("expected an error when every rate deviates from the median")
+	}
+}
+
+func TestUnlistedExchangeRateBoundedByMedian(t *testing.T) {
+	s := newRateTestService(Config{ExchangeList: "a,b", RateOutlierThreshold: 5}, map[string]RateProvider{
+		"a":     newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 100}),
+		"b":     newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 100}),
+		"close": newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 103}),
+		"far":   newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 120}),
+	})
+	if rate, err := s.GetExchangeRate("close", utils.PaymentTypeBTC); err != nil || rate != 103 {
+		t.Errorf("rate %f (%v), expected 103", rate, err)
+	}
+	if _, err := s.GetExchangeRate("far", utils.PaymentTypeBTC); err == nil {
+		t.Error("expected an error for the rate of an unlisted exchange deviating from the median")
+	}
+	if _, err := s.GetExchangeRate("unknown", utils.PaymentTypeBTC); err == nil {
+		t.Error("expected an error for an unsupported exchange")
+	}
+}
+
+func TestRateCacheFetchesOncePerTTL(t *testing.T) {
+	feed := newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeDCR: 15})
+	s := newRateTestService(Config{ExchangeList: "feed", RateCacheTTL: 60}, map[string]RateProvider{"feed": feed})
+	for i := 0; i < 3; i++ {
+		if _, err := s.GetReferenceRate(utils.PaymentTypeDCR); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if feed.requests() != 1 {
+		t.Errorf("the provider was requested %d times, expected once in the ttl", feed.requests())
+	}
+}
+
+func TestSlowExchangeOnlyDelaysItsCoin(t *testing.T) {
+	slow := &blockingRateProvider{
+		fakeRateProvider: newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 100, utils.PaymentTypeLTC: 80}),
+		blocked:          utils.PaymentTypeBTC,
+		release:          make(chan struct{}),
+	}
+	s := newRateTestService(Config{ExchangeList: "slow"}, map[string]RateProvider{"slow": slow})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rate, err := s.GetReferenceRate(utils.PaymentTypeBTC); err != nil || rate != 100 {
+				errs <- fmt.Errorf("rate %f (%v), expected 100", rate, err)
+			}
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.GetReferenceRate(utils.PaymentTypeLTC)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the LTC rate waits for the BTC rate of the slow exchange")
+	}
+
+	close(slow.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	// one request for LTC, the concurrent BTC requests share one fetch
+	if slow.requests() != 2 {
+		t.Errorf("the provider was requested %d times, expected 2", slow.requests())
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+const (
+	binancePriceURL  = "https://api.binance.com/api/v3/ticker/price"
+	kucoinPriceURL   = "https://api.kucoin.com/api/v1/market/stats"
+	coinMaketCapURL  = "https://pro-api.coinmarketcap.com/v2/tools/price-conversion"
+	bittrexURL       = "https://api.bittrex.com/v3/markets/"
+	mexcPriceURL     = "https://api.mexc.com/api/v3/ticker/price"
+	krakenPriceURL   = "https://api.kraken.com/0/public/Ticker"
+	coinbasePriceURL = "https://api.coinbase.com/v2/prices/"
+)
+
+type ticker struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price,string"`
+}
+
+type BittrexPrice struct {
+	Price   float64 `json:"lastTradeRate,string"`
+	BidRate float64 `json:"bidRate,string"`
+	AskRate float64 `json:"askRate,string"`
+}
+
+type CoinMarketCapData struct {
+	Status struct {
+		ErrorCode int    `json:"error_code"`
+		ErrorMess string `json:"error_message"`
+	} `json:"status"`
+	Data []CoinMarketCapConvert `json:"data"`
+}
+
+type CoinMarketCapConvert struct {
+	Amount int `json:"amount"`
+	Quote  struct {
+		USD struct {
+			Price float64 `json:"price"`
+		} `json:"USD"`
+	} `json:"quote"`
+}
+
+type KucoinPriceResponse struct {
+	Code string             `json:"code"`
+	Data KucoinResponseData `json:"data"`
+}
+
+type KucoinResponseData struct {
+	Symbol           string `json:"symbol"`
+	Time             int64  `json:"time"`
+	Buy              string `json:"buy"`
+	Sell             string `json:"sell"`
+	ChangeRate       string `json:"changeRate"`
+	ChangePrice      string `json:"changePrice"`
+	High             string `json:"high"`
+	Low              string `json:"low"`
+	Vol              string `json:"vol"`
+	VolValue         string `json:"volValue"`
+	Last             string `json:"last"`
+	AveragePrice     string `json:"averagePrice"`
+	TakerFeeRate     string `json:"takerFeeRate"`
+	MakerFeeRate     string `json:"makerFeeRate"`
+	TakerCoefficient string `json:"takerCoefficient"`
+	MakerCoefficient string `json:"makerCoefficient"`
+}
+
+type KrakenTickerResponse struct {
+	Error  []string `json:"error"`
+	Result map[string]struct {
+		// Last is the price and the lot volume of the last trade
+		Last []string `json:"c"`
+	} `json:"result"`
+}
+
+type CoinbasePriceResponse struct {
+	Data struct {
+		Amount   string `json:"amount"`
+		Base     string `json:"base"`
+		Currency string `json:"currency"`
+	} `json:"data"`
+}
+
+// kucoinProvider get the price of the cryptocurrency based on kucoin api
+type kucoinProvider struct {
+	conf RateProviderConfig
+}
+
+func newKucoinProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &kucoinProvider{conf: conf}, nil
+}
+
+func (p *kucoinProvider) GetRate(currency utils.Method) (float64, error) {
+	query := map[string]string{
+		"symbol": p.conf.symbol(currency, "%s-USDT"),
+	}
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: p.conf.url(kucoinPriceURL),
+		Payload: query,
+		Timeout: p.conf.timeout(),
+	}
+	var kuCoinRes KucoinPriceResponse
+	if err := HttpRequest(req, &kuCoinRes); err != nil {
+		return 0, err
+	}
+
+	if kuCoinRes.Code != "200000" {
+		return 0, fmt.Errorf("Get Kucoin %s price failed", currency)
+	}
+	lastPrice, parseErr := strconv.ParseFloat(kuCoinRes.Data.Last, 64)
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	return lastPrice, nil
+}
+
+// tickerProvider get the price of the cryptocurrency based on the binance ticker api, mexc uses the same api
+type tickerProvider struct {
+	conf       RateProviderConfig
+	defaultUrl string
+}
+
+func newBinanceProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &tickerProvider{conf: conf, defaultUrl: binancePriceURL}, nil
+}
+
+func newMexcProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &tickerProvider{conf: conf, defaultUrl: mexcPriceURL}, nil
+}
+
+func (p *tickerProvider) GetRate(currency utils.Method) (float64, error) {
+	query := map[string]string{
+		"symbol": p.conf.symbol(currency, "%sUSDT"),
+	}
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: p.conf.url(p.defaultUrl),
+		Payload: query,
+		Timeout: p.conf.timeout(),
+	}
+	var t ticker
+	if err := HttpRequest(req, &t); err != nil {
+		return 0, err
+	}
+
+	return t.Price, nil
+}
+
+type coinMarketCapProvider struct {
+	conf RateProviderConfig
+}
+
+func newCoinMarketCapProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &coinMarketCapProvider{conf: conf}, nil
+}
+
+func (p *coinMarketCapProvider) GetRate(currency utils.Method) (float64, error) {
+	query := map[string]string{
+		"symbol":  p.conf.symbol(currency, "%s"),
+		"convert": "USD",
+		"amount":  "1",
+	}
+
+	header := map[string]string{
+		"X-CMC_PRO_API_KEY": p.conf.ApiKey,
+	}
+
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: p.conf.url(coinMaketCapURL),
+		Payload: query,
+		Header:  header,
+		Timeout: p.conf.timeout(),
+	}
+
+	var res CoinMarketCapData
+	if err := HttpRequest(req, &res); err != nil {
+		return 0, err
+	}
+	if len(res.Data) == 0 {
+		return 0, fmt.Errorf("Get CoinMarketCap %s price failed: %s", currency, res.Status.ErrorMess)
+	}
+
+	return res.Data[0].Quote.USD.Price, nil
+}
+
+type bittrexProvider struct {
+	conf RateProviderConfig
+}
+
+func newBittrexProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &bittrexProvider{conf: conf}, nil
+}
+
+func (p *bittrexProvider) GetRate(currency utils.Method) (float64, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s%s%s", p.conf.url(bittrexURL), p.conf.symbol(currency, "%s-USDT"), "/ticker"),
+		Timeout: p.conf.timeout(),
+	}
+
+	var res BittrexPrice
+	if err := HttpRequest(req, &res); err != nil {
+		return 0, err
+	}
+
+	return res.Price, nil
+}
+
+type krakenProvider struct {
+	conf RateProviderConfig
+}
+
+func newKrakenProvider(conf RateProviderConfig) (RateProvider, error) {
+	// kraken lists bitcoin as XBT
+	if _, ok := conf.Symbols[utils.PaymentTypeBTC.String()]; !ok {
+		symbols := map[string]string{utils.PaymentTypeBTC.String(): "XBTUSDT"}
+		for coin, symbol := range conf.Symbols {
+			symbols[coin] = symbol
+		}
+		conf.Symbols = symbols
+	}
+	return &krakenProvider{conf: conf}, nil
+}
+
+func (p *krakenProvider) GetRate(currency utils.Method) (float64, error) {
+	query := map[string]string{
+		"pair": p.conf.symbol(currency, "%sUSDT"),
+	}
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: p.conf.url(krakenPriceURL),
+		Payload: query,
+		Timeout: p.conf.timeout(),
+	}
+	var res KrakenTickerResponse
+	if err := HttpRequest(req, &res); err != nil {
+		return 0, err
+	}
+	if len(res.Error) > 0 {
+		return 0, fmt.Errorf("Get Kraken %s price failed: %s", currency, strings.Join(res.Error, ", "))
+	}
+	// the result is keyed by the kraken pair name which may differ from the requested one
+	for _, pair := range res.Result {
+		if len(pair.Last) == 0 {
+			break
+		}
+		return strconv.ParseFloat(pair.Last[0], 64)
+	}
+	return 0, fmt.Errorf("Get Kraken %s price failed", currency)
+}
+
+type coinbaseProvider struct {
+	conf RateProviderConfig
+}
+
+func newCoinbaseProvider(conf RateProviderConfig) (RateProvider, error) {
+	return &coinbaseProvider{conf: conf}, nil
+}
+
+func (p *coinbaseProvider) GetRate(currency utils.Method) (float64, error) {
+	req := &ReqConfig{
+		Method:  http.MethodGet,
+		HttpUrl: fmt.Sprintf("%s%s/spot", p.conf.url(coinbasePriceURL), p.conf.symbol(currency, "%s-USD")),
+		Timeout: p.conf.timeout(),
+	}
+	var res CoinbasePriceResponse
+	if err := HttpRequest(req, &res); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(res.Data.Amount, 64)
+}
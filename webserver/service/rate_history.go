@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxRateSamples is the maximum number of samples returned for a range
+	maxRateSamples           = 2000
+	defaultRateSampleRawDays = 7
+	rateSampleCompactPeriod  = time.Hour
+)
+
+func (s *Service) rateSampleRawAge() time.Duration {
+	if s.Conf.RateSampleRawDays > 0 {
+		return time.Duration(s.Conf.RateSampleRawDays) * 24 * time.Hour
+	}
+	return defaultRateSampleRawDays * 24 * time.Hour
+}
+
+// RunRateSampleRetention averages the rate samples older than the raw retention per hour
+// and deletes the hourly samples older than the retention
+func (s *Service) RunRateSampleRetention() {
+	go func() {
+		for range time.Tick(rateSampleCompactPeriod) {
+			if err := s.compactRateSamples(time.Now()); err != nil {
+				log.Errorf("compact rate samples failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *Service) compactRateSamples(now time.Time) error {
+	cutoff := now.Add(-s.rateSampleRawAge()).UTC().Truncate(time.Hour)
+	// the samples of the hour are replaced by their average in one statement, the average is stamped at the start of the hour
+	err := s.db.Exec(`WITH old AS (
+		DELETE FROM rate_samples WHERE sampled_at < ? AND NOT downsampled
+		RETURNING coin, exchange, rate, sampled_at
+	)
+	INSERT INTO rate_samples (coin, exchange, rate, sampled_at, downsampled)
+	SELECT coin, exchange, AVG(rate), date_trunc('hour', sampled_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', true FROM old
+	GROUP BY coin, exchange, date_trunc('hour', sampled_at AT TIME ZONE 'UTC')`, cutoff).Error
+	if err != nil {
+		return err
+	}
+	if s.Conf.RateSampleRetentionDays <= 0 {
+		return nil
+	}
+	expired := now.AddDate(0, 0, -s.Conf.RateSampleRetentionDays)
+	return s.db.Where("sampled_at < ?", expired).Delete(&storage.RateSample{}).Error
+}
+
+// saveRateSamples persists the cached rates of the exchanges and their median
+func (s *Service) saveRateSamples(currency utils.Method, cached *cachedRates) error {
+	samples := make([]storage.RateSample, 0, len(cached.Rates)+1)
+	for exchange, rate := range cached.Rates {
+		samples = append(samples, storage.RateSample{
+			Coin:      currency,
+			Exchange:  exchange,
+			Rate:      rate,
+			SampledAt: cached.FetchedAt,
+		})
+	}
+	samples = append(samples, storage.RateSample{
+		Coin:      currency,
+		Exchange:  storage.RateSampleReference,
+		Rate:      cached.Median,
+		SampledAt: cached.FetchedAt,
+	})
+	return s.db.Create(&samples).Error
+}
+
+func rateSampleExchange(exchange string) string {
+	exchange = strings.ToLower(strings.TrimSpace(exchange))
+	if utils.IsEmpty(exchange) {
+		return storage.RateSampleReference
+	}
+	return exchange
+}
+
+// GetHistoricalRate returns the rate of the coin at the time from the nearest sample,
+// or the linear interpolation of the samples around the time
+func (s *Service) GetHistoricalRate(coin utils.Method, exchange string, at time.Time, interpolate bool) (*portal.HistoricalRate, error) {
+	exchange = rateSampleExchange(exchange)
+	query := s.db.Where("coin = ? AND exchange = ?", coin, exchange)
+	var before, after storage.RateSample
+	beforeErr := query.Session(&gorm.Session{}).Where("sampled_at <= ?", at).Order("sampled_at DESC").First(&before).Error
+	if beforeErr != nil && beforeErr != gorm.ErrRecordNotFound {
+		return nil, beforeErr
+	}
+	afterErr := query.Session(&gorm.Session{}).Where("sampled_at >= ?", at).Order("sampled_at").First(&after).Error
+	if afterErr != nil && afterErr != gorm.ErrRecordNotFound {
+		return nil, afterErr
+	}
+	if beforeErr != nil && afterErr != nil {
+		return nil, utils.NewError(fmt.Errorf("no %s rate sample of %s", coin, exchange), utils.ErrorNotFound)
+	}
+
+	result := &portal.HistoricalRate{
+		Coin:     coin,
+		Exchange: exchange,
+		At:       at,
+	}
+	if interpolate && beforeErr == nil && afterErr == nil && after.SampledAt.After(before.SampledAt) {
+		ratio := float64(at.Sub(before.SampledAt)) / float64(after.SampledAt.Sub(before.SampledAt))
+		result.Rate = before.Rate + (after.Rate-before.Rate)*ratio
+		result.Interpolated = true
+		return result, nil
+	}
+
+	nearest := before
+	if beforeErr != nil || (afterErr == nil && after.SampledAt.Sub(at) < at.Sub(before.SampledAt)) {
+		nearest = after
+	}
+	result.Rate = nearest.Rate
+	result.SampledAt = &nearest.SampledAt
+	return result, nil
+}
+
+// GetRateSamples returns the samples of the coin between from and to, the samples are averaged by interval when it is set.
+// Only the first maxRateSamples samples are returned and the result is flagged as truncated when the range has more
+func (s *Service) GetRateSamples(coin utils.Method, exchange string, from, to time.Time, interval time.Duration) (*portal.RateSamples, error) {
+	query := s.db.Model(&storage.RateSample{}).
+		Where("coin = ? AND exchange = ? AND sampled_at BETWEEN ? AND ?", coin, rateSampleExchange(exchange), from, to)
+	result := &portal.RateSamples{}
+	if interval > 0 {
+		// the interval is a parsed duration, its seconds are safe to inline in the grouped expression
+		bucket := fmt.Sprintf("to_timestamp(floor(extract(epoch from sampled_at) / %[1]d) * %[1]d)", int64(interval.Seconds()))
+		query = query.Select("coin, exchange, AVG(rate) AS rate, " + bucket + " AS sampled_at, bool_or(downsampled) AS downsampled").
+			Group("coin, exchange, " + bucket)
+		result.Interval = interval.String()
+	}
+	var samples []storage.RateSample
+	if err := query.Order("sampled_at").Limit(maxRateSamples + 1).Find(&samples).Error; err != nil {
+		return nil, err
+	}
+	if len(samples) > maxRateSamples {
+		samples = samples[:maxRateSamples]
+		result.Truncated = true
+	}
+	result.Samples = samples
+	return result, nil
+}
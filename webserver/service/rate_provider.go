@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+const (
+	Bittrex       = "bittrex"
+	Binance       = "binance"
+	Kucoin        = "kucoin"
+	Mexc          = "mexc"
+	Coinmarketcap = "coinmarketcap"
+	Kraken        = "kraken"
+	Coinbase      = "coinbase"
+	Static        = "static"
+)
+
+// RateProvider returns the USDT rate of a coin from an exchange or another price source
+type RateProvider interface {
+	GetRate(currency utils.Method) (float64, error)
+}
+
+// RateProviderFactory creates the provider of a type from its config
+type RateProviderFactory func(conf RateProviderConfig) (RateProvider, error)
+
+type RateProviderConfig struct {
+	// Name is the exchange name the clients request the rate with
+	Name string `yaml:"name"`
+	// Type is the registered provider type, the name is used when it is empty
+	Type    string `yaml:"type"`
+	BaseUrl string `yaml:"baseUrl"`
+	ApiKey  string `yaml:"apiKey"`
+	// Timeout is the number of seconds to wait for the response of the provider
+	Timeout int `yaml:"timeout"`
+	// Symbols maps a coin to the symbol the provider lists it with, e.g. btc: XBTUSDT
+	Symbols map[string]string `yaml:"symbols"`
+	// Rates are the manual rates of the static provider
+	Rates map[string]float64 `yaml:"rates"`
+}
+
+func (c RateProviderConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return defaultHttpClientTimeout
+}
+
+// symbol returns the mapped symbol of the coin or formats the default one
+func (c RateProviderConfig) symbol(currency utils.Method, format string) string {
+	if symbol, ok := c.Symbols[currency.String()]; ok {
+		return symbol
+	}
+	return fmt.Sprintf(format, strings.ToUpper(currency.String()))
+}
+
+func (c RateProviderConfig) url(defaultUrl string) string {
+	if utils.IsEmpty(c.BaseUrl) {
+		return defaultUrl
+	}
+	return c.BaseUrl
+}
+
+var rateProviderFactories = map[string]RateProviderFactory{
+	Binance:       newBinanceProvider,
+	Kucoin:        newKucoinProvider,
+	Mexc:          newMexcProvider,
+	Bittrex:       newBittrexProvider,
+	Coinmarketcap: newCoinMarketCapProvider,
+	Kraken:        newKrakenProvider,
+	Coinbase:      newCoinbaseProvider,
+	Static:        newStaticProvider,
+}
+
+// defaultRateProviders are available even when they are not configured
+var defaultRateProviders = []string{Binance, Kucoin, Mexc, Bittrex, Coinmarketcap, Kraken, Coinbase}
+
+// RegisterRateProviderType adds a provider type that can be used in the rateProviders config
+func RegisterRateProviderType(providerType string, factory RateProviderFactory) {
+	rateProviderFactories[strings.ToLower(providerType)] = factory
+}
+
+func newRateProviders(conf Config) map[string]RateProvider {
+	configs := make(map[string]RateProviderConfig)
+	for _, name := range defaultRateProviders {
+		configs[name] = RateProviderConfig{Name: name}
+	}
+	// keep the key of the old config working
+	configs[Coinmarketcap] = RateProviderConfig{Name: Coinmarketcap, ApiKey: conf.CoimarketcapKey}
+	for _, providerConf := range conf.RateProviders {
+		providerConf.Name = strings.ToLower(strings.TrimSpace(providerConf.Name))
+		if utils.IsEmpty(providerConf.Name) {
+			log.Warnf("a rate provider without name is ignored")
+			continue
+		}
+		if providerConf.Name == Coinmarketcap && utils.IsEmpty(providerConf.ApiKey) {
+			providerConf.ApiKey = conf.CoimarketcapKey
+		}
+		configs[providerConf.Name] = providerConf
+	}
+
+	providers := make(map[string]RateProvider)
+	for name, providerConf := range configs {
+		providerType := strings.ToLower(providerConf.Type)
+		if utils.IsEmpty(providerType) {
+			providerType = name
+		}
+		factory, ok := rateProviderFactories[providerType]
+		if !ok {
+			log.Warnf("rate provider %s has unknown type %s", name, providerType)
+			continue
+		}
+		provider, err := factory(providerConf)
+		if err != nil {
+			log.Warnf("create rate provider %s failed: %v", name, err)
+			continue
+		}
+		providers[name] = provider
+	}
+	return providers
+}
+
+// SetRateProvider adds or replaces the provider of the exchange
+func (s *Service) SetRateProvider(exchange string, provider RateProvider) {
+	s.rateMtx.Lock()
+	s.rateProviders[strings.ToLower(exchange)] = provider
+	s.rateMtx.Unlock()
+	s.rateCache.clear()
+}
+
+// GetRateProvider returns the provider of the exchange
+func (s *Service) GetRateProvider(exchange string) (RateProvider, bool) {
+	s.rateMtx.RLock()
+	defer s.rateMtx.RUnlock()
+	provider, ok := s.rateProviders[strings.ToLower(strings.TrimSpace(exchange))]
+	return provider, ok
+}
+
+// staticProvider returns the rates set manually in the config
+type staticProvider struct {
+	rates map[string]float64
+}
+
+func newStaticProvider(conf RateProviderConfig) (RateProvider, error) {
+	if len(conf.Rates) == 0 {
+		return nil, fmt.Errorf("static provider has no rates")
+	}
+	return &staticProvider{rates: conf.Rates}, nil
+}
+
+func (p *staticProvider) GetRate(currency utils.Method) (float64, error) {
+	rate, ok := p.rates[currency.String()]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no static rate for %s", currency)
+	}
+	return rate, nil
+}
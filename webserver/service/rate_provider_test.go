@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+)
+
+// fakeRateProvider returns fixed rates and counts the requests
+type fakeRateProvider struct {
+	mtx   sync.Mutex
+	rates map[utils.Method]float64
+	calls int
+}
+
+func newFakeRateProvider(rates map[utils.Method]float64) *fakeRateProvider {
+	return &fakeRateProvider{rates: rates}
+}
+
+func (p *fakeRateProvider) GetRate(currency utils.Method) (float64, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.calls++
+	rate, ok := p.rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("no %s rate", currency)
+	}
+	return rate, nil
+}
+
+func (p *fakeRateProvider) requests() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.calls
+}
+
+// newRateTestService returns a service with only the fake providers, the providers of the exchanges are not created
+func newRateTestService(conf Config, providers map[string]RateProvider) *Service {
+	s := &Service{
+		Conf:          conf,
+		exchange:      conf.Exchange,
+		ExchangeList:  conf.ExchangeList,
+		rateProviders: make(map[string]RateProvider),
+		rateCache:     newRateCache(),
+	}
+	for exchange, provider := range providers {
+		s.SetRateProvider(exchange, provider)
+	}
+	return s
+}
+
+func TestRegisterRateProviderType(t *testing.T) {
+	var configured RateProviderConfig
+	RegisterRateProviderType("Fake", func(conf RateProviderConfig) (RateProvider, error) {
+		configured = conf
+		return newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeBTC: 50000}), nil
+	})
+	t.Cleanup(func() { delete(rateProviderFactories, "fake") })
+
+	providers := newRateProviders(Config{RateProviders: []RateProviderConfig{
+		{Name: " MyFeed ", Type: "fake", BaseUrl: "http://feed.local", ApiKey: "key", Timeout: 3, Symbols: map[string]string{"btc": "XBT"}},
+		{Name: "unknown", Type: "nothing"},
+		{Name: "manual", Type: Static, Rates: map[string]float64{"dcr": 15.5}},
+		{Name: "empty", Type: Static},
+		{Type: "fake"},
+	}})
+
+	provider, ok := providers["myfeed"]
+	if !ok {
+		t.Fatal("the provider of the registered type is not created")
+	}
+	if rate, err := provider.GetRate(utils.PaymentTypeBTC); err != nil || rate != 50000 {
+		t.Errorf("rate %f (%v), expected 50000", rate, err)
+	}
+	if configured.BaseUrl != "http://feed.local" || configured.ApiKey != "key" || configured.timeout().Seconds() != 3 {
+		t.Errorf("the config is not passed to the factory: %+v", configured)
+	}
+	if symbol := configured.symbol(utils.PaymentTypeBTC, "%sUSDT"); symbol != "XBT" {
+		t.Errorf("symbol %s, expected the mapped XBT", symbol)
+	}
+	if symbol := configured.symbol(utils.PaymentTypeLTC, "%sUSDT"); symbol != "LTCUSDT" {
+		t.Errorf("symbol %s, expected the default LTCUSDT", symbol)
+	}
+	for _, name := range []string{"unknown", "empty", ""} {
+		if _, ok := providers[name]; ok {
+			t.Errorf("provider %q should not be created", name)
+		}
+	}
+	if rate, err := providers["manual"].GetRate(utils.PaymentTypeDCR); err != nil || rate != 15.5 {
+		t.Errorf("static rate %f (%v), expected 15.5", rate, err)
+	}
+	for _, name := range defaultRateProviders {
+		if _, ok := providers[name]; !ok {
+			t.Errorf("default provider %s is missing", name)
+		}
+	}
+}
+
+func TestGetExchangeRateFromInjectedProvider(t *testing.T) {
+	feed := newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeLTC: 80})
+	s := newRateTestService(Config{ExchangeList: "feed"}, map[string]RateProvider{"Feed": feed})
+
+	rate, err := s.GetExchangeRate(" feed ", utils.PaymentTypeLTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 80 {
+		t.Errorf("rate %f, expected 80", rate)
+	}
+	if _, err := s.GetExchangeRate("feed", utils.PaymentTypeBTC); err == nil {
+		t.Error("expected an error for a coin the provider has no rate of")
+	}
+	if _, err := s.GetExchangeRate("nowhere", utils.PaymentTypeLTC); err == nil {
+		t.Error("expected an error for an exchange without provider")
+	}
+	if _, err := s.GetExchangeRate("", utils.PaymentTypeLTC); err == nil {
+		t.Error("expected an error without exchange")
+	}
+
+	// replacing the provider takes effect on the next request
+	s.SetRateProvider("feed", newFakeRateProvider(map[utils.Method]float64{utils.PaymentTypeLTC: 81}))
+	if rate, _ := s.GetExchangeRate("feed", utils.PaymentTypeLTC); rate != 81 {
+		t.Errorf("rate %f, expected the rate 81 of the new provider", rate)
+	}
+}
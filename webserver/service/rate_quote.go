@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const defaultQuoteTTL = 15 * time.Minute
+
+func (s *Service) quoteTTL() time.Duration {
+	if s.Conf.QuoteTTL > 0 {
+		return time.Duration(s.Conf.QuoteTTL) * time.Second
+	}
+	return defaultQuoteTTL
+}
+
+// CreateRateQuote locks the rate of the exchange in the currency of the payment until the quote expires.
+// The amount is the part of the payment to pay, the remaining balance is quoted when it is zero
+func (s *Service) CreateRateQuote(payment storage.Payment, amount decimal.Decimal, exchange string, method utils.Method) (*storage.RateQuote, error) {
+	if payment.Status == storage.PaymentStatusDisputed {
+		return nil, utils.NewError(fmt.Errorf("the payment is disputed"), utils.ErrorBadRequest)
+	}
+	balance, err := s.PaymentBalance(payment)
+	if err != nil {
+		return nil, err
+	}
+	if !balance.IsPositive() {
+		return nil, utils.NewError(fmt.Errorf("the payment has no balance to pay"), utils.ErrorBadRequest)
+	}
+	if amount.IsNegative() || amount.GreaterThan(balance) {
+		return nil, utils.NewError(fmt.Errorf("the amount must be between 0 and the balance %s", balance), utils.ErrorBadRequest)
+	}
+	if amount.IsZero() {
+		amount = balance
+	}
+	usdRate, err := s.GetExchangeRate(exchange, method)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := s.RateInCurrency(decimal.NewFromFloat(usdRate), payment.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if !rate.IsPositive() {
+		return nil, fmt.Errorf("invalid %s rate from %s", method, exchange)
+	}
+	now := time.Now()
+	quote := &storage.RateQuote{
+		PaymentId:      payment.Id,
+		Exchange:       exchange,
+		Coin:           method,
+		Amount:         amount,
+		Currency:       payment.Currency.OrDefault(),
+		Rate:           rate,
+		ExpectedAmount: utils.ConvertToCoin(amount, rate, method),
+		ExpiresAt:      now.Add(s.quoteTTL()),
+		CreatedAt:      now,
+	}
+	if err := s.db.Create(quote).Error; err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// GetRateQuote returns the quote the payer pays the payment with.
+// The rate and expected amount sent by the payer must match the quote when they are set,
+// they are compared at the precision of the rates and of the coin
+func (s *Service) GetRateQuote(quoteId uint64, payment storage.Payment, method utils.Method, rate, expectedAmount decimal.Decimal) (*storage.RateQuote, error) {
+	var quote storage.RateQuote
+	if err := s.db.Where("id = ?", quoteId).First(&quote).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NewError(fmt.Errorf("rate quote not found, please request a new rate"), utils.ErrorRateQuoteInvalid)
+		}
+		return nil, err
+	}
+	if quote.PaymentId != payment.Id || quote.Coin != method {
+		return nil, utils.NewError(fmt.Errorf("the rate quote was not requested for this payment"), utils.ErrorRateQuoteInvalid)
+	}
+	if quote.UsedAt != nil {
+		return nil, utils.NewError(fmt.Errorf("the rate quote was already used, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	if quote.IsExpired() {
+		return nil, utils.NewError(fmt.Errorf("the rate quote expired, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	balance, err := s.PaymentBalance(payment)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Amount.GreaterThan(balance) || quote.Currency.OrDefault() != payment.Currency.OrDefault() {
+		return nil, utils.NewError(fmt.Errorf("the payment balance changed, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	if !sameAmount(rate, quote.Rate, rateDecimals) || !sameAmount(expectedAmount, quote.ExpectedAmount, method.Decimals()) {
+		return nil, utils.NewError(fmt.Errorf("the rate does not match the rate quote"), utils.ErrorRateQuoteInvalid)
+	}
+	return &quote, nil
+}
+
+// useRateQuote marks the quote used in the transaction recording the payment, so the quote can not pay
+// another time. Two payers submitting the same quote race on the update, the second one is refused
+func useRateQuote(tx *gorm.DB, quoteId uint64) error {
+	result := tx.Model(&storage.RateQuote{}).Where("id = ? AND used_at IS NULL", quoteId).UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(fmt.Errorf("the rate quote was already used, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	return nil
+}
+
+// sameAmount reports whether the amount sent by the client matches the stored one rounded to the places,
+// an unset amount matches any
+func sameAmount(sent, stored decimal.Decimal, places int32) bool {
+	return sent.IsZero() || sent.Round(places).Equal(stored.Round(places))
+}
+
+// CreateBulkRateQuote locks the reference USD rate of the coin for the user to pay payments in bulk until the quote expires
+func (s *Service) CreateBulkRateQuote(userId uint64, method utils.Method) (*storage.BulkRateQuote, error) {
+	rate, err := s.GetBulkRate(method)
+	if err != nil {
+		return nil, err
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("invalid %s bulk rate", method)
+	}
+	now := time.Now()
+	quote := &storage.BulkRateQuote{
+		UserId:    userId,
+		Coin:      method,
+		Rate:      decimal.NewFromFloat(rate),
+		ExpiresAt: now.Add(s.quoteTTL()),
+		CreatedAt: now,
+	}
+	if err := s.db.Create(quote).Error; err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// GetBulkRateQuote returns the bulk quote the user pays the payments of the list with.
+// The rates sent with the payments must match the quote when they are set
+func (s *Service) GetBulkRateQuote(quoteId, userId uint64, method utils.Method, bulkPays []portal.BulkPayment) (*storage.BulkRateQuote, error) {
+	if quoteId == 0 {
+		return nil, utils.NewError(fmt.Errorf("a bulk rate quote is required, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	var quote storage.BulkRateQuote
+	if err := s.db.Where("id = ?", quoteId).First(&quote).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NewError(fmt.Errorf("rate quote not found, please request a new rate"), utils.ErrorRateQuoteInvalid)
+		}
+		return nil, err
+	}
+	if quote.UserId != userId || quote.Coin != method {
+		return nil, utils.NewError(fmt.Errorf("the rate quote was not requested for this bulk payment"), utils.ErrorRateQuoteInvalid)
+	}
+	if quote.UsedAt != nil {
+		return nil, utils.NewError(fmt.Errorf("the rate quote was already used, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	if quote.IsExpired() {
+		return nil, utils.NewError(fmt.Errorf("the rate quote expired, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	for _, pay := range bulkPays {
+		if !sameAmount(pay.Rate, quote.Rate, rateDecimals) {
+			return nil, utils.NewError(fmt.Errorf("the rate of payment %d does not match the rate quote", pay.ID), utils.ErrorRateQuoteInvalid)
+		}
+	}
+	return &quote, nil
+}
+
+// useBulkRateQuote marks the bulk quote used in the transaction recording the bulk payment
+func useBulkRateQuote(tx *gorm.DB, quoteId uint64) error {
+	result := tx.Model(&storage.BulkRateQuote{}).Where("id = ? AND used_at IS NULL", quoteId).UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewError(fmt.Errorf("the rate quote was already used, please request a new rate"), utils.ErrorRateQuoteInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestSameAmount(t *testing.T) {
+	tests := []struct {
+		sent   string
+		stored string
+		places int32
+		same   bool
+	}{
+		{sent: "0", stored: "1.5", places: 8, same: true},
+		{sent: "1.5", stored: "1.50000000", places: 8, same: true},
+		{sent: "1.500000001", stored: "1.5", places: 8, same: true},
+		{sent: "1.50000001", stored: "1.5", places: 8, same: false},
+		// the 18 decimals of an ETH amount are beyond the precision of a float64
+		{sent: "0.123456789012345678", stored: "0.123456789012345678", places: utils.PaymentTypeETH.Decimals(), same: true},
+		{sent: "0.123456789012345678", stored: "0.123456789012345679", places: utils.PaymentTypeETH.Decimals(), same: false},
+	}
+	for _, test := range tests {
+		same := sameAmount(decimal.RequireFromString(test.sent), decimal.RequireFromString(test.stored), test.places)
+		if same != test.same {
+			t.Errorf("sameAmount(%s, %s, %d) = %v, expected %v", test.sent, test.stored, test.places, same, test.same)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paytrackpro/paytrack-be/storage"
+	"github.com/Paytrackpro/paytrack-be/utils"
+	"github.com/Paytrackpro/paytrack-be/webserver/portal"
+	"gorm.io/gorm"
+)
+
+const recurringCheckInterval = time.Minute
+
+// RecurringPaymentNotifier is called with the payments created by the recurring schedules
+type RecurringPaymentNotifier func(payment storage.Payment)
+
+// CreateRecurringPayment schedules the copies of a payment sent by the user
+func (s *Service) CreateRecurringPayment(userId uint64, request portal.RecurringPaymentRequest) (*storage.RecurringPayment, error) {
+	recurring := &storage.RecurringPayment{
+		UserId: userId,
+		Status: storage.RecurringStatusActive,
+	}
+	if err := s.applyRecurringRequest(recurring, request); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(recurring).Error; err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// UpdateRecurringPayment changes the template and the recurrence rule, the next occurrence is computed again
+func (s *Service) UpdateRecurringPayment(id, userId uint64, request portal.RecurringPaymentRequest) (*storage.RecurringPayment, error) {
+	recurring, err := s.GetRecurringPayment(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRecurringRequest(recurring, request); err != nil {
+		return nil, err
+	}
+	if recurring.Status == storage.RecurringStatusEnded && !recurring.IsOver(recurring.NextRunAt) {
+		recurring.Status = storage.RecurringStatusActive
+	}
+	if err := s.db.Save(recurring).Error; err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+func (s *Service) applyRecurringRequest(recurring *storage.RecurringPayment, request portal.RecurringPaymentRequest) error {
+	if !request.Frequency.IsValid() {
+		return utils.NewError(fmt.Errorf("frequency must be weekly, monthly or custom"), utils.ErrorBadRequest)
+	}
+	if request.Interval == 0 {
+		if request.Frequency == storage.RecurrenceCustom {
+			return utils.NewError(fmt.Errorf("the number of days between the payments is required"), utils.ErrorBadRequest)
+		}
+		request.Interval = 1
+	}
+	if request.EndDate != nil && request.EndDate.Before(request.StartAt) {
+		return utils.NewError(fmt.Errorf("the end date must be after the start date"), utils.ErrorBadRequest)
+	}
+	var template storage.Payment
+	if err := s.db.Where("id = ? AND sender_id = ?", request.TemplateId, recurring.UserId).First(&template).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.NewError(fmt.Errorf("template payment not found"), utils.ErrorBadRequest)
+		}
+		return err
+	}
+	if template.IsCreditNote() {
+		return utils.NewError(fmt.Errorf("a credit note can not be the template of a recurring payment"), utils.ErrorBadRequest)
+	}
+	recurring.TemplateId = template.Id
+	recurring.Name = request.Name
+	if utils.IsEmpty(recurring.Name) {
+		recurring.Name = template.Description
+	}
+	recurring.Frequency = request.Frequency
+	recurring.Interval = request.Interval
+	recurring.AutoSend = request.AutoSend
+	recurring.StartAt = request.StartAt
+	recurring.EndDate = request.EndDate
+	recurring.Sequence = recurring.FirstSequenceFrom(time.Now(), 0)
+	recurring.NextRunAt = recurring.Occurrence(recurring.Sequence)
+	if recurring.IsOver(recurring.NextRunAt) {
+		recurring.Status = storage.RecurringStatusEnded
+	}
+	return nil
+}
+
+// GetRecurringPayment returns the schedule of the user
+func (s *Service) GetRecurringPayment(id, userId uint64) (*storage.RecurringPayment, error) {
+	var recurring storage.RecurringPayment
+	if err := s.db.Where("id = ? AND user_id = ?", id, userId).First(&recurring).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, utils.NewError(fmt.Errorf("recurring payment not found"), utils.ErrorNotFound)
+		}
+		return nil, err
+	}
+	return &recurring, nil
+}
+
+// GetRecurringPayments returns the schedules of the user
+func (s *Service) GetRecurringPayments(userId uint64) ([]storage.RecurringPayment, error) {
+	recurrings := make([]storage.RecurringPayment, 0)
+	err := s.db.Where("user_id = ?", userId).Order("next_run_at").Find(&recurrings).Error
+	return recurrings, err
+}
+
+// PauseRecurringPayment stops creating the payments until the schedule is resumed
+func (s *Service) PauseRecurringPayment(id, userId uint64) (*storage.RecurringPayment, error) {
+	recurring, err := s.GetRecurringPayment(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if recurring.Status != storage.RecurringStatusActive {
+		return nil, utils.NewError(fmt.Errorf("the recurring payment is %s", recurring.Status), utils.ErrorBadRequest)
+	}
+	recurring.Status = storage.RecurringStatusPaused
+	if err := s.db.Model(recurring).UpdateColumn("status", recurring.Status).Error; err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// ResumeRecurringPayment restarts the schedule from the next occurrence, the occurrences missed while it was
+// paused are skipped
+func (s *Service) ResumeRecurringPayment(id, userId uint64) (*storage.RecurringPayment, error) {
+	recurring, err := s.GetRecurringPayment(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	if recurring.Status != storage.RecurringStatusPaused {
+		return nil, utils.NewError(fmt.Errorf("the recurring payment is %s", recurring.Status), utils.ErrorBadRequest)
+	}
+	recurring.Sequence = recurring.FirstSequenceFrom(time.Now(), recurring.Sequence)
+	recurring.NextRunAt = recurring.Occurrence(recurring.Sequence)
+	recurring.Status = storage.RecurringStatusActive
+	if recurring.IsOver(recurring.NextRunAt) {
+		recurring.Status = storage.RecurringStatusEnded
+	}
+	err = s.db.Model(recurring).UpdateColumns(map[string]interface{}{
+		"status":      recurring.Status,
+		"sequence":    recurring.Sequence,
+		"next_run_at": recurring.NextRunAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// DeleteRecurringPayment removes the schedule, the payments it created are kept
+func (s *Service) DeleteRecurringPayment(id, userId uint64) error {
+	recurring, err := s.GetRecurringPayment(id, userId)
+	if err != nil {
+		return err
+	}
+	return s.db.Delete(recurring).Error
+}
+
+// RunRecurringScheduler creates the payments of the due schedules, notify is called with every created payment
+func (s *Service) RunRecurringScheduler(notify RecurringPaymentNotifier) {
+	go func() {
+		for range time.Tick(recurringCheckInterval) {
+			s.runDueRecurringPayments(notify)
+		}
+	}()
+}
+
+func (s *Service) runDueRecurringPayments(notify RecurringPaymentNotifier) {
+	var recurrings []storage.RecurringPayment
+	err := s.db.Where("status = ? AND next_run_at <= ?", storage.RecurringStatusActive, time.Now()).Find(&recurrings).Error
+	if err != nil {
+		log.Errorf("get due recurring payments failed: %v", err)
+		return
+	}
+	for i := range recurrings {
+		payment, err := s.runRecurringPayment(&recurrings[i])
+		if err != nil {
+			log.Errorf("run recurring payment %d failed: %v", recurrings[i].Id, err)
+			continue
+		}
+		if payment != nil && notify != nil {
+			notify(*payment)
+		}
+	}
+}
+
+// runRecurringPayment moves the schedule to its next occurrence then creates the payment of the due one.
+// The schedule is claimed with its sequence so a payment is created once when several servers run the scheduler,
+// the claim is given back when the payment can not be created so the occurrence is run again at the next check
+func (s *Service) runRecurringPayment(recurring *storage.RecurringPayment) (*storage.Payment, error) {
+	runAt := recurring.NextRunAt
+	now := time.Now()
+	dueSequence := recurring.Sequence
+	if recurring.IsOver(runAt) {
+		return nil, s.db.Model(recurring).UpdateColumn("status", storage.RecurringStatusEnded).Error
+	}
+	nextSequence := recurring.FirstSequenceFrom(now, dueSequence+1)
+	if skipped := nextSequence - dueSequence - 1; skipped > 0 {
+		log.Warnf("recurring payment %d skipped %d missed occurrences", recurring.Id, skipped)
+	}
+	nextRunAt := recurring.Occurrence(nextSequence)
+	status := storage.RecurringStatusActive
+	if recurring.IsOver(nextRunAt) {
+		status = storage.RecurringStatusEnded
+	}
+	res := s.db.Model(&storage.RecurringPayment{}).
+		Where("id = ? AND sequence = ? AND status = ?", recurring.Id, dueSequence, storage.RecurringStatusActive).
+		UpdateColumns(map[string]interface{}{
+			"sequence":    nextSequence,
+			"next_run_at": nextRunAt,
+			"status":      status,
+			"run_count":   gorm.Expr("run_count + 1"),
+			"last_run_at": now,
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		// another scheduler ran the occurrence or the schedule was changed meanwhile
+		return nil, nil
+	}
+
+	payment, err := s.createRecurringInstance(recurring, dueSequence, runAt)
+	if err != nil {
+		releaseErr := s.db.Model(&storage.RecurringPayment{}).
+			Where("id = ? AND sequence = ?", recurring.Id, nextSequence).
+			UpdateColumns(map[string]interface{}{
+				"sequence":    dueSequence,
+				"next_run_at": runAt,
+				"status":      storage.RecurringStatusActive,
+				"run_count":   gorm.Expr("run_count - 1"),
+				"last_error":  err.Error(),
+			}).Error
+		if releaseErr != nil {
+			log.Errorf("release occurrence %d of recurring payment %d failed: %v", dueSequence, recurring.Id, releaseErr)
+		}
+		return nil, err
+	}
+	updates := map[string]interface{}{"last_error": "", "last_payment_id": payment.Id}
+	if updateErr := s.db.Model(recurring).UpdateColumns(updates).Error; updateErr != nil {
+		log.Errorf("update recurring payment %d failed: %v", recurring.Id, updateErr)
+	}
+	return payment, nil
+}
+
+// createRecurringInstance copies the template through CreatePayment. The dates of the invoice lines are
+// moved by the number of periods since the start of the schedule
+func (s *Service) createRecurringInstance(recurring *storage.RecurringPayment, sequence int, runAt time.Time) (*storage.Payment, error) {
+	var template storage.Payment
+	if err := s.db.Where("id = ?", recurring.TemplateId).First(&template).Error; err != nil {
+		return nil, fmt.Errorf("get template payment %d failed: %v", recurring.TemplateId, err)
+	}
+	sender, err := s.GetUserInfo(template.SenderId)
+	if err != nil {
+		return nil, err
+	}
+	details := make([]storage.PaymentDetail, len(template.Details))
+	for i, detail := range template.Details {
+		if date, err := time.Parse("2006/01/02", GetFullFormatDate(detail.Date)); err == nil {
+			detail.Date = recurring.Shift(date, sequence).Format("2006/01/02")
+		}
+		details[i] = detail
+	}
+	status := storage.PaymentStatusCreated
+	if recurring.AutoSend {
+		status = storage.PaymentStatusSent
+	}
+	request := portal.PaymentRequest{
+		SenderId:              template.SenderId,
+		ReceiverId:            template.ReceiverId,
+		ExternalEmail:         template.ExternalEmail,
+		ContactMethod:         template.ContactMethod,
+		HourlyRate:            template.HourlyRate,
+		PaymentSettings:       template.PaymentSettings,
+		Amount:                template.Amount,
+		TaxRate:               template.TaxRate,
+		Discount:              template.Discount,
+		Currency:              template.Currency,
+		Description:           template.Description,
+		Details:               details,
+		Status:                status,
+		ShowDateOnInvoiceLine: template.ShowDateOnInvoiceLine,
+		ShowProjectOnInvoice:  template.ShowProjectOnInvoice,
+		ProjectId:             template.ProjectId,
+		ProjectName:           template.ProjectName,
+		PaymentType:           template.PaymentType,
+		UserPaymentMethodId:   template.UserPaymentMethodId,
+	}
+	if template.PaymentType == utils.PaymentUrl {
+		request.PaymentCode = s.GenerateRandomCode()
+	}
+	log.Infof("recurring payment %d creates occurrence %d of %s", recurring.Id, sequence, runAt.Format(time.RFC3339))
+	return s.CreatePayment(sender.Id, sender.UserName, sender.DisplayName, sender.ShowDraftForRecipient, request)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/Paytrackpro/paytrack-be/authpb"
@@ -80,6 +81,9 @@ func (s *WebServer) Run() error {
 	log.Info("mgmtng is running on port:", s.conf.Port)
 	s.service.RunMigrations()
 	s.service.RunTimeTask()
+	s.service.RunConfirmationTracker()
+	s.service.RunRateSampleRetention()
+	s.service.RunRecurringScheduler(s.notifyRecurringPayment)
 	go s.socket.Serve()
 	go s.service.NotifyCryptoPriceChanged()
 	var server = http.Server{
@@ -247,3 +251,33 @@ func (s *WebServer) credentialsInfo(r *http.Request) (*authClaims, bool) {
 	claims, ok := val.(*authClaims)
 	return claims, ok
 }
+
+// ifMatchVersion returns the version of the If-Match header, e.g. "3" or W/"3", or the version
+// of the body when the header is not sent
+func ifMatchVersion(r *http.Request, version int64) int64 {
+	match := strings.Trim(strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/"), `"`)
+	if headerVersion, err := strconv.ParseInt(match, 10, 64); err == nil && headerVersion > 0 {
+		return headerVersion
+	}
+	return version
+}
+
+// versionTag returns the ETag of the version of a payment or a project
+func versionTag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// versionConflict responds the version conflict error with the current state of the payment or the project,
+// so the client can apply its changes to it again. It returns false when the error is not a conflict
+func (s *WebServer) versionConflict(w http.ResponseWriter, err error, current storage.Versioned, id uint64) bool {
+	if customErr, ok := err.(*utils.Error); !ok || customErr.Code != utils.ErrorVersionConflict {
+		return false
+	}
+	if dbErr := s.db.GetDB().First(current, id).Error; dbErr != nil {
+		utils.Response(w, http.StatusInternalServerError, utils.InternalError.With(dbErr), nil)
+		return true
+	}
+	w.Header().Set("ETag", versionTag(current.CurrentVersion()))
+	utils.Response(w, http.StatusConflict, err, current)
+	return true
+}